@@ -0,0 +1,173 @@
+package geecache
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 签名相关的请求头
+const (
+	headerKeyID     = "X-Geecache-Key-Id"
+	headerTimestamp = "X-Geecache-Timestamp"
+	headerNonce     = "X-Geecache-Nonce"
+	headerSignature = "X-Geecache-Signature"
+	headerBodyHash  = "X-Geecache-Content-Sha256" // 请求体的 SHA-256，写入请求的值也在签名范围内
+
+	defaultHMACWindow = 30 * time.Second
+)
+
+var errUnauthorized = errors.New("请求签名校验失败")
+
+// HMACOptions 节点间请求签名配置：使用共享密钥对请求方法、路径、时间戳、随机数、
+// 请求体的哈希以及来源节点签名，
+// 服务端校验签名并拒绝时间窗口之外或重复的请求
+type HMACOptions struct {
+	// Keys 当前有效的密钥，键为密钥 ID，校验时根据请求中的密钥 ID 选择密钥
+	// 轮换密钥时先在所有节点上同时配置新旧密钥，再切换 SignKeyID，最后移除旧密钥
+	Keys map[string][]byte
+	// SignKeyID 发送请求时签名使用的密钥 ID，必须在 Keys 中
+	SignKeyID string
+	// Window 允许的时间偏差，超出的请求被拒绝，默认为 30s
+	Window time.Duration
+}
+
+// hmacAuth 负责请求的签名与校验，并发安全
+type hmacAuth struct {
+	mu        sync.RWMutex
+	keys      map[string][]byte
+	signKeyID string
+	window    time.Duration
+
+	nonceMu   sync.Mutex
+	nonces    map[string]time.Time // 已经使用过的随机数及其过期时间
+	lastSweep time.Time
+}
+
+func newHMACAuth(o *HMACOptions) *hmacAuth {
+	a := &hmacAuth{window: o.Window, nonces: make(map[string]time.Time)}
+	if a.window == 0 {
+		a.window = defaultHMACWindow
+	}
+	a.setKeys(o.Keys, o.SignKeyID)
+	return a
+}
+
+// setKeys 替换密钥，用于密钥轮换
+func (a *hmacAuth) setKeys(keys map[string][]byte, signKeyID string) {
+	copied := make(map[string][]byte, len(keys))
+	for id, key := range keys {
+		copied[id] = append([]byte(nil), key...)
+	}
+	a.mu.Lock()
+	a.keys, a.signKeyID = copied, signKeyID
+	a.mu.Unlock()
+}
+
+// mac 计算签名：HMAC-SHA256(method \n path \n timestamp \n nonce \n bodyHash \n peer \n leaving)
+func mac(key []byte, r *http.Request, ts, nonce string) []byte {
+	h := hmac.New(sha256.New, key)
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n%s\n%s\n%s", r.Method, r.URL.RequestURI(), ts, nonce,
+		r.Header.Get(headerBodyHash), r.Header.Get(peerHeader), r.Header.Get(leavingHeader))
+	return h.Sum(nil)
+}
+
+// bodyHash 计算请求体的哈希
+func bodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// sign 为请求添加签名相关的请求头，body 为请求体，需要在设置来源节点等请求头之后调用
+func (a *hmacAuth) sign(req *http.Request, body []byte) error {
+	a.mu.RLock()
+	id := a.signKeyID
+	key, ok := a.keys[id]
+	a.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("签名密钥 %q 不存在", id)
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().UnixNano(), 10)
+	nonce := hex.EncodeToString(b)
+	req.Header.Set(headerKeyID, id)
+	req.Header.Set(headerTimestamp, ts)
+	req.Header.Set(headerNonce, nonce)
+	req.Header.Set(headerBodyHash, bodyHash(body))
+	req.Header.Set(headerSignature, hex.EncodeToString(mac(key, req, ts, nonce)))
+	return nil
+}
+
+// verifyBody 校验读取到的请求体与签名中的哈希一致，verify 不读取请求体，需要请求体的接口自行调用
+func (a *hmacAuth) verifyBody(r *http.Request, body []byte) error {
+	if r.Header.Get(headerBodyHash) != bodyHash(body) {
+		return errUnauthorized
+	}
+	return nil
+}
+
+// verify 校验请求的签名、时间戳，并拒绝重放的请求
+func (a *hmacAuth) verify(r *http.Request) error {
+	id := r.Header.Get(headerKeyID)
+	ts := r.Header.Get(headerTimestamp)
+	nonce := r.Header.Get(headerNonce)
+	sig, err := hex.DecodeString(r.Header.Get(headerSignature))
+	if err != nil || ts == "" || nonce == "" {
+		return errUnauthorized
+	}
+	// 1.根据密钥 ID 选择密钥
+	a.mu.RLock()
+	key, ok := a.keys[id]
+	a.mu.RUnlock()
+	if !ok {
+		return errUnauthorized
+	}
+	// 2.校验签名
+	if !hmac.Equal(sig, mac(key, r, ts, nonce)) {
+		return errUnauthorized
+	}
+	// 3.校验时间戳是否在窗口内
+	nanos, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errUnauthorized
+	}
+	now := time.Now()
+	if d := now.Sub(time.Unix(0, nanos)); d > a.window || d < -a.window {
+		return errUnauthorized
+	}
+	// 4.校验随机数是否用过，窗口内的随机数需要保留到窗口结束
+	a.nonceMu.Lock()
+	defer a.nonceMu.Unlock()
+	if now.Sub(a.lastSweep) > a.window {
+		for n, expire := range a.nonces {
+			if now.After(expire) {
+				delete(a.nonces, n)
+			}
+		}
+		a.lastSweep = now
+	}
+	if _, used := a.nonces[nonce]; used {
+		return errUnauthorized
+	}
+	a.nonces[nonce] = time.Unix(0, nanos).Add(a.window)
+	return nil
+}
+
+// RotateHMACKeys 在运行时替换签名密钥，未配置 HMAC 时返回错误
+func (p *HTTPPool) RotateHMACKeys(keys map[string][]byte, signKeyID string) error {
+	if p.auth == nil {
+		return errors.New("未配置 HMAC 签名")
+	}
+	p.auth.setKeys(keys, signKeyID)
+	return nil
+}
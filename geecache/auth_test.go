@@ -0,0 +1,115 @@
+package geecache
+
+import (
+	"encoding/hex"
+	pb "geecache/geecachepb"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var testKeys = map[string][]byte{
+	"k1": []byte("old-secret"),
+	"k2": []byte("new-secret"),
+}
+
+// 测试签名的请求可以通过，未签名的请求被拒绝
+func TestHMACAuth(t *testing.T) {
+	NewGroup("hmac-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	server := httptest.NewServer(NewHTTPPoolOpts("server", &HTTPPoolOptions{
+		HMAC: &HMACOptions{Keys: testKeys, SignKeyID: "k2"},
+	}))
+	defer server.Close()
+
+	// 1.使用任意一个有效密钥签名的请求都可以通过，便于密钥轮换
+	for _, id := range []string{"k1", "k2"} {
+		client := NewHTTPPoolOpts("client", &HTTPPoolOptions{
+			HMAC: &HMACOptions{Keys: testKeys, SignKeyID: id},
+		})
+		client.Set(server.URL)
+		peer, _ := client.PickPeer("Tom")
+		if err := peer.Get(&pb.Request{Group: []byte("hmac-scores"), Key: []byte("Tom")}, &pb.Response{}); err != nil {
+			t.Fatalf("使用密钥 %s 签名的请求失败：%v", id, err)
+		}
+	}
+
+	// 2.未签名或密钥错误的请求返回 401
+	for name, o := range map[string]*HTTPPoolOptions{
+		"未签名":  nil,
+		"密钥错误": {HMAC: &HMACOptions{Keys: map[string][]byte{"k1": []byte("wrong")}, SignKeyID: "k1"}},
+		"未知密钥": {HMAC: &HMACOptions{Keys: map[string][]byte{"k3": []byte("x")}, SignKeyID: "k3"}},
+	} {
+		client := NewHTTPPoolOpts("client", o)
+		client.Set(server.URL)
+		peer, _ := client.PickPeer("Tom")
+		err := peer.Get(&pb.Request{Group: []byte("hmac-scores"), Key: []byte("Tom")}, &pb.Response{})
+		if se, ok := err.(*statusError); !ok || se.code != http.StatusUnauthorized {
+			t.Fatalf("%s的请求应该返回 401，实际 %v", name, err)
+		}
+	}
+
+	// 3.健康检查接口不需要签名
+	res, err := http.Get(server.URL + defaultBasePath + healthPath)
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("健康检查接口不应该要求签名")
+	}
+	res.Body.Close()
+}
+
+// 测试重放、篡改路径和过期的请求被拒绝
+func TestHMACAuthReplay(t *testing.T) {
+	a := newHMACAuth(&HMACOptions{Keys: testKeys, SignKeyID: "k1", Window: time.Second})
+	req := httptest.NewRequest(http.MethodGet, "/_geecache/g/Tom", nil)
+	if err := a.sign(req, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.verify(req); err != nil {
+		t.Fatalf("第一次请求应该通过：%v", err)
+	}
+	if err := a.verify(req); err == nil {
+		t.Fatalf("重放的请求应该被拒绝")
+	}
+
+	// 篡改路径
+	req = httptest.NewRequest(http.MethodGet, "/_geecache/g/Tom", nil)
+	a.sign(req, nil)
+	req.URL.Path = "/_geecache/g/Jack"
+	if err := a.verify(req); err == nil {
+		t.Fatalf("篡改路径的请求应该被拒绝")
+	}
+
+	// 时间戳超出窗口，即使签名正确也拒绝
+	req = httptest.NewRequest(http.MethodGet, "/_geecache/g/Tom", nil)
+	ts := strconv.FormatInt(time.Now().Add(-time.Minute).UnixNano(), 10)
+	req.Header.Set(headerKeyID, "k1")
+	req.Header.Set(headerTimestamp, ts)
+	req.Header.Set(headerNonce, "n1")
+	req.Header.Set(headerSignature, hexMAC(testKeys["k1"], req, ts, "n1"))
+	if err := a.verify(req); err == nil {
+		t.Fatalf("过期的请求应该被拒绝")
+	}
+}
+
+// 测试运行时轮换密钥
+func TestHMACRotate(t *testing.T) {
+	p := NewHTTPPoolOpts("server", &HTTPPoolOptions{HMAC: &HMACOptions{Keys: testKeys, SignKeyID: "k1"}})
+	req := httptest.NewRequest(http.MethodGet, "/_geecache/g/Tom", nil)
+	p.auth.sign(req, nil)
+	if err := p.RotateHMACKeys(map[string][]byte{"k2": testKeys["k2"]}, "k2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.auth.verify(req); err == nil {
+		t.Fatalf("移除的密钥签名的请求应该被拒绝")
+	}
+	if err := NewHTTPPool("x").RotateHMACKeys(testKeys, "k1"); err == nil {
+		t.Fatalf("未配置 HMAC 时应该返回错误")
+	}
+}
+
+func hexMAC(key []byte, req *http.Request, ts, nonce string) string {
+	return hex.EncodeToString(mac(key, req, ts, nonce))
+}
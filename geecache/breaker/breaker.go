@@ -0,0 +1,282 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen 熔断器处于打开状态时直接返回该错误，不再执行请求
+var ErrOpen = errors.New("熔断器已打开")
+
+// State 熔断器状态
+type State int
+
+const (
+	Closed   State = iota // 关闭：请求正常通过，统计错误率
+	Open                  // 打开：直接拒绝请求
+	HalfOpen              // 半开：放行少量探测请求，成功则关闭，失败则重新打开
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+const (
+	numBuckets = 10 // 滑动窗口划分的桶数
+
+	defaultWindow           = 10 * time.Second
+	defaultMinRequests      = 20
+	defaultErrorRate        = 0.5
+	defaultOpenTimeout      = 5 * time.Second
+	defaultHalfOpenRequests = 1
+)
+
+// Options 熔断器配置，零值字段使用默认值
+type Options struct {
+	// Window 统计错误率的滑动窗口大小
+	Window time.Duration
+	// MinRequests 窗口内请求数达到该值后才根据错误率打开熔断器
+	MinRequests int64
+	// ErrorRate 错误率阈值（0~1），超过则打开熔断器
+	ErrorRate float64
+	// SlowCall 耗时超过该值的请求视为失败，为 0 表示不统计慢请求
+	SlowCall time.Duration
+	// OpenTimeout 打开后经过多久进入半开状态
+	OpenTimeout time.Duration
+	// HalfOpenRequests 半开状态下允许同时通过的探测请求数，全部成功后关闭熔断器
+	HalfOpenRequests int
+	// IsFailure 判断错误是否计为失败，为 nil 时所有非 nil 错误都计为失败
+	IsFailure func(err error) bool
+	// OnStateChange 状态变化时的回调，可以为 nil，调用时不持有锁
+	OnStateChange func(from, to State)
+}
+
+// Stats 熔断器统计信息
+type Stats struct {
+	State    State
+	Requests int64 // 当前窗口内的请求数
+	Failures int64 // 当前窗口内的失败数
+	Trips    int64 // 累计打开的次数
+}
+
+type bucket struct {
+	start    time.Time
+	requests int64
+	failures int64
+}
+
+// Breaker 熔断器，并发安全
+type Breaker struct {
+	opts Options
+
+	mu       sync.Mutex
+	state    State
+	openedAt time.Time
+	buckets  [numBuckets]bucket
+	probes   int    // 半开状态下正在进行的探测请求数
+	passed   int    // 半开状态下已经成功的探测请求数
+	gen      uint64 // 每次切换状态加一，忽略上一个状态中发出的请求的结果
+	trips    int64
+}
+
+// New 创建熔断器
+func New(o Options) *Breaker {
+	if o.Window == 0 {
+		o.Window = defaultWindow
+	}
+	if o.MinRequests == 0 {
+		o.MinRequests = defaultMinRequests
+	}
+	if o.ErrorRate == 0 {
+		o.ErrorRate = defaultErrorRate
+	}
+	if o.OpenTimeout == 0 {
+		o.OpenTimeout = defaultOpenTimeout
+	}
+	if o.HalfOpenRequests == 0 {
+		o.HalfOpenRequests = defaultHalfOpenRequests
+	}
+	return &Breaker{opts: o}
+}
+
+// Do 在熔断器的保护下执行 fn，熔断器打开时直接返回 ErrOpen
+func (b *Breaker) Do(fn func() error) error {
+	gen, err := b.allow()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	// fn panic 时计为失败，同样要记录结果，否则半开状态的探测名额不会释放
+	failed := true
+	defer func() { b.record(gen, failed, time.Since(start)) }()
+	err = fn()
+	failed = b.isFailure(err)
+	return err
+}
+
+// isFailure 判断错误是否计为失败
+func (b *Breaker) isFailure(err error) bool {
+	if err != nil && b.opts.IsFailure != nil {
+		return b.opts.IsFailure(err)
+	}
+	return err != nil
+}
+
+// Allow 判断当前是否允许请求通过，不会占用半开状态的探测名额
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.currentState(time.Now()) {
+	case Open:
+		return false
+	case HalfOpen:
+		return b.probes < b.opts.HalfOpenRequests
+	}
+	return true
+}
+
+// State 返回熔断器当前的状态
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.currentState(time.Now())
+}
+
+// Stats 返回熔断器的统计信息
+func (b *Breaker) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	requests, failures := b.counts(now)
+	return Stats{
+		State:    b.currentState(now),
+		Requests: requests,
+		Failures: failures,
+		Trips:    b.trips,
+	}
+}
+
+// allow 申请执行一次请求，返回当前状态的代数
+func (b *Breaker) allow() (uint64, error) {
+	b.mu.Lock()
+	now := time.Now()
+	from := b.state
+	state := b.currentState(now)
+	if state == HalfOpen && from == Open {
+		b.setState(HalfOpen, now)
+	}
+	var err error
+	switch state {
+	case Open:
+		err = ErrOpen
+	case HalfOpen:
+		if b.probes >= b.opts.HalfOpenRequests {
+			err = ErrOpen
+		} else {
+			b.probes++
+		}
+	}
+	gen := b.gen
+	b.mu.Unlock()
+	b.notify(from, state)
+	return gen, err
+}
+
+// record 记录一次请求的结果，根据结果切换状态
+func (b *Breaker) record(gen uint64, failed bool, elapsed time.Duration) {
+	if b.opts.SlowCall > 0 && elapsed > b.opts.SlowCall {
+		failed = true
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	from := b.state
+	if gen != b.gen {
+		// 状态已经切换，结果不再有参考价值
+		b.mu.Unlock()
+		return
+	}
+	switch b.state {
+	case HalfOpen:
+		b.probes--
+		if failed {
+			// 探测失败，重新打开
+			b.setState(Open, now)
+		} else if b.passed++; b.passed >= b.opts.HalfOpenRequests {
+			// 探测全部成功，关闭熔断器
+			b.setState(Closed, now)
+		}
+	case Closed:
+		bk := b.bucket(now)
+		bk.requests++
+		if failed {
+			bk.failures++
+			requests, failures := b.counts(now)
+			if requests >= b.opts.MinRequests && float64(failures) >= b.opts.ErrorRate*float64(requests) {
+				b.setState(Open, now)
+			}
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+}
+
+// currentState 返回考虑超时后的状态，需要持有 b.mu
+func (b *Breaker) currentState(now time.Time) State {
+	if b.state == Open && now.Sub(b.openedAt) >= b.opts.OpenTimeout {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// setState 切换状态并重置相关计数，需要持有 b.mu
+func (b *Breaker) setState(s State, now time.Time) {
+	b.state = s
+	b.gen++
+	b.probes, b.passed = 0, 0
+	switch s {
+	case Open:
+		b.openedAt = now
+		b.trips++
+	case Closed:
+		b.buckets = [numBuckets]bucket{}
+	}
+}
+
+func (b *Breaker) notify(from, to State) {
+	if from != to && b.opts.OnStateChange != nil {
+		b.opts.OnStateChange(from, to)
+	}
+}
+
+// bucket 返回当前时间对应的桶，过期的桶会被清空，需要持有 b.mu
+func (b *Breaker) bucket(now time.Time) *bucket {
+	width := b.opts.Window / numBuckets
+	start := now.Truncate(width)
+	bk := &b.buckets[(start.UnixNano()/int64(width))%numBuckets]
+	if !bk.start.Equal(start) {
+		*bk = bucket{start: start}
+	}
+	return bk
+}
+
+// counts 统计滑动窗口内的请求数和失败数，需要持有 b.mu
+func (b *Breaker) counts(now time.Time) (requests, failures int64) {
+	for _, bk := range b.buckets {
+		if now.Sub(bk.start) < b.opts.Window {
+			requests += bk.requests
+			failures += bk.failures
+		}
+	}
+	return
+}
@@ -0,0 +1,122 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var errFail = errors.New("fail")
+
+func fail() error { return errFail }
+func ok() error   { return nil }
+
+// 测试错误率超过阈值后打开熔断器，超时后进入半开，探测成功后关闭
+func TestBreakerTransitions(t *testing.T) {
+	var changes []State
+	b := New(Options{
+		MinRequests: 4,
+		ErrorRate:   0.5,
+		OpenTimeout: 20 * time.Millisecond,
+		OnStateChange: func(from, to State) {
+			changes = append(changes, to)
+		},
+	})
+	// 1.请求数不足时不打开
+	b.Do(fail)
+	b.Do(fail)
+	b.Do(ok)
+	if b.State() != Closed {
+		t.Fatalf("请求数不足时不应该打开")
+	}
+	// 2.错误率达到 50% 后打开，直接返回 ErrOpen
+	b.Do(fail)
+	if b.State() != Open {
+		t.Fatalf("错误率超过阈值应该打开")
+	}
+	called := false
+	if err := b.Do(func() error { called = true; return nil }); err != ErrOpen || called {
+		t.Fatalf("打开状态应该直接返回 ErrOpen")
+	}
+	// 3.超时后进入半开，探测成功后关闭
+	time.Sleep(30 * time.Millisecond)
+	if b.State() != HalfOpen {
+		t.Fatalf("超时后应该进入半开状态")
+	}
+	if err := b.Do(ok); err != nil {
+		t.Fatalf("半开状态应该放行探测请求：%v", err)
+	}
+	if b.State() != Closed {
+		t.Fatalf("探测成功后应该关闭")
+	}
+	expect := []State{Open, HalfOpen, Closed}
+	if len(changes) != len(expect) {
+		t.Fatalf("状态变化不符合预期：%v", changes)
+	}
+	for i := range expect {
+		if changes[i] != expect[i] {
+			t.Fatalf("状态变化不符合预期：%v", changes)
+		}
+	}
+	if b.Stats().Trips != 1 {
+		t.Fatalf("应该记录一次打开")
+	}
+}
+
+// 测试半开状态下探测失败会重新打开
+func TestBreakerHalfOpenFailure(t *testing.T) {
+	b := New(Options{MinRequests: 1, OpenTimeout: 10 * time.Millisecond})
+	b.Do(fail)
+	time.Sleep(20 * time.Millisecond)
+	if err := b.Do(fail); err != errFail {
+		t.Fatalf("半开状态应该执行探测请求")
+	}
+	if b.State() != Open {
+		t.Fatalf("探测失败后应该重新打开")
+	}
+}
+
+// 测试慢请求计为失败，IsFailure 过滤的错误不计为失败
+func TestBreakerSlowCallAndIsFailure(t *testing.T) {
+	ignored := errors.New("ignored")
+	b := New(Options{
+		MinRequests: 2,
+		SlowCall:    5 * time.Millisecond,
+		IsFailure:   func(err error) bool { return err != ignored },
+	})
+	b.Do(func() error { return ignored })
+	b.Do(func() error { return ignored })
+	if b.State() != Closed {
+		t.Fatalf("被忽略的错误不应该打开熔断器")
+	}
+	b.Do(func() error { time.Sleep(10 * time.Millisecond); return nil })
+	b.Do(func() error { time.Sleep(10 * time.Millisecond); return nil })
+	if b.State() != Open {
+		t.Fatalf("慢请求应该计为失败")
+	}
+}
+
+// 测试半开状态下探测请求 panic 时释放探测名额，熔断器不会一直拒绝请求
+func TestBreakerHalfOpenPanic(t *testing.T) {
+	b := New(Options{MinRequests: 1, OpenTimeout: 10 * time.Millisecond})
+	b.Do(fail)
+	time.Sleep(20 * time.Millisecond)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("panic 应该继续向上传递")
+			}
+		}()
+		b.Do(func() error { panic("probe") })
+	}()
+	if b.State() != Open {
+		t.Fatalf("探测请求 panic 后应该重新打开")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := b.Do(ok); err != nil {
+		t.Fatalf("超时后应该再次放行探测请求：%v", err)
+	}
+	if b.State() != Closed {
+		t.Fatalf("探测成功后应该关闭")
+	}
+}
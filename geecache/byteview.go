@@ -1,18 +1,67 @@
 package geecache
 
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
 // 只读数据结构 ByteView 用来表示缓存值
+// b 和 s 只有一个有效：b 不为 nil 时使用 b，否则使用 s（字符串形式的值，转换时不需要复制）
 type ByteView struct {
-	b []byte // 使用 byte 类型可以支持任意数据类型的存储，如字符串、图片等
+	b       []byte    // 使用 byte 类型可以支持任意数据类型的存储，如字符串、图片等
+	s       string    // 字符串形式的值
+	e       time.Time // 过期时间，零值表示不过期
+	version int64     // 版本号，为值写入缓存的时间（Unix 纳秒）
+	stale   bool      // 是否是回源被拒绝时返回的旧值
+	enc     string    // b 使用的压缩算法，只有缓存中的值会被压缩，返回给调用方前解压
+	chunked bool      // b 是分块存储的清单，只会出现在缓存中
 }
 
 // Len 方法 获取缓存的大小
 func (v ByteView) Len() int {
-	return len(v.b)
+	if v.b != nil {
+		return len(v.b)
+	}
+	return len(v.s)
+}
+
+// Expire 返回过期时间，零值表示不过期
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
+// Version 返回版本号，值越大越新，为 0 表示未知
+func (v ByteView) Version() int64 {
+	return v.version
+}
+
+// Stale 返回该值是否是回源被拒绝时返回的旧值
+func (v ByteView) Stale() bool {
+	return v.stale
+}
+
+// expired 判断是否已经过期
+func (v ByteView) expired(now time.Time) bool {
+	return !v.e.IsZero() && now.After(v.e)
 }
 
 // ByteSlice 方法返回一个拷贝，防止缓存值被外部程序修改。
 func (v ByteView) ByteSlice() []byte {
-	return cloneBytes(v.b)
+	if v.b != nil {
+		return cloneBytes(v.b)
+	}
+	return []byte(v.s)
+}
+
+// rawBytes 返回底层的字节，[]byte 形式的值不复制，调用方不能修改返回值
+func (v ByteView) rawBytes() []byte {
+	if v.b != nil {
+		return v.b
+	}
+	return []byte(v.s)
 }
 
 // cloneBytes 函数返回缓存的拷贝，防止外部程序修改，此方法不对外提供，内部自己调
@@ -24,5 +73,102 @@ func cloneBytes(b []byte) []byte {
 
 // String 方法返回字符串类型的缓存
 func (v ByteView) String() string {
-	return string(v.b)
+	if v.b != nil {
+		return string(v.b)
+	}
+	return v.s
+}
+
+// At 返回下标 i 处的字节
+func (v ByteView) At(i int) byte {
+	if v.b != nil {
+		return v.b[i]
+	}
+	return v.s[i]
+}
+
+// Slice 返回 [from, to) 之间的部分，不会复制数据
+func (v ByteView) Slice(from, to int) ByteView {
+	if v.b != nil {
+		return ByteView{b: v.b[from:to]}
+	}
+	return ByteView{s: v.s[from:to]}
+}
+
+// SliceFrom 返回从 from 开始的部分，不会复制数据
+func (v ByteView) SliceFrom(from int) ByteView {
+	if v.b != nil {
+		return ByteView{b: v.b[from:]}
+	}
+	return ByteView{s: v.s[from:]}
+}
+
+// Copy 将值复制到 dest，返回复制的字节数
+func (v ByteView) Copy(dest []byte) int {
+	if v.b != nil {
+		return copy(dest, v.b)
+	}
+	return copy(dest, v.s)
+}
+
+// Equal 判断两个值的内容是否相同，不比较过期时间等元信息
+func (v ByteView) Equal(b2 ByteView) bool {
+	if b2.b == nil {
+		return v.EqualString(b2.s)
+	}
+	return v.EqualBytes(b2.b)
+}
+
+// EqualString 判断值的内容是否与 s 相同
+func (v ByteView) EqualString(s string) bool {
+	if v.b == nil {
+		return v.s == s
+	}
+	return string(v.b) == s // 编译器会优化掉这里的转换，不会分配内存
+}
+
+// EqualBytes 判断值的内容是否与 b2 相同
+func (v ByteView) EqualBytes(b2 []byte) bool {
+	if v.b != nil {
+		return bytes.Equal(v.b, b2)
+	}
+	return v.s == string(b2)
+}
+
+// Reader 返回读取缓存值的 io.ReadSeeker，不会复制数据
+func (v ByteView) Reader() io.ReadSeeker {
+	if v.b != nil {
+		return bytes.NewReader(v.b)
+	}
+	return strings.NewReader(v.s)
+}
+
+// ReadAt 实现 io.ReaderAt
+func (v ByteView) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("ByteView.ReadAt：偏移量为负数")
+	}
+	if off >= int64(v.Len()) {
+		return 0, io.EOF
+	}
+	n = v.SliceFrom(int(off)).Copy(p)
+	if n < len(p) {
+		err = io.EOF
+	}
+	return
+}
+
+// WriteTo 将缓存值写入 w，不会复制数据
+func (v ByteView) WriteTo(w io.Writer) (int64, error) {
+	var n int
+	var err error
+	if v.b != nil {
+		n, err = w.Write(v.b)
+	} else {
+		n, err = io.WriteString(w, v.s)
+	}
+	if err == nil && n != v.Len() {
+		err = io.ErrShortWrite
+	}
+	return int64(n), err
 }
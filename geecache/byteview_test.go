@@ -0,0 +1,92 @@
+package geecache
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// byteViews 同一个值的 []byte 形式和字符串形式
+func byteViews(s string) map[string]ByteView {
+	return map[string]ByteView{
+		"bytes":  {b: []byte(s)},
+		"string": {s: s},
+	}
+}
+
+func TestByteView(t *testing.T) {
+	for name, v := range byteViews("hello") {
+		if v.Len() != 5 || v.String() != "hello" || v.At(1) != 'e' {
+			t.Fatalf("%s：Len/String/At 错误", name)
+		}
+		if s := v.Slice(1, 3); s.String() != "el" {
+			t.Fatalf("%s：Slice 错误：%q", name, s.String())
+		}
+		if s := v.SliceFrom(3); s.String() != "lo" {
+			t.Fatalf("%s：SliceFrom 错误：%q", name, s.String())
+		}
+		dest := make([]byte, 3)
+		if n := v.Copy(dest); n != 3 || string(dest) != "hel" {
+			t.Fatalf("%s：Copy 错误：%d %q", name, n, dest)
+		}
+		// ByteSlice 返回的是拷贝
+		b := v.ByteSlice()
+		b[0] = 'x'
+		if v.String() != "hello" {
+			t.Fatalf("%s：修改 ByteSlice 的返回值不应该影响缓存值", name)
+		}
+	}
+}
+
+func TestByteViewEqual(t *testing.T) {
+	for name, v := range byteViews("hello") {
+		for other, w := range byteViews("hello") {
+			if !v.Equal(w) {
+				t.Fatalf("%s 和 %s 应该相等", name, other)
+			}
+		}
+		for other, w := range byteViews("hellO") {
+			if v.Equal(w) {
+				t.Fatalf("%s 和 %s 不应该相等", name, other)
+			}
+		}
+		if !v.EqualString("hello") || v.EqualString("hell") {
+			t.Fatalf("%s：EqualString 错误", name)
+		}
+		if !v.EqualBytes([]byte("hello")) || v.EqualBytes([]byte("hello!")) {
+			t.Fatalf("%s：EqualBytes 错误", name)
+		}
+	}
+}
+
+func TestByteViewReader(t *testing.T) {
+	for name, v := range byteViews("hello") {
+		var buf bytes.Buffer
+		if n, err := v.WriteTo(&buf); n != 5 || err != nil || buf.String() != "hello" {
+			t.Fatalf("%s：WriteTo 错误：%d %v", name, n, err)
+		}
+		r := v.Reader()
+		r.Seek(1, io.SeekStart)
+		if b, _ := io.ReadAll(r); string(b) != "ello" {
+			t.Fatalf("%s：Reader 错误：%q", name, b)
+		}
+		p := make([]byte, 3)
+		if n, err := v.ReadAt(p, 3); n != 2 || err != io.EOF || string(p[:n]) != "lo" {
+			t.Fatalf("%s：ReadAt 错误：%d %v", name, n, err)
+		}
+	}
+}
+
+// 字符串形式的值同样可以压缩后写入缓存
+func TestByteViewStringCompression(t *testing.T) {
+	g := NewGroupOpts("byteview-compress", 4<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, nil
+	}), &GroupOptions{Compression: "gzip"})
+	v := g.encodeView(ByteView{s: jsonBlob})
+	if v.enc != "gzip" || v.s != "" {
+		t.Fatalf("应该压缩字符串形式的值")
+	}
+	if v, err := decodeView(v); err != nil || !v.EqualString(jsonBlob) {
+		t.Fatalf("解压后不一致：%v", err)
+	}
+}
@@ -2,25 +2,43 @@ package geecache
 
 import (
 	"geecache/lru"
+	"io"
 	"sync"
+	"time"
 )
 
 type cache struct {
 	mu         sync.Mutex
 	lru        *lru.Cache
 	cacheBytes int64
+	onEvicted  func(key string, value ByteView) // 缓存被淘汰时的回调，可以为 nil，调用时持有 mu
 }
 
 // 实现 Add 方法
 func (c *cache) Add(key string, value ByteView) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+	c.lazyInit()
+	// 替换分块存储的清单时删除旧的分块
+	if old, ok := c.lru.Get(key); ok && old.(ByteView).version != value.version {
+		c.removeChunks(key, old.(ByteView))
 	}
 	c.lru.Add(key, value)
 }
 
+// lazyInit 第一次写入时创建 lru.Cache，需要持有 c.mu
+func (c *cache) lazyInit() {
+	if c.lru != nil {
+		return
+	}
+	c.lru = lru.New(c.cacheBytes, func(key string, value lru.Value) {
+		c.removeChunks(key, value.(ByteView))
+		if c.onEvicted != nil {
+			c.onEvicted(key, value.(ByteView))
+		}
+	})
+}
+
 // 实现 Get 方法
 func (c *cache) Get(key string) (value ByteView, ok bool) {
 	c.mu.Lock()
@@ -29,7 +47,113 @@ func (c *cache) Get(key string) (value ByteView, ok bool) {
 		return
 	}
 	if v, ok := c.lru.Get(key); ok {
+		// 过期的值视为未命中，与淘汰一样从缓存中删除
+		if v.(ByteView).expired(time.Now()) {
+			c.lru.Remove(key)
+			c.removeChunks(key, v.(ByteView))
+			if c.onEvicted != nil {
+				c.onEvicted(key, v.(ByteView))
+			}
+			return ByteView{}, false
+		}
 		return v.(ByteView), ok
 	}
 	return
 }
+
+// 实现 Remove 方法，删除分块存储的清单时一并删除分块
+func (c *cache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return
+	}
+	if old, ok := c.lru.Get(key); ok {
+		c.removeChunks(key, old.(ByteView))
+	}
+	c.lru.Remove(key)
+}
+
+// stats 返回缓存占用的内存和条目数
+func (c *cache) stats() (bytes, items int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return 0, 0
+	}
+	return c.lru.Bytes(), int64(c.lru.Len())
+}
+
+// cacheEntry 缓存中的一个条目
+type cacheEntry struct {
+	key   string
+	value ByteView
+}
+
+// hottest 返回最近访问的最多 n 个未过期的条目，keep 返回 false 的条目不计入
+func (c *cache) hottest(n int, keep func(key string, value ByteView) bool) []cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil || n <= 0 {
+		return nil
+	}
+	now := time.Now()
+	var out []cacheEntry
+	c.lru.Range(func(key string, value lru.Value) bool {
+		v := value.(ByteView)
+		if !v.expired(now) && keep(key, v) {
+			out = append(out, cacheEntry{key: key, value: v})
+		}
+		return len(out) < n
+	})
+	return out
+}
+
+// snapshot 按访问顺序将未过期的条目写入 w；锁内只复制条目，编码和写入在锁外进行，
+// 避免写入较慢时阻塞缓存的读写
+func (c *cache) snapshot(w io.Writer, encode func(key string, value ByteView) []byte) (int, error) {
+	// 1.锁内按从最近访问到最久未访问的顺序复制未过期的条目，ByteView 不可修改，复制的是引用
+	type item struct {
+		key   string
+		value ByteView
+	}
+	var items []item
+	c.mu.Lock()
+	c.lazyInit()
+	now := time.Now()
+	c.lru.Range(func(key string, value lru.Value) bool {
+		if v := value.(ByteView); !v.expired(now) {
+			items = append(items, item{key, v})
+		}
+		return true
+	})
+	c.mu.Unlock()
+	// 2.锁外从旧到新编码并写入
+	entries := make([]lru.SnapshotEntry, 0, len(items))
+	for i := len(items) - 1; i >= 0; i-- {
+		entries = append(entries, lru.SnapshotEntry{Key: items[i].key, Data: encode(items[i].key, items[i].value)})
+	}
+	return lru.WriteSnapshot(w, entries)
+}
+
+// restore 读取 snapshot 写入的快照，跳过已经过期的条目；
+// 读取、校验和解码在锁外进行，只在加入缓存时持有锁，避免恢复较慢时阻塞缓存的读写
+func (c *cache) restore(r io.Reader, decode func(key string, data []byte) (ByteView, bool)) (int, error) {
+	// 1.锁外读取并校验，快照损坏时不修改缓存
+	entries, err := lru.ReadSnapshot(r)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	restored := make([]lru.RestoredEntry, 0, len(entries))
+	for _, e := range entries {
+		if v, ok := decode(e.Key, e.Data); ok && !v.expired(now) {
+			restored = append(restored, lru.RestoredEntry{Key: e.Key, Value: v})
+		}
+	}
+	// 2.锁内加入缓存
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lazyInit()
+	return c.lru.AddRestored(restored), nil
+}
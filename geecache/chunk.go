@@ -0,0 +1,321 @@
+package geecache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	pb "geecache/geecachepb"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 超过 ChunkSize 的值分块存储：每个分块是一个单独的缓存条目，
+// key 对应的条目只保存清单（总长度和分块数），任意分块被淘汰后整个值需要重新加载。
+// 分块的 key 带有清单的版本号，并发写入或重新加载时读取方不会拼接出两个版本的分块；
+// 清单被替换、删除、过期或淘汰时一并删除旧的分块。
+// 分块可以各自压缩，读取时逐块解压，大对象不需要一次性放进内存。
+
+// chunkPrefix 分块 key 的前缀，以 \x00 开头，不会与正常的 key 冲突
+const chunkPrefix = "\x00chunk\x00"
+
+// errChunkMissing 分块已经被淘汰
+var errChunkMissing = errors.New("分块已被淘汰")
+
+// StreamGetter 以流的形式返回源数据，Getter 同时实现该接口且配置了 ChunkSize 时，
+// 回源时边读取边分块写入缓存
+type StreamGetter interface {
+	GetStream(key string) (io.ReadCloser, error)
+}
+
+// StreamPeerGetter 以流的形式从远程节点获取值，调用方负责关闭返回的 io.ReadCloser
+type StreamPeerGetter interface {
+	GetStream(in *pb.Request) (io.ReadCloser, error)
+}
+
+func chunkKey(key string, version int64, i int) string {
+	return chunkPrefix + strconv.FormatInt(version, 10) + "\x00" + strconv.Itoa(i) + "\x00" + key
+}
+
+func isChunkKey(key string) bool {
+	return strings.HasPrefix(key, chunkPrefix)
+}
+
+// manifest 分块存储的清单
+type manifest struct {
+	size   int64 // 值的总长度
+	chunks int   // 分块数
+}
+
+func (m manifest) marshal() []byte {
+	buf := make([]byte, 0, 2*binary.MaxVarintLen64)
+	buf = binary.AppendUvarint(buf, uint64(m.size))
+	return binary.AppendUvarint(buf, uint64(m.chunks))
+}
+
+func unmarshalManifest(b []byte) (manifest, error) {
+	size, n := binary.Uvarint(b)
+	if n <= 0 {
+		return manifest{}, fmt.Errorf("分块清单格式错误")
+	}
+	chunks, m := binary.Uvarint(b[n:])
+	if m <= 0 {
+		return manifest{}, fmt.Errorf("分块清单格式错误")
+	}
+	return manifest{size: int64(size), chunks: int(chunks)}, nil
+}
+
+// store 将回调函数返回的值写入缓存，超过 ChunkSize 时分块存储，返回 key 对应的条目
+func (g *Group) store(key string, b []byte) ByteView {
+	if g.chunkSize > 0 && len(b) > g.chunkSize {
+		// 从内存中读取不会出错。返回完整的值，值超过缓存容量、分块被立即淘汰时调用方仍然可以拿到
+		m, _ := g.storeChunks(key, bytes.NewReader(b))
+		m.b, m.chunked = cloneBytes(b), false
+		return m
+	}
+	v := g.encodeView(g.newView(cloneBytes(b)))
+	g.populateGroup(key, v)
+	return v
+}
+
+// storeChunks 从 r 中逐块读取并写入缓存，最后写入清单；
+// 数据不超过一个分块时直接作为普通的值存储
+func (g *Group) storeChunks(key string, r io.Reader) (ByteView, error) {
+	var m manifest
+	version := time.Now().UnixNano() // 清单和分块使用相同的版本号
+	for {
+		buf := make([]byte, g.chunkSize)
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return ByteView{}, err
+		}
+		last := err == io.ErrUnexpectedEOF
+		if m.chunks == 0 && last {
+			v := g.encodeView(g.newView(buf[:n]))
+			g.populateGroup(key, v)
+			return v, nil
+		}
+		c := g.newView(buf[:n])
+		c.version = version
+		g.populateGroup(chunkKey(key, version, m.chunks), g.encodeView(c))
+		m.chunks++
+		m.size += int64(n)
+		if last {
+			break
+		}
+	}
+	v := g.newView(m.marshal())
+	v.version, v.chunked = version, true
+	g.populateGroup(key, v)
+	return v, nil
+}
+
+// removeChunks old 是分块存储的清单时删除对应的分块，需要持有 c.mu
+func (c *cache) removeChunks(key string, old ByteView) {
+	if !old.chunked {
+		return
+	}
+	m, err := unmarshalManifest(old.b)
+	if err != nil {
+		return
+	}
+	for i := 0; i < m.chunks; i++ {
+		c.lru.Remove(chunkKey(key, old.version, i))
+	}
+}
+
+// loadStream 使用 StreamGetter 回源，返回 false 表示 Getter 不支持流式读取
+func (g *Group) loadStream(key string) (ByteView, bool, error) {
+	sg, ok := g.getter.(StreamGetter)
+	if !ok || g.chunkSize <= 0 {
+		return ByteView{}, false, nil
+	}
+	var v ByteView
+	err := g.protect(func() error {
+		rc, err := sg.GetStream(key)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		v, err = g.storeChunks(key, rc)
+		return err
+	})
+	return v, true, err
+}
+
+// chunkReader 逐块读取并解压分块存储的值
+type chunkReader struct {
+	chunks []ByteView
+	cur    io.Reader
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur != nil {
+			// bytes.Reader 只会返回 io.EOF
+			if n, _ := r.cur.Read(p); n > 0 {
+				return n, nil
+			}
+			r.cur = nil
+		}
+		if len(r.chunks) == 0 {
+			return 0, io.EOF
+		}
+		v, err := decodeView(r.chunks[0])
+		if err != nil {
+			return 0, err
+		}
+		r.chunks = r.chunks[1:]
+		r.cur = bytes.NewReader(v.b)
+	}
+}
+
+// openView 返回读取缓存条目的 io.Reader 和值的总长度，分块已被淘汰时返回 errChunkMissing。
+// 返回前已经取出所有分块，ByteView 是只读的，之后的淘汰不影响读取
+func (g *Group) openView(key string, v ByteView) (io.Reader, int64, error) {
+	if !v.chunked {
+		v, err := decodeView(v)
+		if err != nil {
+			return nil, 0, err
+		}
+		return v.Reader(), int64(v.Len()), nil
+	}
+	m, err := unmarshalManifest(v.b)
+	if err != nil {
+		return nil, 0, err
+	}
+	chunks := make([]ByteView, m.chunks)
+	for i := range chunks {
+		c, ok := g.mainCache.Get(chunkKey(key, v.version, i))
+		if !ok {
+			return nil, 0, errChunkMissing
+		}
+		chunks[i] = c
+	}
+	return &chunkReader{chunks: chunks}, m.size, nil
+}
+
+// resolve 将缓存条目转换为完整的、未压缩的值，分块已被淘汰时删除清单并调用 reload 重新加载一次
+func (g *Group) resolve(key string, v ByteView, reload func() (ByteView, error)) (ByteView, error) {
+	for retried := false; ; retried = true {
+		if !v.chunked {
+			return decodeView(v)
+		}
+		r, size, err := g.openView(key, v)
+		if err == nil {
+			b := make([]byte, 0, size)
+			buf := bytes.NewBuffer(b)
+			if _, err = buf.ReadFrom(r); err != nil {
+				return ByteView{}, err
+			}
+			out := v
+			out.b, out.chunked = buf.Bytes(), false
+			return out, nil
+		}
+		if err == errChunkMissing && retried {
+			return ByteView{}, fmt.Errorf("%w，值可能超过了缓存容量", err)
+		}
+		if err != errChunkMissing {
+			return ByteView{}, err
+		}
+		// 清单已经被新的值替换时直接读取新的值，否则删除清单（连同剩余的分块）后重新加载
+		if cur, ok := g.mainCache.Get(key); ok && cur.version != v.version {
+			v = cur
+			continue
+		}
+		g.mainCache.Remove(key)
+		if v, err = reload(); err != nil {
+			return ByteView{}, err
+		}
+	}
+}
+
+// getForPeerFull 处理其他节点的请求，返回完整的、未压缩的值
+func (g *Group) getForPeerFull(key string) (ByteView, error) {
+	v, err := g.getForPeer(key)
+	if err != nil {
+		return ByteView{}, err
+	}
+	return g.resolve(key, v, func() (ByteView, error) { return g.getForPeer(key) })
+}
+
+// streamForPeer 以流的形式处理其他节点的请求，返回值的元信息、io.Reader 和总长度；
+// hot 为 true 时与 getHotForPeer 相同，自己作为副本时从所有者获取，而不是回源
+func (g *Group) streamForPeer(key string, hot bool) (ByteView, io.Reader, int64, error) {
+	get := g.getForPeer
+	if hot {
+		get = g.getHotForPeer
+	}
+	v, err := get(key)
+	if err != nil {
+		return ByteView{}, nil, 0, err
+	}
+	r, size, err := g.openView(key, v)
+	if err == errChunkMissing {
+		if v, err = g.getForPeerFull(key); err != nil {
+			return ByteView{}, nil, 0, err
+		}
+		r, size = v.Reader(), int64(v.Len())
+	}
+	return v, r, size, err
+}
+
+// GetStream 以流的形式返回 key 对应的值，调用方负责关闭返回的 io.ReadCloser。
+// 分块存储的值逐块读取，远程节点支持时直接转发远程节点的响应流，大对象不会被完整地复制
+func (g *Group) GetStream(key string) (io.ReadCloser, error) {
+	if key == "" {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	g.stats.gets.Add(1)
+	g.touch(key)
+	// 1.本地缓存命中
+	if v, ok := g.mainCache.Get(key); ok {
+		if r, _, err := g.openView(key, v); err == nil {
+			g.stats.cacheHits.Add(1)
+			return io.NopCloser(r), nil
+		}
+	}
+	// 2.远程节点支持流式读取时直接返回远程节点的响应流，失败时与 Get 一样回退到本地
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			if sp, ok := peer.(StreamPeerGetter); ok {
+				// 选择的节点可能是热点或同一可用区的副本，标记后副本未命中时从所有者获取
+				rc, err := sp.GetStream(&pb.Request{
+					Group:           []byte(g.name),
+					Key:             []byte(key),
+					ProtocolVersion: ProtocolVersion,
+					Hot:             g.isHot(key) || g.zoneReplicated(),
+				})
+				if err == nil {
+					g.stats.peerLoads.Add(1)
+					return rc, nil
+				}
+				g.stats.peerErrors.Add(1)
+				if errors.Is(err, ErrNotFound) {
+					return nil, err
+				}
+			}
+		}
+	}
+	// 3.通过 load 加载，分块存储的值逐块读取
+	v, err := g.load(key)
+	if err != nil {
+		return nil, err
+	}
+	r, _, err := g.openView(key, v)
+	if err == errChunkMissing {
+		if v, err = g.Get(key); err != nil {
+			return nil, err
+		}
+		r = v.Reader()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(r), nil
+}
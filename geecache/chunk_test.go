@@ -0,0 +1,169 @@
+package geecache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// streamSource 只支持流式读取的数据源
+type streamSource struct {
+	data    string
+	streams int32
+}
+
+func (s *streamSource) Get(key string) ([]byte, error) {
+	return nil, errors.New("配置了 ChunkSize 时不应该调用 Get")
+}
+
+func (s *streamSource) GetStream(key string) (io.ReadCloser, error) {
+	atomic.AddInt32(&s.streams, 1)
+	if key == "missing" {
+		return nil, fmt.Errorf("%s：%w", key, ErrNotFound)
+	}
+	return io.NopCloser(strings.NewReader(s.data)), nil
+}
+
+// readStream 读取 GetStream 返回的全部内容
+func readStream(rc io.ReadCloser, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	return string(b), err
+}
+
+// 测试大对象分块存储，Get 和 GetStream 都能读到完整的值
+func TestGroupChunks(t *testing.T) {
+	value := strings.Repeat("0123456789", 1050)
+	var calls int32
+	g := NewGroupOpts("chunk-group", 8<<10, GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		return []byte(value), nil
+	}), &GroupOptions{ChunkSize: 1000, Compression: "gzip", CompressThreshold: 500})
+
+	if v, err := g.Get("big"); err != nil || v.String() != value {
+		t.Fatalf("第一次获取的值错误：%v", err)
+	}
+	// 1.缓存中是清单和 11 个分块，每个分块单独压缩，8KB 的缓存可以放下 10KB 的值
+	m, _ := g.mainCache.Get("big")
+	if !m.chunked {
+		t.Fatalf("应该分块存储")
+	}
+	for i := 0; i < 11; i++ {
+		if c, ok := g.mainCache.Get(chunkKey("big", m.version, i)); !ok || c.enc != "gzip" {
+			t.Fatalf("分块 %d 不存在或没有压缩", i)
+		}
+	}
+	// 2.命中缓存
+	if v, err := g.Get("big"); err != nil || v.String() != value {
+		t.Fatalf("命中缓存时值错误：%v", err)
+	}
+	if got, err := readStream(g.GetStream("big")); err != nil || got != value {
+		t.Fatalf("GetStream 的值错误：%v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("应该只回源一次，实际 %d 次", calls)
+	}
+	// 3.分块被淘汰后重新加载
+	g.mainCache.Remove(chunkKey("big", m.version, 3))
+	if v, err := g.Get("big"); err != nil || v.String() != value || calls != 2 {
+		t.Fatalf("分块被淘汰后应该重新回源：%v，回源 %d 次", err, calls)
+	}
+}
+
+// 测试替换或删除分块存储的值时删除旧的分块，持有旧清单的读取方不会读到新的分块
+func TestGroupChunksReplaced(t *testing.T) {
+	g := newLocalGroup("chunk-replaced", nil, nil)
+	g.chunkSize = 100
+	first, second := strings.Repeat("a", 1000), strings.Repeat("b", 1000)
+	g.Set("big", []byte(first))
+	old, _ := g.mainCache.Get("big")
+	if _, items := g.mainCache.stats(); items != 11 {
+		t.Fatalf("期望清单和 10 个分块，实际 %d 个条目", items)
+	}
+
+	// 1.替换后只剩新的清单和分块
+	g.Set("big", []byte(second))
+	if _, items := g.mainCache.stats(); items != 11 {
+		t.Fatalf("旧的分块应该被删除，实际 %d 个条目", items)
+	}
+	// 2.旧的清单读不到新的分块，resolve 改为读取新的值
+	if _, _, err := g.openView("big", old); err != errChunkMissing {
+		t.Fatalf("旧的清单不应该读到新的分块：%v", err)
+	}
+	v, err := g.resolve("big", old, func() (ByteView, error) { return ByteView{}, errors.New("不应该重新加载") })
+	if err != nil || v.String() != second {
+		t.Fatalf("应该读取新的值：%v", err)
+	}
+
+	// 3.删除清单时一并删除分块
+	g.Remove("big")
+	if _, items := g.mainCache.stats(); items != 0 {
+		t.Fatalf("删除后不应该剩下分块，实际 %d 个条目", items)
+	}
+}
+
+// 测试值超过缓存容量时仍然返回完整的值
+func TestGroupChunksLargerThanCache(t *testing.T) {
+	value := strings.Repeat("x", 1000)
+	g := NewGroupOpts("chunk-overflow", 300, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(value), nil
+	}), &GroupOptions{ChunkSize: 100})
+	if v, err := g.Get("big"); err != nil || v.String() != value {
+		t.Fatalf("值超过缓存容量时应该返回完整的值：%v", err)
+	}
+}
+
+// 测试 StreamGetter 边读取边写入缓存
+func TestGroupStreamGetter(t *testing.T) {
+	src := &streamSource{data: strings.Repeat("abcdefghij", 30)}
+	g := NewGroupOpts("chunk-stream", 8<<10, src, &GroupOptions{ChunkSize: 64})
+	if got, err := readStream(g.GetStream("big")); err != nil || got != src.data {
+		t.Fatalf("GetStream 的值错误：%v", err)
+	}
+	if v, err := g.Get("big"); err != nil || v.String() != src.data {
+		t.Fatalf("Get 的值错误：%v", err)
+	}
+	if src.streams != 1 {
+		t.Fatalf("应该只读取一次数据源，实际 %d 次", src.streams)
+	}
+	// 不超过一个分块的值作为普通的值存储
+	src.data = "small"
+	if v, err := g.Get("small"); err != nil || v.String() != "small" {
+		t.Fatalf("小对象的值错误：%v", err)
+	}
+	if v, _ := g.mainCache.Get("small"); v.chunked {
+		t.Fatalf("小对象不应该分块存储")
+	}
+}
+
+// 测试通过 HTTP 以流的形式从远程节点获取分块存储的值
+func TestHTTPStream(t *testing.T) {
+	src := &streamSource{data: strings.Repeat("0123456789", 50)}
+	NewGroupOpts("chunk-http", 8<<10, src, &GroupOptions{ChunkSize: 64})
+	remote := httptest.NewServer(NewHTTPPool("remote"))
+	defer remote.Close()
+	peers := NewHTTPPool("local")
+	peers.Set(remote.URL)
+	g := newLocalGroup("chunk-http", GetterFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("不应该从本地回源")
+	}), peers)
+
+	if got, err := readStream(g.GetStream("big")); err != nil || got != src.data {
+		t.Fatalf("远程节点返回的流错误：%v", err)
+	}
+	// 非流式请求同样可以获取分块存储的值
+	if v, err := g.Get("big"); err != nil || v.String() != src.data {
+		t.Fatalf("Get 的值错误：%v", err)
+	}
+	// 错误码同样适用于流式请求
+	if _, err := g.GetStream("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("应该返回 NOT_FOUND，实际 %v", err)
+	}
+}
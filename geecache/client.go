@@ -0,0 +1,181 @@
+package geecache
+
+import (
+	"errors"
+	pb "geecache/geecachepb"
+	"sync"
+	"time"
+)
+
+// 只读写缓存集群的客户端：知道哈希环，直接访问 key 的所有者，
+// 自己不在哈希环中、不负责任何 key，也没有 mainCache 和 Getter，未命中由所有者回源。
+
+const (
+	defaultClientName       = "geecache-client"
+	defaultNearCacheTTL     = time.Second
+	defaultGetMultiParallel = 16
+)
+
+// ErrNoPeers 客户端还没有可用的节点
+var ErrNoPeers = errors.New("没有可用的节点")
+
+// ClientOptions 用于配置 Client，零值字段使用默认值
+type ClientOptions struct {
+	// Name 客户端的名称，用于日志和请求头，不能与任何节点地址相同，默认为 "geecache-client"
+	Name string
+	// Pool 节点间通信的配置，BasePath、Replicas、HashFn、TLS、HMAC 等必须与服务端一致
+	Pool *HTTPPoolOptions
+	// NearCacheBytes 每个 group 的本地近缓存大小，为 0 时不启用
+	NearCacheBytes int64
+	// NearCacheTTL 近缓存的有效期，其他客户端写入后最多在这段时间内读到旧值，默认为 1s
+	NearCacheTTL time.Duration
+	// GetMultiParallel GetMulti 同时发出的最大请求数，默认为 16
+	GetMultiParallel int
+}
+
+// Client 缓存集群的客户端，实现了 PeerPicker，可以通过 Set 或节点发现、gossip 更新节点
+type Client struct {
+	pool *HTTPPool
+	opts ClientOptions
+
+	mu     sync.Mutex
+	groups map[string]*ClientGroup
+}
+
+// NewClient 创建客户端，o 为 nil 时全部使用默认值，之后需要调用 Set 设置节点
+func NewClient(o *ClientOptions) *Client {
+	c := &Client{groups: make(map[string]*ClientGroup)}
+	if o != nil {
+		c.opts = *o
+	}
+	if c.opts.Name == "" {
+		c.opts.Name = defaultClientName
+	}
+	if c.opts.NearCacheTTL <= 0 {
+		c.opts.NearCacheTTL = defaultNearCacheTTL
+	}
+	if c.opts.GetMultiParallel <= 0 {
+		c.opts.GetMultiParallel = defaultGetMultiParallel
+	}
+	c.pool = NewHTTPPoolOpts(c.opts.Name, c.opts.Pool)
+	return c
+}
+
+// Set 更新缓存集群的节点，不包括客户端自己
+func (c *Client) Set(peers ...string) {
+	c.pool.Set(peers...)
+}
+
+// SetZones 设置节点所在的可用区，配合 HTTPPoolOptions.Zone 优先读取同一可用区的副本
+func (c *Client) SetZones(zones map[string]string) {
+	c.pool.SetZones(zones)
+}
+
+var _ PeerPicker = (*Client)(nil)
+
+// PickPeer 选择 key 所在的节点，客户端不在哈希环中，有节点时总是返回远程节点
+func (c *Client) PickPeer(key string) (PeerGetter, bool) {
+	return c.pool.PickPeer(key)
+}
+
+// Close 停止后台的健康检查
+func (c *Client) Close() error {
+	return c.pool.Close()
+}
+
+// Group 返回名为 name 的 group 的客户端，多次调用返回同一个对象
+func (c *Client) Group(name string) *ClientGroup {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if g, ok := c.groups[name]; ok {
+		return g
+	}
+	g := &ClientGroup{name: name, client: c}
+	if c.opts.NearCacheBytes > 0 {
+		g.near = &cache{cacheBytes: c.opts.NearCacheBytes}
+	}
+	c.groups[name] = g
+	return g
+}
+
+// ClientGroup 通过客户端读写一个 group，方法与 Group 相同
+type ClientGroup struct {
+	name   string
+	client *Client
+	near   *cache // 本地近缓存，未启用时为 nil
+}
+
+// ClientItem GetMulti 中一个 key 的结果
+type ClientItem struct {
+	Key   string
+	Value ByteView
+	Err   error
+}
+
+// Get 从 key 的所有者（或同一可用区的副本、热点副本）获取值，未命中时由所有者回源
+func (g *ClientGroup) Get(key string) (ByteView, error) {
+	if key == "" {
+		return ByteView{}, nil
+	}
+	pool := g.client.pool
+	pool.Touch(key)
+	// 1.近缓存
+	if g.near != nil {
+		if v, ok := g.near.Get(key); ok {
+			return v, nil
+		}
+	}
+	// 2.选择节点，客户端读取的可能是副本，标记后副本未命中时从所有者获取
+	peer, ok := g.client.PickPeer(key)
+	if !ok {
+		return ByteView{}, ErrNoPeers
+	}
+	v, err := fetchFromPeer(peer, g.name, key, pool.IsHot(key) || pool.ZoneReplicated())
+	if err != nil {
+		return ByteView{}, err
+	}
+	// 3.写入近缓存，有效期不超过值本身的过期时间
+	if g.near != nil && !v.stale {
+		nv := v
+		if e := time.Now().Add(g.client.opts.NearCacheTTL); nv.e.IsZero() || e.Before(nv.e) {
+			nv.e = e
+		}
+		g.near.Add(key, nv)
+	}
+	return v, nil
+}
+
+// GetMulti 并发获取多个 key，结果与 keys 一一对应，单个 key 失败不影响其他 key；
+// 同时发出的请求数不超过 GetMultiParallel
+func (g *ClientGroup) GetMulti(keys []string) []ClientItem {
+	items := make([]ClientItem, len(keys))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, g.client.opts.GetMultiParallel)
+	for i, key := range keys {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, key string) {
+			defer func() { <-sem; wg.Done() }()
+			v, err := g.Get(key)
+			items[i] = ClientItem{Key: key, Value: v, Err: err}
+		}(i, key)
+	}
+	wg.Wait()
+	return items
+}
+
+// Set 将值写入 key 的所有者的缓存，并删除本地近缓存中的旧值
+func (g *ClientGroup) Set(key string, value []byte) error {
+	if g.near != nil {
+		g.near.Remove(key)
+	}
+	peer, ok := g.client.pool.PickOwner(key)
+	if !ok {
+		return ErrNoPeers
+	}
+	pw, ok := peer.(PeerWriter)
+	if !ok {
+		return errors.New("节点不支持写入")
+	}
+	return pw.Set(&pb.SetRequest{Group: []byte(g.name), Key: []byte(key), Value: value})
+}
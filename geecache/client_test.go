@@ -0,0 +1,92 @@
+package geecache
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// 测试客户端直接访问所有者读写，不在本地回源
+func TestClient(t *testing.T) {
+	// 1.两个节点，同一个进程中共用注册的 group
+	group := NewGroup("client-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if key == "bad" {
+			return nil, fmt.Errorf("%s：%w", key, ErrNotFound)
+		}
+		return []byte("value-" + key), nil
+	}))
+	// 写入需要认证，客户端与节点使用相同的签名密钥
+	hmacOpts := &HMACOptions{Keys: testKeys, SignKeyID: "k1"}
+	var (
+		peers []string
+		pools []*HTTPPool
+	)
+	for i := 0; i < 2; i++ {
+		var pool *HTTPPool
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pool.ServeHTTP(w, r)
+		}))
+		defer srv.Close()
+		pool = NewHTTPPoolOpts(srv.URL, &HTTPPoolOptions{HMAC: hmacOpts})
+		peers = append(peers, srv.URL)
+		pools = append(pools, pool)
+	}
+	// 节点只接受自己负责的 key 的写入
+	for _, pool := range pools {
+		pool.Set(peers...)
+	}
+
+	// 2.没有节点时返回 ErrNoPeers
+	c := NewClient(&ClientOptions{Pool: &HTTPPoolOptions{HMAC: hmacOpts}, NearCacheBytes: 1 << 10, NearCacheTTL: time.Minute})
+	defer c.Close()
+	g := c.Group("client-scores")
+	if _, err := g.Get("Tom"); !errors.Is(err, ErrNoPeers) {
+		t.Fatalf("期望 ErrNoPeers，实际 %v", err)
+	}
+	if v, err := g.Get(""); err != nil || v.Len() != 0 {
+		t.Fatalf("空 key 应该直接返回空值，实际 %q，错误 %v", v.String(), err)
+	}
+	c.Set(peers...)
+	if c.Group("client-scores") != g {
+		t.Fatalf("相同名称应该返回同一个 ClientGroup")
+	}
+
+	// 3.第二次读取命中近缓存，不再访问节点
+	for i := 0; i < 2; i++ {
+		if v, err := g.Get("Tom"); err != nil || v.String() != "value-Tom" {
+			t.Fatalf("期望 value-Tom，实际 %q，错误 %v", v.String(), err)
+		}
+	}
+	if got := group.Stats().ServerRequests; got != 1 {
+		t.Fatalf("近缓存命中时不应该访问节点，实际 %d 次", got)
+	}
+
+	// 4.GetMulti 中单个 key 失败不影响其他 key
+	items := g.GetMulti([]string{"Jack", "bad", "Sam"})
+	if items[0].Value.String() != "value-Jack" || items[2].Value.String() != "value-Sam" || !errors.Is(items[1].Err, ErrNotFound) {
+		t.Fatalf("GetMulti 结果错误：%+v", items)
+	}
+	keys := make([]string, 2*defaultGetMultiParallel)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	for i, item := range g.GetMulti(keys) {
+		if item.Err != nil || item.Value.String() != "value-"+keys[i] {
+			t.Fatalf("GetMulti 结果错误：%+v", item)
+		}
+	}
+
+	// 5.写入所有者并删除近缓存中的旧值
+	if err := g.Set("Tom", []byte("630")); err != nil {
+		t.Fatalf("写入失败：%v", err)
+	}
+	if v, ok := group.mainCache.Get("Tom"); !ok || v.String() != "630" {
+		t.Fatalf("所有者的缓存应该被更新")
+	}
+	if v, err := g.Get("Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("期望 630，实际 %q，错误 %v", v.String(), err)
+	}
+}
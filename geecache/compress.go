@@ -0,0 +1,231 @@
+package geecache
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultCompressThreshold    = 1 << 10
+	defaultMaxDecompressedBytes = 64 << 20
+)
+
+// ErrDecompressedTooLarge 解压后的值超过 MaxDecompressedBytes，防止很小的压缩数据解压后耗尽内存
+var ErrDecompressedTooLarge = errors.New("解压后的值过大")
+
+// Compressor 压缩算法，Name 用于在节点间协商编码，需要在所有节点上注册相同名称的实现。
+// Decompress 的结果超过 MaxDecompressedBytes 时应该返回 ErrDecompressedTooLarge，而不是先全部解压
+type Compressor interface {
+	Name() string
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+var (
+	compressorsMu        sync.RWMutex
+	compressors                = make(map[string]Compressor)
+	maxDecompressedBytes int64 = defaultMaxDecompressedBytes
+)
+
+func init() {
+	RegisterCompressor(&gzipCompressor{})
+	RegisterCompressor(&flateCompressor{})
+}
+
+// RegisterCompressor 注册压缩算法，同名的算法会被替换，zstd 等第三方算法通过它接入
+func RegisterCompressor(c Compressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	compressors[c.Name()] = c
+}
+
+// SetMaxDecompressedBytes 设置解压后的值的大小上限，n 不大于 0 时恢复默认的 64MB
+func SetMaxDecompressedBytes(n int64) {
+	if n <= 0 {
+		n = defaultMaxDecompressedBytes
+	}
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	maxDecompressedBytes = n
+}
+
+// MaxDecompressedBytes 返回解压后的值的大小上限
+func MaxDecompressedBytes() int64 {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	return maxDecompressedBytes
+}
+
+// readDecompressed 从解压的 r 中读取全部内容，超过 MaxDecompressedBytes 时返回 ErrDecompressedTooLarge
+func readDecompressed(r io.Reader) ([]byte, error) {
+	limit := MaxDecompressedBytes()
+	b, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		return nil, ErrDecompressedTooLarge
+	}
+	return b, nil
+}
+
+// getCompressor 根据名称获取压缩算法
+func getCompressor(name string) (Compressor, bool) {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	c, ok := compressors[name]
+	return c, ok
+}
+
+// Compressors 返回已注册的压缩算法名称，按名称排序
+func Compressors() []string {
+	return compressorNames()
+}
+
+// compressorNames 返回已注册的压缩算法名称，请求其他节点时用于协商编码
+func compressorNames() []string {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	names := make([]string, 0, len(compressors))
+	for name := range compressors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// encodeView 按 Group 的配置压缩即将写入缓存的值，压缩后没有变小则保留原值
+func (g *Group) encodeView(v ByteView) ByteView {
+	if g.compressor == nil || v.enc != "" || v.Len() < g.compressThreshold {
+		return v
+	}
+	b, err := g.compressor.Compress(v.rawBytes())
+	if err != nil {
+		log.Printf("[Group %s] 压缩失败：%v", g.name, err)
+		return v
+	}
+	if len(b) >= v.Len() {
+		return v
+	}
+	v.b, v.s, v.enc = b, "", g.compressor.Name()
+	return v
+}
+
+// decodeView 解压缓存中的值，返回给调用方的值都经过解压
+func decodeView(v ByteView) (ByteView, error) {
+	if v.enc == "" {
+		return v, nil
+	}
+	c, ok := getCompressor(v.enc)
+	if !ok {
+		return ByteView{}, fmt.Errorf("未注册的压缩算法：%s", v.enc)
+	}
+	b, err := c.Decompress(v.b)
+	if err == nil && int64(len(b)) > MaxDecompressedBytes() {
+		err = ErrDecompressedTooLarge // 第三方的压缩算法可能没有限制解压后的大小
+	}
+	if err != nil {
+		return ByteView{}, fmt.Errorf("解压失败（%s）：%w", v.enc, err)
+	}
+	v.b, v.enc = b, ""
+	return v, nil
+}
+
+// acceptsEncoding 判断对方是否支持 enc 编码
+func acceptsEncoding(accept []string, enc string) bool {
+	for _, a := range accept {
+		if a == enc {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAcceptEncoding 解析 HTTP 的 Accept-Encoding 请求头，忽略 q 值
+func parseAcceptEncoding(header string) []string {
+	var names []string
+	for _, part := range strings.Split(header, ",") {
+		name, _, _ := strings.Cut(part, ";")
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// gzipCompressor 使用 gzip 压缩
+type gzipCompressor struct {
+	writers sync.Pool
+}
+
+func (c *gzipCompressor) Name() string { return "gzip" }
+
+func (c *gzipCompressor) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, ok := c.writers.Get().(*gzip.Writer)
+	if ok {
+		w.Reset(&buf)
+	} else {
+		w = gzip.NewWriter(&buf)
+	}
+	defer c.writers.Put(w)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *gzipCompressor) Decompress(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readDecompressed(r)
+}
+
+// flateCompressor 使用原始的 DEFLATE 格式（RFC 1951）压缩，
+// 不是 HTTP 的 deflate 编码（zlib 格式），因此名称为 flate
+type flateCompressor struct {
+	writers sync.Pool // flate.Writer 的内存开销较大，需要复用
+}
+
+func (c *flateCompressor) Name() string { return "flate" }
+
+func (c *flateCompressor) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, ok := c.writers.Get().(*flate.Writer)
+	if ok {
+		w.Reset(&buf)
+	} else {
+		var err error
+		if w, err = flate.NewWriter(&buf, flate.DefaultCompression); err != nil {
+			return nil, err
+		}
+	}
+	defer c.writers.Put(w)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *flateCompressor) Decompress(src []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+	return readDecompressed(r)
+}
@@ -0,0 +1,125 @@
+package geecache
+
+import (
+	"errors"
+	pb "geecache/geecachepb"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var jsonBlob = strings.Repeat(`{"name":"Tom","score":630,"tags":["a","b","c"]},`, 100)
+
+func TestCompressorRoundTrip(t *testing.T) {
+	for _, name := range []string{"gzip", "flate"} {
+		c, ok := getCompressor(name)
+		if !ok {
+			t.Fatalf("%s 应该已经注册", name)
+		}
+		// 复用 writer 后结果仍然正确
+		for i := 0; i < 2; i++ {
+			b, err := c.Compress([]byte(jsonBlob))
+			if err != nil || len(b) >= len(jsonBlob)/5 {
+				t.Fatalf("%s 压缩失败：%d 字节 %v", name, len(b), err)
+			}
+			if out, err := c.Decompress(b); err != nil || string(out) != jsonBlob {
+				t.Fatalf("%s 解压后不一致：%v", name, err)
+			}
+		}
+	}
+}
+
+// 测试解压后超过上限时返回错误，不会全部解压
+func TestMaxDecompressedBytes(t *testing.T) {
+	SetMaxDecompressedBytes(int64(len(jsonBlob) - 1))
+	defer SetMaxDecompressedBytes(0)
+	for _, name := range []string{"gzip", "flate"} {
+		c, _ := getCompressor(name)
+		b, err := c.Compress([]byte(jsonBlob))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Decompress(b); !errors.Is(err, ErrDecompressedTooLarge) {
+			t.Fatalf("%s 期望 ErrDecompressedTooLarge，实际 %v", name, err)
+		}
+		if _, err := decodeView(ByteView{b: b, enc: name}); !errors.Is(err, ErrDecompressedTooLarge) {
+			t.Fatalf("%s 期望 ErrDecompressedTooLarge，实际 %v", name, err)
+		}
+	}
+}
+
+// 测试写入缓存时压缩，返回给调用方时解压，小于阈值的值不压缩
+func TestGroupCompression(t *testing.T) {
+	g := NewGroupOpts("compress-group", 4<<10, GetterFunc(func(key string) ([]byte, error) {
+		if key == "small" {
+			return []byte("tiny"), nil
+		}
+		return []byte(jsonBlob), nil
+	}), &GroupOptions{Compression: "gzip"})
+
+	for i := 0; i < 2; i++ { // 第二次命中缓存
+		v, err := g.Get("big")
+		if err != nil || v.String() != jsonBlob {
+			t.Fatalf("第 %d 次获取的值错误：%v", i+1, err)
+		}
+	}
+	if stored, _ := g.mainCache.Get("big"); stored.enc != "gzip" || stored.Len() >= len(jsonBlob)/5 {
+		t.Fatalf("缓存中的值应该被压缩，实际 %q %d 字节", stored.enc, stored.Len())
+	}
+	// 4KB 的缓存放不下未压缩的值
+	if st := g.Stats(); st.CacheBytes >= 4<<10 || st.CacheItems != 1 {
+		t.Fatalf("统计信息错误：%+v", st)
+	}
+
+	g.Get("small")
+	if stored, _ := g.mainCache.Get("small"); stored.enc != "" {
+		t.Fatalf("小于阈值的值不应该压缩")
+	}
+}
+
+// 测试对方支持时原样返回压缩过的值，不支持时解压后返回
+func TestPeerCompressionNegotiation(t *testing.T) {
+	NewGroupOpts("compress-peer", 4<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(jsonBlob), nil
+	}), &GroupOptions{Compression: "flate"})
+	remote := httptest.NewServer(NewHTTPPool("remote"))
+	defer remote.Close()
+	peers := NewHTTPPool("local")
+	peers.Set(remote.URL)
+	peer := mustPick(t, peers, "Tom")
+
+	// 1.支持 flate，收到的是压缩后的值
+	res := &pb.Response{}
+	req := &pb.Request{Group: []byte("compress-peer"), Key: []byte("Tom"), AcceptEncoding: []string{"gzip", "flate"}}
+	if err := peer.Get(req, res); err != nil {
+		t.Fatal(err)
+	}
+	if res.GetContentEncoding() != "flate" || len(res.GetValue()) >= len(jsonBlob)/5 {
+		t.Fatalf("应该返回压缩后的值，实际 %q %d 字节", res.GetContentEncoding(), len(res.GetValue()))
+	}
+
+	// 2.不支持压缩的旧节点收到解压后的值
+	res = &pb.Response{}
+	if err := peer.Get(&pb.Request{Group: []byte("compress-peer"), Key: []byte("Tom")}, res); err != nil {
+		t.Fatal(err)
+	}
+	if res.GetContentEncoding() != "" || string(res.GetValue()) != jsonBlob {
+		t.Fatalf("不支持压缩时应该返回原值")
+	}
+
+	// 3.getFromPeer 返回解压后的值
+	g := newLocalGroup("compress-peer", GetterFunc(func(key string) ([]byte, error) {
+		return nil, nil
+	}), peers)
+	if v, err := g.getFromPeer(peer, "Tom"); err != nil || v.String() != jsonBlob {
+		t.Fatalf("getFromPeer 应该解压：%v", err)
+	}
+}
+
+func TestParseAcceptEncoding(t *testing.T) {
+	got := parseAcceptEncoding("gzip;q=1.0, deflate ,, br;q=0")
+	if want := []string{"gzip", "deflate", "br"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("解析结果错误：%v", got)
+	}
+}
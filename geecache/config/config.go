@@ -0,0 +1,219 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"geecache"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// 配置文件使用 JSON 格式，示例：
+//
+//	{
+//	  "self": "http://localhost:8001",
+//	  "peers": ["http://localhost:8001", "http://localhost:8002"],
+//	  "zones": {"http://localhost:8001": "zone-a", "http://localhost:8002": "zone-b"},
+//	  "groups": [{"name": "scores", "cache_bytes": 2048, "ttl": "30s"}],
+//	  "pool": {"replicas": 50, "timeout": "5s"}
+//	}
+//
+// peers、zones 和新增的 group 可以热加载，其他字段修改后需要重启才能生效。
+
+// Duration 支持 "1m30s" 形式的字符串或纳秒数
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(b, &n); err != nil {
+			return fmt.Errorf("时间格式错误：%s", b)
+		}
+		*d = Duration(n)
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Config 节点配置
+type Config struct {
+	// Self 本节点地址，必须出现在 Peers 中
+	Self string `json:"self"`
+	// Peers 全部节点地址，包括自己
+	Peers []string `json:"peers"`
+	// Zones 节点所在的可用区，可以只标记一部分节点
+	Zones map[string]string `json:"zones,omitempty"`
+	// Groups 需要创建的 Group
+	Groups []GroupConfig `json:"groups"`
+	// Pool 节点间通信的配置
+	Pool PoolConfig `json:"pool"`
+}
+
+// GroupConfig Group 的配置，字段含义与 geecache.GroupOptions 相同
+type GroupConfig struct {
+	Name               string   `json:"name"`
+	CacheBytes         int64    `json:"cache_bytes"`
+	TTL                Duration `json:"ttl,omitempty"`
+	Compression        string   `json:"compression,omitempty"`
+	CompressThreshold  int      `json:"compress_threshold,omitempty"`
+	ChunkSize          int      `json:"chunk_size,omitempty"`
+	MaxConcurrentLoads int      `json:"max_concurrent_loads,omitempty"`
+	MaxQueuedLoads     int      `json:"max_queued_loads,omitempty"`
+	QueueTimeout       Duration `json:"queue_timeout,omitempty"`
+	LoadRate           float64  `json:"load_rate,omitempty"`
+	LoadBurst          int      `json:"load_burst,omitempty"`
+	StaleCacheBytes    int64    `json:"stale_cache_bytes,omitempty"`
+}
+
+// Options 转换为 geecache.GroupOptions
+func (g GroupConfig) Options() *geecache.GroupOptions {
+	return &geecache.GroupOptions{
+		TTL:                time.Duration(g.TTL),
+		Compression:        g.Compression,
+		CompressThreshold:  g.CompressThreshold,
+		ChunkSize:          g.ChunkSize,
+		MaxConcurrentLoads: g.MaxConcurrentLoads,
+		MaxQueuedLoads:     g.MaxQueuedLoads,
+		QueueTimeout:       time.Duration(g.QueueTimeout),
+		LoadRate:           g.LoadRate,
+		LoadBurst:          g.LoadBurst,
+		StaleCacheBytes:    g.StaleCacheBytes,
+	}
+}
+
+// PoolConfig HTTPPool 的配置，字段含义与 geecache.HTTPPoolOptions 相同
+type PoolConfig struct {
+	BasePath         string   `json:"base_path,omitempty"`
+	Replicas         int      `json:"replicas,omitempty"`
+	DialTimeout      Duration `json:"dial_timeout,omitempty"`
+	Timeout          Duration `json:"timeout,omitempty"`
+	MaxResponseBytes int64    `json:"max_response_bytes,omitempty"`
+	MaxKeyLength     int      `json:"max_key_length,omitempty"`
+	RebalanceWindow  Duration `json:"rebalance_window,omitempty"`
+	ZoneReplicas     int      `json:"zone_replicas,omitempty"`
+}
+
+// Options 转换为 geecache.HTTPPoolOptions
+func (p PoolConfig) Options() *geecache.HTTPPoolOptions {
+	return &geecache.HTTPPoolOptions{
+		BasePath:         p.BasePath,
+		Replicas:         p.Replicas,
+		DialTimeout:      time.Duration(p.DialTimeout),
+		Timeout:          time.Duration(p.Timeout),
+		MaxResponseBytes: p.MaxResponseBytes,
+		MaxKeyLength:     p.MaxKeyLength,
+		RebalanceWindow:  time.Duration(p.RebalanceWindow),
+		ZoneReplicas:     p.ZoneReplicas,
+	}
+}
+
+// Load 读取并校验配置文件，不允许出现未知的字段
+func Load(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse 解析并校验配置
+func Parse(b []byte) (*Config, error) {
+	c := &Config{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return nil, fmt.Errorf("解析配置失败：%v", err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate 校验配置，返回第一个错误
+func (c *Config) Validate() error {
+	// 1.节点地址
+	if c.Self == "" {
+		return errors.New("self 不能为空")
+	}
+	seen := make(map[string]bool, len(c.Peers))
+	for _, peer := range c.Peers {
+		u, err := url.Parse(peer)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("节点地址 %q 格式错误，应该为 http://host:port 或 https://host:port", peer)
+		}
+		if seen[peer] {
+			return fmt.Errorf("节点地址 %q 重复", peer)
+		}
+		seen[peer] = true
+	}
+	if !seen[c.Self] {
+		return fmt.Errorf("self %q 不在 peers 中", c.Self)
+	}
+	for peer := range c.Zones {
+		if !seen[peer] {
+			return fmt.Errorf("zones 中的节点 %q 不在 peers 中", peer)
+		}
+	}
+	// 2.Group
+	names := make(map[string]bool, len(c.Groups))
+	for _, g := range c.Groups {
+		if g.Name == "" {
+			return errors.New("group 的 name 不能为空")
+		}
+		if names[g.Name] {
+			return fmt.Errorf("group %q 重复", g.Name)
+		}
+		names[g.Name] = true
+		if g.CacheBytes <= 0 {
+			return fmt.Errorf("group %q 的 cache_bytes 必须大于 0", g.Name)
+		}
+		if g.Compression != "" && !contains(geecache.Compressors(), g.Compression) {
+			return fmt.Errorf("group %q 的压缩算法 %q 未注册，可选：%s", g.Name, g.Compression, strings.Join(geecache.Compressors(), "、"))
+		}
+		if g.TTL < 0 || g.ChunkSize < 0 || g.CompressThreshold < 0 {
+			return fmt.Errorf("group %q 的 ttl、chunk_size、compress_threshold 不能为负数", g.Name)
+		}
+	}
+	// 3.节点间通信
+	if c.Pool.BasePath != "" && (!strings.HasPrefix(c.Pool.BasePath, "/") || !strings.HasSuffix(c.Pool.BasePath, "/")) {
+		return fmt.Errorf("base_path %q 必须以 / 开头和结尾", c.Pool.BasePath)
+	}
+	if c.Pool.Replicas < 0 || c.Pool.Timeout < 0 || c.Pool.DialTimeout < 0 || c.Pool.ZoneReplicas < 0 {
+		return errors.New("pool 的 replicas、timeout、dial_timeout、zone_replicas 不能为负数")
+	}
+	return nil
+}
+
+// group 根据名称查找 Group 的配置
+func (c *Config) group(name string) (GroupConfig, bool) {
+	for _, g := range c.Groups {
+		if g.Name == name {
+			return g, true
+		}
+	}
+	return GroupConfig{}, false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
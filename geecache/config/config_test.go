@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"geecache"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const validConfig = `{
+	"self": "http://localhost:8001",
+	"peers": ["http://localhost:8001", "http://localhost:8002"],
+	"groups": [{"name": "config-scores", "cache_bytes": 2048, "ttl": "30s", "compression": "gzip"}],
+	"pool": {"replicas": 10, "timeout": "5s"}
+}`
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte(validConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := c.Groups[0].Options(); o.TTL != 30*time.Second || o.Compression != "gzip" {
+		t.Fatalf("group 的配置错误：%+v", o)
+	}
+	if o := c.Pool.Options(); o.Replicas != 10 || o.Timeout != 5*time.Second {
+		t.Fatalf("pool 的配置错误：%+v", o)
+	}
+
+	invalid := map[string]string{
+		"未知字段":     `{"self": "http://a:1", "peers": ["http://a:1"], "unknown": 1}`,
+		"self 为空":  `{"peers": ["http://a:1"]}`,
+		"self 不存在": `{"self": "http://b:1", "peers": ["http://a:1"]}`,
+		"地址错误":     `{"self": "a:1", "peers": ["a:1"]}`,
+		"重复节点":     `{"self": "http://a:1", "peers": ["http://a:1", "http://a:1"]}`,
+		"重复 group": `{"self": "http://a:1", "peers": ["http://a:1"], "groups": [{"name": "g", "cache_bytes": 1}, {"name": "g", "cache_bytes": 1}]}`,
+		"缓存大小":     `{"self": "http://a:1", "peers": ["http://a:1"], "groups": [{"name": "g"}]}`,
+		"压缩算法":     `{"self": "http://a:1", "peers": ["http://a:1"], "groups": [{"name": "g", "cache_bytes": 1, "compression": "zstd"}]}`,
+		"时间格式":     `{"self": "http://a:1", "peers": ["http://a:1"], "pool": {"timeout": "5 秒"}}`,
+		"可用区节点":    `{"self": "http://a:1", "peers": ["http://a:1"], "zones": {"http://b:1": "z"}}`,
+	}
+	for name, s := range invalid {
+		if _, err := Parse([]byte(s)); err == nil {
+			t.Fatalf("%s：应该返回错误", name)
+		}
+	}
+}
+
+// fakePool 记录每次 Set 传入的节点和 SetZones 传入的可用区
+type fakePool struct {
+	mu    sync.Mutex
+	sets  [][]string
+	zones []map[string]string
+}
+
+func (p *fakePool) SetZones(zones map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.zones = append(p.zones, zones)
+}
+
+func (p *fakePool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sets = append(p.sets, peers)
+}
+
+func (p *fakePool) calls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.sets)
+}
+
+func writeConfig(t *testing.T, path, s string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(s), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geecache.json")
+	writeConfig(t, path, strings.ReplaceAll(validConfig, "config-scores", "reload-scores"))
+	pool := &fakePool{}
+	getter := func(group string) geecache.Getter {
+		return geecache.GetterFunc(func(key string) ([]byte, error) {
+			return []byte(group + ":" + key), nil
+		})
+	}
+	w, err := Watch(path, WatcherOptions{Peers: pool, Getter: getter, PollInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if pool.calls() != 1 || w.Group("reload-scores") == nil {
+		t.Fatalf("第一次加载应该设置节点并创建 group")
+	}
+
+	// 1.内容没有变化时不重新应用
+	if err := w.Reload(); err != nil || pool.calls() != 1 {
+		t.Fatalf("内容没有变化时不应该调用 Set：%v", err)
+	}
+
+	// 2.不合法的配置被拒绝，保留原来的配置
+	writeConfig(t, path, `{"self": "http://localhost:8001", "peers": []}`)
+	if err := w.Reload(); err == nil {
+		t.Fatalf("不合法的配置应该被拒绝")
+	}
+	if len(w.Config().Peers) != 2 || pool.calls() != 1 {
+		t.Fatalf("被拒绝时应该保留原来的配置")
+	}
+
+	// 3.修改 self 需要重启
+	writeConfig(t, path, strings.ReplaceAll(validConfig, `"self": "http://localhost:8001"`, `"self": "http://localhost:8002"`))
+	if err := w.Reload(); err == nil {
+		t.Fatalf("修改 self 应该被拒绝")
+	}
+
+	// 4.节点和 group 的变化被应用
+	writeConfig(t, path, `{
+		"self": "http://localhost:8001",
+		"peers": ["http://localhost:8001", "http://localhost:8002", "http://localhost:8003"],
+		"zones": {"http://localhost:8001": "a", "http://localhost:8003": "b"},
+		"groups": [
+			{"name": "reload-scores", "cache_bytes": 2048, "ttl": "30s", "compression": "gzip"},
+			{"name": "reload-names", "cache_bytes": 1024}
+		],
+		"pool": {"replicas": 10, "timeout": "5s"}
+	}`)
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if pool.calls() != 2 || len(pool.sets[1]) != 3 {
+		t.Fatalf("节点变化后应该调用 Set：%v", pool.sets)
+	}
+	if len(pool.zones) != 2 || pool.zones[1]["http://localhost:8003"] != "b" {
+		t.Fatalf("可用区变化后应该调用 SetZones：%v", pool.zones)
+	}
+	if v, err := w.Group("reload-names").Get("Tom"); err != nil || v.String() != "reload-names:Tom" {
+		t.Fatalf("新增的 group 错误：%v", err)
+	}
+}
+
+// 测试文件变化时自动重新加载
+func TestWatcherPoll(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geecache.json")
+	writeConfig(t, path, `{"self": "http://a:1", "peers": ["http://a:1"]}`)
+	reloads := make(chan error, 10)
+	pool := &fakePool{}
+	w, err := Watch(path, WatcherOptions{
+		Peers:        pool,
+		PollInterval: 10 * time.Millisecond,
+		OnReload:     func(c *Config, err error) { reloads <- err },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	<-reloads // 第一次加载
+
+	for i, peers := range []string{`"http://a:1", "http://b:1"`, `"http://a:1", "http://c:1"`} {
+		// 确保修改时间发生变化
+		time.Sleep(20 * time.Millisecond)
+		writeConfig(t, path, fmt.Sprintf(`{"self": "http://a:1", "peers": [%s]}`, peers))
+		select {
+		case err := <-reloads:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("第 %d 次修改后没有重新加载", i+1)
+		}
+	}
+	if want := []string{"http://a:1", "http://c:1"}; !reflect.DeepEqual(pool.sets[len(pool.sets)-1], want) {
+		t.Fatalf("节点应该为 %v，实际 %v", want, pool.sets)
+	}
+}
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"geecache"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultPollInterval = 2 * time.Second
+
+// ZoneSetter 接收节点所在的可用区，HTTPPool 实现了该接口
+type ZoneSetter interface {
+	SetZones(zones map[string]string)
+}
+
+// WatcherOptions 用于配置 Watcher
+type WatcherOptions struct {
+	// Peers 配置中的节点变化时调用 Set，同时实现了 ZoneSetter 时可用区变化后调用 SetZones，可以为 nil
+	Peers geecache.PeerSetter
+	// Picker 注册到新创建的 Group，可以为 nil
+	Picker geecache.PeerPicker
+	// Getter 返回 group 的回调函数，创建配置中的 Group 时调用，为 nil 时不创建 Group
+	Getter func(group string) geecache.Getter
+	// PollInterval 检查配置文件是否变化的间隔，默认为 2s，为负数时不检查
+	PollInterval time.Duration
+	// SIGHUP 收到 SIGHUP 信号时重新加载
+	SIGHUP bool
+	// OnReload 每次重新加载后的回调，err 不为 nil 表示新的配置被拒绝，可以为 nil
+	OnReload func(c *Config, err error)
+}
+
+// Watcher 加载配置文件，并在文件变化或收到 SIGHUP 时重新加载。
+// 新的配置校验失败时被拒绝，继续使用原来的配置
+type Watcher struct {
+	path string
+	opts WatcherOptions
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	cur     *Config
+	raw     []byte // 当前配置文件的内容，内容没有变化时不重新加载
+	modTime time.Time
+	groups  map[string]*geecache.Group
+}
+
+// Watch 加载配置文件并应用，然后开始监听变化；第一次加载失败时返回错误
+func Watch(path string, o WatcherOptions) (*Watcher, error) {
+	if o.PollInterval == 0 {
+		o.PollInterval = defaultPollInterval
+	}
+	w := &Watcher{path: path, opts: o, done: make(chan struct{}), groups: make(map[string]*geecache.Group)}
+	if err := w.Reload(); err != nil {
+		return nil, err
+	}
+	if o.PollInterval > 0 {
+		w.wg.Add(1)
+		go w.pollLoop()
+	}
+	if o.SIGHUP {
+		w.wg.Add(1)
+		go w.signalLoop()
+	}
+	return w, nil
+}
+
+// Log 打印日志
+func (w *Watcher) Log(format string, v ...interface{}) {
+	log.Printf("[Config %s] %s", w.path, fmt.Sprintf(format, v...))
+}
+
+// Config 返回当前生效的配置，调用方不能修改
+func (w *Watcher) Config() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.cur
+}
+
+// Group 返回根据配置创建的 Group
+func (w *Watcher) Group(name string) *geecache.Group {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.groups[name]
+}
+
+// Close 停止监听
+func (w *Watcher) Close() {
+	select {
+	case <-w.done:
+	default:
+		close(w.done)
+	}
+	w.wg.Wait()
+}
+
+// Reload 重新读取配置文件并应用变化的部分，新的配置不合法时返回错误并保留原来的配置
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	c, changed, err := w.reload()
+	w.mu.Unlock()
+	if err != nil {
+		w.Log("拒绝新的配置：%v", err)
+	}
+	if (changed || err != nil) && w.opts.OnReload != nil {
+		w.opts.OnReload(c, err)
+	}
+	return err
+}
+
+// reload 需要持有 w.mu，返回生效的配置和是否发生了变化
+func (w *Watcher) reload() (*Config, bool, error) {
+	// 1.读取并校验，内容没有变化时直接返回
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return w.cur, false, err
+	}
+	raw, err := os.ReadFile(w.path)
+	if err != nil {
+		return w.cur, false, err
+	}
+	w.modTime = info.ModTime()
+	if w.cur != nil && bytes.Equal(raw, w.raw) {
+		return w.cur, false, nil
+	}
+	c, err := Parse(raw)
+	if err != nil {
+		return w.cur, false, err
+	}
+	// 2.检查不能热加载的修改，全部检查通过后再应用，避免只应用了一部分
+	if w.cur != nil {
+		if c.Self != w.cur.Self {
+			return w.cur, false, fmt.Errorf("self 从 %q 修改为 %q，需要重启", w.cur.Self, c.Self)
+		}
+		if c.Pool != w.cur.Pool {
+			w.Log("pool 的配置发生了变化，需要重启才能生效")
+		}
+		for _, g := range w.cur.Groups {
+			if ng, ok := c.group(g.Name); !ok {
+				w.Log("group %q 已从配置中删除，需要重启才能生效", g.Name)
+			} else if ng != g {
+				w.Log("group %q 的配置发生了变化，需要重启才能生效", g.Name)
+			}
+		}
+	}
+	var added []GroupConfig
+	for _, g := range c.Groups {
+		if w.groups[g.Name] != nil || w.opts.Getter == nil {
+			continue
+		}
+		if geecache.GetGroup(g.Name) != nil {
+			return w.cur, false, fmt.Errorf("group %q 已经存在", g.Name)
+		}
+		if w.opts.Getter(g.Name) == nil {
+			return w.cur, false, fmt.Errorf("group %q 没有对应的回调函数", g.Name)
+		}
+		added = append(added, g)
+	}
+	// 3.应用：创建新的 Group，节点变化时调用 Set，Set 只为新节点创建客户端
+	for _, g := range added {
+		group := geecache.NewGroupOpts(g.Name, g.CacheBytes, w.opts.Getter(g.Name), g.Options())
+		if w.opts.Picker != nil {
+			group.RegisterPeers(w.opts.Picker)
+		}
+		w.groups[g.Name] = group
+		if w.cur != nil {
+			w.Log("创建 group %q", g.Name)
+		}
+	}
+	if w.opts.Peers != nil && (w.cur == nil || !samePeers(c.Peers, w.cur.Peers)) {
+		w.opts.Peers.Set(c.Peers...)
+		if w.cur != nil {
+			w.Log("节点更新为 %v", c.Peers)
+		}
+	}
+	if zs, ok := w.opts.Peers.(ZoneSetter); ok && (w.cur == nil || !reflect.DeepEqual(c.Zones, w.cur.Zones)) {
+		zs.SetZones(c.Zones)
+		if w.cur != nil {
+			w.Log("可用区更新为 %v", c.Zones)
+		}
+	}
+	w.cur, w.raw = c, raw
+	return c, true, nil
+}
+
+// samePeers 判断两组节点是否相同，不考虑顺序
+func samePeers(a, b []string) bool {
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return reflect.DeepEqual(a, b)
+}
+
+// pollLoop 定期检查配置文件的修改时间
+func (w *Watcher) pollLoop() {
+	defer w.wg.Done()
+	t := time.NewTicker(w.opts.PollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-t.C:
+		}
+		info, err := os.Stat(w.path)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				w.Log("读取配置文件失败：%v", err)
+			}
+			continue
+		}
+		w.mu.Lock()
+		modified := !info.ModTime().Equal(w.modTime)
+		w.mu.Unlock()
+		if modified {
+			w.Reload()
+		}
+	}
+}
+
+// signalLoop 收到 SIGHUP 时重新加载
+func (w *Watcher) signalLoop() {
+	defer w.wg.Done()
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	defer signal.Stop(ch)
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ch:
+			w.Log("收到 SIGHUP，重新加载配置")
+			w.Reload()
+		}
+	}
+}
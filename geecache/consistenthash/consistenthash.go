@@ -66,3 +66,59 @@ func (m *Map) Get(key string) string {
 	// 4.通过 hashMap 得到虚拟节点对应的真实节点
 	return m.hashMap[m.keys[idx%len(m.keys)]]
 }
+
+// 6.实现 GetN 方法，沿哈希环顺时针返回最多 n 个不同的真实节点，第一个即为 Get 返回的节点
+// 用于选择副本节点，例如对冲请求时选择备用节点
+func (m *Map) GetN(key string, n int) []string {
+	if len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	seen := make(map[string]bool, n)
+	nodes := make([]string, 0, n)
+	// 最多遍历一圈
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// 7.实现 GetNSpread 方法，与 GetN 相同但尽量让节点分布在不同的区域（如可用区、机架）：
+// 先沿哈希环选择区域尚未出现过的节点，不足 n 个时再按顺序补充其他节点，第一个节点仍然是 Get 返回的节点
+func (m *Map) GetNSpread(key string, n int, zoneOf func(node string) string) []string {
+	all := m.GetN(key, len(m.hashMap))
+	if len(all) <= n {
+		return all
+	}
+	nodes := make([]string, 0, n)
+	picked := make(map[string]bool, n)
+	zones := make(map[string]bool, n)
+	// 1.每个区域先选择一个节点
+	for _, node := range all {
+		if len(nodes) == n {
+			return nodes
+		}
+		if zone := zoneOf(node); !zones[zone] {
+			zones[zone] = true
+			picked[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	// 2.区域数少于 n 时按哈希环的顺序补充
+	for _, node := range all {
+		if len(nodes) == n {
+			break
+		}
+		if !picked[node] {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
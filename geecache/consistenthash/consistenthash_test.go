@@ -1,6 +1,7 @@
 package consistenthash
 
 import (
+	"reflect"
 	"strconv"
 	"testing"
 )
@@ -32,3 +33,49 @@ func TestHashing(t *testing.T) {
 		}
 	}
 }
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		num, _ := strconv.Atoi(string(key))
+		return uint32(num)
+	})
+	// 虚拟节点 02/04/06/12/14/16/22/24/26
+	hash.Add("2", "4", "6")
+	// "11" 顺时针依次经过 12(2)、14(4)、16(6)
+	if got := hash.GetN("11", 2); !reflect.DeepEqual(got, []string{"2", "4"}) {
+		t.Errorf("GetN(11, 2) = %v", got)
+	}
+	// n 超过真实节点数时只返回全部真实节点
+	if got := hash.GetN("25", 5); !reflect.DeepEqual(got, []string{"6", "2", "4"}) {
+		t.Errorf("GetN(25, 5) = %v", got)
+	}
+	if got := hash.GetN("25", 1); got[0] != hash.Get("25") {
+		t.Errorf("GetN 的第一个节点应该与 Get 一致")
+	}
+}
+
+func TestGetNSpread(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		num, _ := strconv.Atoi(string(key))
+		return uint32(num)
+	})
+	// 虚拟节点 02/04/06/08/12/14/16/18/22/24/26/28，2、4 在区域 a，6、8 在区域 b
+	hash.Add("2", "4", "6", "8")
+	zoneOf := func(node string) string {
+		if node == "2" || node == "4" {
+			return "a"
+		}
+		return "b"
+	}
+	// "11" 顺时针依次经过 12(2)、14(4)、16(6)、18(8)，跳过同一区域的 4
+	if got := hash.GetNSpread("11", 2, zoneOf); !reflect.DeepEqual(got, []string{"2", "6"}) {
+		t.Errorf("GetNSpread(11, 2) = %v", got)
+	}
+	// 区域数不足时按顺序补充
+	if got := hash.GetNSpread("11", 3, zoneOf); !reflect.DeepEqual(got, []string{"2", "6", "4"}) {
+		t.Errorf("GetNSpread(11, 3) = %v", got)
+	}
+	if got := hash.GetNSpread("11", 9, zoneOf); len(got) != 4 {
+		t.Errorf("GetNSpread(11, 9) = %v", got)
+	}
+}
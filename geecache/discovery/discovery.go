@@ -0,0 +1,136 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geecache"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultInterval = 5 * time.Second
+
+// Discovery 节点发现，每当节点集合变化时将完整的节点列表发送到返回的 channel，
+// ctx 取消后关闭 channel
+type Discovery interface {
+	Watch(ctx context.Context) (<-chan []string, error)
+}
+
+// Run 将 d 发现的节点写入 peers，直到 ctx 取消或 d 关闭 channel
+func Run(ctx context.Context, d Discovery, peers geecache.PeerSetter) error {
+	ch, err := d.Watch(ctx)
+	if err != nil {
+		return err
+	}
+	for list := range ch {
+		log.Printf("[Discovery] 节点更新为 %v", list)
+		peers.Set(list...)
+	}
+	return ctx.Err()
+}
+
+// normalize 去重并排序，便于比较两次的结果
+func normalize(peers []string) []string {
+	seen := make(map[string]bool, len(peers))
+	out := make([]string, 0, len(peers))
+	for _, p := range peers {
+		if p != "" && !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// poll 每隔 interval 调用一次 fetch，结果变化时发送到 channel。
+// fetch 出错或返回空列表（如文件正在被写入）时保留上一次的结果
+func poll(ctx context.Context, name string, interval time.Duration, fetch func(ctx context.Context) ([]string, error)) <-chan []string {
+	ch := make(chan []string, 1)
+	go func() {
+		defer close(ch)
+		var last []string
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			peers, err := fetch(ctx)
+			if err == nil && len(normalize(peers)) == 0 {
+				err = errors.New("没有发现任何节点")
+			}
+			if err != nil {
+				log.Printf("[Discovery %s] %v，继续使用上一次的节点", name, err)
+			} else if peers = normalize(peers); last == nil || !equal(peers, last) {
+				last = peers
+				select {
+				case ch <- peers:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+	return ch
+}
+
+// Static 固定的节点列表
+type Static []string
+
+// Watch 发送一次节点列表，ctx 取消后关闭 channel
+func (s Static) Watch(ctx context.Context) (<-chan []string, error) {
+	ch := make(chan []string, 1)
+	ch <- normalize(s)
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// Parse 根据描述创建 Discovery，scheme 为节点地址使用的协议，如 http：
+//
+//	static://http://a:8001,http://b:8001  固定的节点列表
+//	file:///etc/geecache/peers            文件中每行一个节点
+//	dns+srv://_geecache._tcp.example.com  SRV 记录
+//	dns://cache.example.com:8001          A/AAAA 记录加上固定的端口
+func Parse(spec, scheme string) (Discovery, error) {
+	i := strings.Index(spec, "://")
+	if i < 0 {
+		return nil, fmt.Errorf("节点发现 %q 格式错误", spec)
+	}
+	kind, rest := spec[:i], spec[i+3:]
+	switch kind {
+	case "static":
+		return Static(strings.Split(rest, ",")), nil
+	case "file":
+		return &File{Path: rest}, nil
+	case "dns+srv":
+		return &DNS{SRV: rest, Scheme: scheme}, nil
+	case "dns":
+		j := strings.LastIndex(rest, ":")
+		if j < 0 {
+			return nil, fmt.Errorf("节点发现 %q 缺少端口", spec)
+		}
+		return &DNS{Host: rest[:j], Port: rest[j+1:], Scheme: scheme}, nil
+	}
+	return nil, fmt.Errorf("不支持的节点发现方式：%q", kind)
+}
@@ -0,0 +1,176 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// next 从 channel 中读取一次节点列表
+func next(t *testing.T, ch <-chan []string) []string {
+	t.Helper()
+	select {
+	case peers, ok := <-ch:
+		if !ok {
+			t.Fatalf("channel 已关闭")
+		}
+		return peers
+	case <-time.After(2 * time.Second):
+		t.Fatalf("没有收到节点更新")
+	}
+	return nil
+}
+
+func TestStatic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, _ := Static{"http://b", "http://a", "http://a"}.Watch(ctx)
+	if got := next(t, ch); !reflect.DeepEqual(got, []string{"http://a", "http://b"}) {
+		t.Fatalf("应该去重并排序：%v", got)
+	}
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Fatalf("ctx 取消后应该关闭 channel")
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers")
+	os.WriteFile(path, []byte("# 节点列表\nhttp://a:8001\n\nhttp://b:8001\n"), 0o644)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := (&File{Path: path, Interval: 10 * time.Millisecond}).Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := next(t, ch); !reflect.DeepEqual(got, []string{"http://a:8001", "http://b:8001"}) {
+		t.Fatalf("节点错误：%v", got)
+	}
+	// 文件被删除时保留上一次的结果，恢复后发送新的节点
+	os.Remove(path)
+	time.Sleep(30 * time.Millisecond)
+	os.WriteFile(path, []byte("http://c:8001\n"), 0o644)
+	if got := next(t, ch); !reflect.DeepEqual(got, []string{"http://c:8001"}) {
+		t.Fatalf("节点错误：%v", got)
+	}
+
+	if _, err := (&File{Path: filepath.Join(t.TempDir(), "missing")}).Watch(ctx); err == nil {
+		t.Fatalf("文件不存在时应该返回错误")
+	}
+}
+
+// fakeResolver 返回预先设置的 DNS 记录
+type fakeResolver struct {
+	mu    sync.Mutex
+	srvs  []*net.SRV
+	hosts []string
+	err   error
+}
+
+func (r *fakeResolver) set(srvs []*net.SRV, hosts []string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.srvs, r.hosts, r.err = srvs, hosts, err
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return name, r.srvs, r.err
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.hosts, r.err
+}
+
+func TestDNSSRV(t *testing.T) {
+	r := &fakeResolver{}
+	r.set([]*net.SRV{{Target: "node1.example.com.", Port: 8001}, {Target: "node2.example.com.", Port: 8002}}, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := (&DNS{SRV: "_geecache._tcp.example.com", Resolver: r, Interval: 10 * time.Millisecond}).Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"http://node1.example.com:8001", "http://node2.example.com:8002"}
+	if got := next(t, ch); !reflect.DeepEqual(got, want) {
+		t.Fatalf("节点错误：%v", got)
+	}
+	// 查询失败时保留上一次的结果，不发送空列表
+	r.set(nil, nil, errors.New("SERVFAIL"))
+	time.Sleep(30 * time.Millisecond)
+	r.set([]*net.SRV{{Target: "node1.example.com.", Port: 8001}}, nil, nil)
+	if got := next(t, ch); !reflect.DeepEqual(got, want[:1]) {
+		t.Fatalf("节点错误：%v", got)
+	}
+}
+
+func TestDNSHost(t *testing.T) {
+	r := &fakeResolver{}
+	r.set(nil, []string{"10.0.0.2", "10.0.0.1", "fd00::1"}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := (&DNS{Host: "cache.example.com", Port: "8001", Scheme: "https", Resolver: r}).Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://10.0.0.1:8001", "https://10.0.0.2:8001", "https://[fd00::1]:8001"}
+	if got := next(t, ch); !reflect.DeepEqual(got, want) {
+		t.Fatalf("节点错误：%v", got)
+	}
+
+	r.set(nil, nil, errors.New("NXDOMAIN"))
+	if _, err := (&DNS{Host: "cache.example.com", Port: "8001", Resolver: r}).Watch(ctx); err == nil {
+		t.Fatalf("第一次查询失败时应该返回错误")
+	}
+}
+
+// recordPool 记录 Set 传入的节点
+type recordPool struct {
+	mu    sync.Mutex
+	peers []string
+}
+
+func (p *recordPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.peers = peers
+}
+
+func TestRunAndParse(t *testing.T) {
+	d, err := Parse("static://http://a:8001,http://b:8001", "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := &recordPool{}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := Run(ctx, d, pool); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ctx 取消后应该返回：%v", err)
+	}
+	if !reflect.DeepEqual(pool.peers, []string{"http://a:8001", "http://b:8001"}) {
+		t.Fatalf("节点错误：%v", pool.peers)
+	}
+
+	if d, err := Parse("dns://cache.example.com:8001", "https"); err != nil || d.(*DNS).Port != "8001" || d.(*DNS).Scheme != "https" {
+		t.Fatalf("解析 dns 错误：%+v %v", d, err)
+	}
+	if d, err := Parse("dns+srv://_geecache._tcp.example.com", "http"); err != nil || d.(*DNS).SRV != "_geecache._tcp.example.com" {
+		t.Fatalf("解析 dns+srv 错误：%+v %v", d, err)
+	}
+	if d, err := Parse("file:///etc/geecache/peers", "http"); err != nil || d.(*File).Path != "/etc/geecache/peers" {
+		t.Fatalf("解析 file 错误：%+v %v", d, err)
+	}
+	for _, spec := range []string{"consul://x", "dns://no-port", "peers"} {
+		if _, err := Parse(spec, "http"); err == nil {
+			t.Fatalf("%s 应该返回错误", spec)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resolver DNS 查询接口，*net.Resolver 实现了该接口，测试时可以替换
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// DNS 通过 DNS 记录发现节点：设置 SRV 时查询 SRV 记录，节点地址为 target:port；
+// 否则查询 Host 的 A/AAAA 记录，节点地址为 ip:Port
+type DNS struct {
+	// SRV 完整的 SRV 记录名，如 _geecache._tcp.example.com
+	SRV string
+	// Host 和 Port 查询 A/AAAA 记录时使用
+	Host string
+	Port string
+	// Scheme 节点地址的协议，默认为 http
+	Scheme string
+	// Interval 查询的间隔，默认为 5s
+	Interval time.Duration
+	// Timeout 单次查询的超时时间，默认为 2s
+	Timeout time.Duration
+	// Resolver 默认为 net.DefaultResolver
+	Resolver Resolver
+}
+
+// Watch 开始定期查询，第一次查询失败时返回错误
+func (d *DNS) Watch(ctx context.Context) (<-chan []string, error) {
+	if d.SRV == "" && (d.Host == "" || d.Port == "") {
+		return nil, errors.New("DNS 节点发现需要设置 SRV，或者 Host 和 Port")
+	}
+	if _, err := d.lookup(ctx); err != nil {
+		return nil, err
+	}
+	interval := d.Interval
+	if interval == 0 {
+		interval = defaultInterval
+	}
+	name := d.SRV
+	if name == "" {
+		name = d.Host
+	}
+	return poll(ctx, name, interval, d.lookup), nil
+}
+
+// lookup 查询一次 DNS 记录，返回节点地址
+func (d *DNS) lookup(ctx context.Context) ([]string, error) {
+	r := d.Resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	scheme := d.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	timeout := d.Timeout
+	if timeout == 0 {
+		timeout = 2 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// 1.SRV 记录，service 和 proto 已经包含在名称中
+	if d.SRV != "" {
+		_, srvs, err := r.LookupSRV(ctx, "", "", d.SRV)
+		if err != nil {
+			return nil, err
+		}
+		peers := make([]string, 0, len(srvs))
+		for _, srv := range srvs {
+			host := strings.TrimSuffix(srv.Target, ".")
+			peers = append(peers, scheme+"://"+net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))
+		}
+		return peers, nil
+	}
+	// 2.A/AAAA 记录
+	addrs, err := r.LookupHost(ctx, d.Host)
+	if err != nil {
+		return nil, err
+	}
+	peers := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		peers = append(peers, scheme+"://"+net.JoinHostPort(addr, d.Port))
+	}
+	return peers, nil
+}
@@ -0,0 +1,49 @@
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"time"
+)
+
+// File 从文件中读取节点，每行一个地址，忽略空行和 # 开头的注释；
+// 定期检查文件，内容变化时发送新的节点列表，适合 docker-compose 等挂载文件的场景
+type File struct {
+	Path string
+	// Interval 检查文件的间隔，默认为 5s
+	Interval time.Duration
+}
+
+// Watch 开始监听文件，第一次读取失败时返回错误
+func (f *File) Watch(ctx context.Context) (<-chan []string, error) {
+	if _, err := f.read(); err != nil {
+		return nil, err
+	}
+	interval := f.Interval
+	if interval == 0 {
+		interval = defaultInterval
+	}
+	return poll(ctx, f.Path, interval, func(context.Context) ([]string, error) {
+		return f.read()
+	}), nil
+}
+
+func (f *File) read() ([]string, error) {
+	b, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	var peers []string
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		peers = append(peers, line)
+	}
+	return peers, s.Err()
+}
@@ -1,10 +1,14 @@
 package geecache
 
 import (
+	"errors"
+	"geecache/breaker"
 	pb "geecache/geecachepb"
+	"geecache/limiter"
 	"geecache/singleflight"
 	"log"
 	"sync"
+	"time"
 )
 
 // Getter 接口
@@ -26,8 +30,50 @@ type Group struct {
 	name      string              // 唯一的名称
 	getter    Getter              // 缓存未命中时的回调
 	mainCache cache               // 并发缓存
+	hotCache  cache               // 热点 key 的副本，自己不是所有者，值未压缩、不分块，容量为 cacheBytes/8，不计入 cacheBytes
 	peers     PeerPicker          // 分布式节点
 	loader    *singleflight.Group // 防止缓存击穿
+	// 处理其他节点请求时使用独立的 singleflight，避免与正在转发给其他节点的 load 互相等待
+	peerLoader *singleflight.Group
+
+	// 回源保护，均可以为 nil
+	bulkhead   *limiter.Bulkhead    // 限制同时回源的数量
+	rate       *limiter.TokenBucket // 限制回源的速率
+	breaker    *breaker.Breaker     // 回调函数错误率过高时快速失败
+	staleCache *cache               // 保存被淘汰的缓存，回源被拒绝时返回旧值
+
+	ttl   time.Duration // 缓存的有效期，为 0 表示不过期
+	stats groupStats    // 统计信息
+
+	compressor        Compressor // 写入缓存时使用的压缩算法，为 nil 表示不压缩
+	compressThreshold int        // 超过该长度的值才压缩
+	chunkSize         int        // 超过该长度的值分块存储，为 0 表示不分块
+}
+
+// GroupOptions 用于配置 Group，零值字段表示不启用对应的功能
+type GroupOptions struct {
+	// MaxConcurrentLoads 同时调用回调函数的最大数量
+	MaxConcurrentLoads int
+	// MaxQueuedLoads 回源名额用完时最多排队等待的数量，超出的请求直接失败
+	MaxQueuedLoads int
+	// QueueTimeout 排队等待回源的最长时间，为 0 表示一直等待
+	QueueTimeout time.Duration
+	// LoadRate 每秒最多调用回调函数的次数
+	LoadRate float64
+	// LoadBurst 令牌桶的容量，即允许的突发回源次数，默认为 1
+	LoadBurst int
+	// Breaker 回调函数的熔断器配置，错误率过高时不再调用回调函数
+	Breaker *breaker.Options
+	// StaleCacheBytes 保存被淘汰缓存的最大内存，回源被熔断或限流时返回这里的旧值
+	StaleCacheBytes int64
+	// TTL 缓存的有效期，过期后重新回源，其他节点也会收到过期时间
+	TTL time.Duration
+	// Compression 写入缓存时使用的压缩算法名称，如 gzip、flate，必须已经通过 RegisterCompressor 注册
+	Compression string
+	// CompressThreshold 长度不小于该值的缓存值才压缩，默认为 1024 字节
+	CompressThreshold int
+	// ChunkSize 超过该长度的值拆分为多个缓存条目存储，Getter 实现了 StreamGetter 时边读取边写入
+	ChunkSize int
 }
 
 // 全局变量
@@ -36,8 +82,14 @@ var (
 	groups = make(map[string]*Group)
 )
 
-// 构造函数，用于实例化 Group
+// 构造函数，用于实例化 Group。cacheBytes 为本地缓存的容量，
+// 启用热点 key 或按可用区保存副本时，副本另外最多占用 cacheBytes/8
 func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+	return NewGroupOpts(name, cacheBytes, getter, nil)
+}
+
+// NewGroupOpts 使用自定义配置实例化 Group，o 为 nil 时与 NewGroup 相同
+func NewGroupOpts(name string, cacheBytes int64, getter Getter, o *GroupOptions) *Group {
 	// 1.判断是否传入回调函数
 	if getter == nil {
 		panic("nil Getter")
@@ -47,10 +99,15 @@ func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
 	defer mu.Unlock() // 延迟释放：在 return 之后，函数退出之前
 	// 构造 Group
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		loader:    &singleflight.Group{},
+		name:       name,
+		getter:     getter,
+		mainCache:  cache{cacheBytes: cacheBytes},
+		hotCache:   cache{cacheBytes: cacheBytes / 8},
+		loader:     &singleflight.Group{},
+		peerLoader: &singleflight.Group{},
+	}
+	if o != nil {
+		g.applyOptions(o)
 	}
 	groups[name] = g
 	return g
@@ -71,14 +128,27 @@ func (g *Group) Get(key string) (ByteView, error) {
 	if key == "" {
 		return ByteView{}, nil
 	}
+	g.stats.gets.Add(1)
+	g.touch(key)
 	// 2.判断情况（1）
 	if v, ok := g.mainCache.Get(key); ok {
 		// 缓存命中
+		g.stats.cacheHits.Add(1)
 		log.Println("缓存命中")
+		return g.resolve(key, v, func() (ByteView, error) { return g.load(key) })
+	}
+	// 热点 key 的副本，保存的是完整的值
+	if v, ok := g.hotCache.Get(key); ok {
+		g.stats.cacheHits.Add(1)
 		return v, nil
 	}
 	// 缓存未命中
-	return g.load(key)
+	v, err := g.load(key)
+	if err != nil {
+		return ByteView{}, err
+	}
+	// 分块存储的值在这里拼接为完整的值
+	return g.resolve(key, v, func() (ByteView, error) { return g.load(key) })
 }
 
 // 第一版
@@ -112,11 +182,25 @@ func (g *Group) load(key string) (value ByteView, err error) {
 		if g.peers != nil {
 			// 1.2.使用 PickPeer 选择节点
 			if peer, ok := g.peers.PickPeer(key); ok {
-				// 1.3.尝试根据远程节点获取缓存值
-				if value, err = g.getFromPeer(peer, key); err == nil {
+				// 1.3.尝试根据远程节点获取缓存值，热点 key 保存一份副本；
+				// 选择的节点可能是副本，标记后副本未命中时从所有者获取
+				hot := g.isHot(key)
+				if value, err = g.getFromPeerHot(peer, key, hot || g.zoneReplicated()); err == nil {
 					// 1.4.返回从远程获取的节点
+					g.stats.peerLoads.Add(1)
+					if hot {
+						g.addReplica(key, value)
+					}
 					return value, nil
 				}
+				g.stats.peerErrors.Add(1)
+				// 远程节点已经确认数据源中不存在该 key，不需要再从本地回源
+				if errors.Is(err, ErrNotFound) {
+					return nil, err
+				}
+			} else if value, ok := g.getFromOwner(key); ok {
+				// 热点 key 选择了自己作为副本，从所有者获取
+				return value, nil
 			}
 		}
 		// 1.5.是本机节点或从远程节点获取失败则调用 getLocally 方法
@@ -129,16 +213,51 @@ func (g *Group) load(key string) (value ByteView, err error) {
 	return
 }
 
+// getForPeer 处理来自其他节点的请求：只查找本地缓存或调用回调函数，不再转发给其他节点
+func (g *Group) getForPeer(key string) (ByteView, error) {
+	g.stats.serverRequests.Add(1)
+	if v, ok := g.mainCache.Get(key); ok {
+		return v, nil
+	}
+	view, err := g.peerLoader.Do(key, func() (interface{}, error) {
+		return g.getLocally(key)
+	})
+	if err != nil {
+		return ByteView{}, err
+	}
+	return view.(ByteView), nil
+}
+
 func (g *Group) getLocally(key string) (ByteView, error) {
+	// 节点变化后的过渡期内，先从之前的所有者的缓存中预热
+	if v, ok := g.getFromPrevious(key); ok {
+		return v, nil
+	}
+	// Getter 支持流式读取时边读取边分块写入缓存
+	if value, ok, err := g.loadStream(key); ok {
+		if err != nil {
+			g.stats.localLoadErrs.Add(1)
+			if v, ok := g.getStale(key, err); ok {
+				return v, nil
+			}
+			return ByteView{}, err
+		}
+		g.stats.localLoads.Add(1)
+		return value, nil
+	}
 	// 调用回调函数获取源数据
-	bytes, err := g.getter.Get(key)
+	bytes, err := g.callGetter(key)
 	if err != nil {
+		g.stats.localLoadErrs.Add(1)
+		// 回源被保护机制拒绝时尝试返回旧值
+		if v, ok := g.getStale(key, err); ok {
+			return v, nil
+		}
 		return ByteView{}, err
 	}
-	// 调用缓存克隆方法，封装数据
-	value := ByteView{cloneBytes(bytes)}
-	g.populateGroup(key, value)
-	return value, nil
+	// 调用缓存克隆方法，封装数据，按配置压缩、分块后写入缓存
+	g.stats.localLoads.Add(1)
+	return g.store(key, bytes), nil
 }
 
 // 将数据添加到缓存
@@ -146,8 +265,30 @@ func (g *Group) populateGroup(key string, value ByteView) {
 	g.mainCache.Add(key, value)
 }
 
+// newView 封装新写入缓存的值，设置版本号和过期时间
+func (g *Group) newView(b []byte) ByteView {
+	now := time.Now()
+	v := ByteView{b: b, version: now.UnixNano()}
+	if g.ttl > 0 {
+		v.e = now.Add(g.ttl)
+	}
+	return v
+}
+
+// Set 将 key 对应的值写入本地缓存，不会通知其他节点
+func (g *Group) Set(key string, value []byte) {
+	g.hotCache.Remove(key)
+	g.store(key, value)
+}
+
+// Remove 从本地缓存中删除 key，不会通知其他节点
+func (g *Group) Remove(key string) {
+	g.mainCache.Remove(key)
+	g.hotCache.Remove(key)
+}
+
 // 将实现了 PeerPicker 的 HTTPPool 注入到 Group 中
-func (g Group) RegisterPeers(peers PeerPicker) {
+func (g *Group) RegisterPeers(peers PeerPicker) {
 	if g.peers != nil {
 		panic("RegisterPeers 多次调用")
 	}
@@ -166,11 +307,24 @@ func (g Group) RegisterPeers(peers PeerPicker) {
 
 // 引入 protobuf
 // 使用实现了 PeerGetter 接口的 httpGetter 访问远程节点，获取缓存值
-func (g Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+	return g.getFromPeerHot(peer, key, false)
+}
+
+// getFromPeerHot hot 为 true 时在请求中标记热点，收到请求的副本节点未命中时从所有者获取
+func (g *Group) getFromPeerHot(peer PeerGetter, key string, hot bool) (ByteView, error) {
+	return fetchFromPeer(peer, g.name, key, hot)
+}
+
+// fetchFromPeer 从远程节点获取 group 中 key 对应的值，Group 和 ClientGroup 共用
+func fetchFromPeer(peer PeerGetter, group, key string, hot bool) (ByteView, error) {
 	// 1.初始化 请求、响应参数
 	req := &pb.Request{
-		Group: g.name,
-		Key:   key,
+		Group:           []byte(group),
+		Key:             []byte(key),
+		ProtocolVersion: ProtocolVersion,
+		AcceptEncoding:  compressorNames(),
+		Hot:             hot,
 	}
 	res := &pb.Response{}
 	// 2.调用 Get 方法
@@ -178,6 +332,14 @@ func (g Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
 	if err != nil {
 		return ByteView{}, err
 	}
-	// 3.返回
-	return ByteView{res.Value}, nil
+	// 3.检查错误码，旧版本的服务端不设置错误码，默认为 OK
+	if err = responseError(res); err != nil {
+		return ByteView{}, err
+	}
+	// 4.返回，带上过期时间、版本号等信息，压缩过的值在这里解压
+	view := viewFromResponse(res)
+	if view.stale {
+		log.Printf("[Group %s] 节点 %s 返回旧值 %s", group, res.GetServerId(), key)
+	}
+	return decodeView(view)
 }
@@ -3,6 +3,6 @@ module geecache
 go 1.21
 
 require (
-	github.com/golang/protobuf v1.5.3 // indirect
-	google.golang.org/protobuf v1.31.0 // indirect
+	github.com/golang/protobuf v1.5.3
+	google.golang.org/protobuf v1.31.0
 )
@@ -0,0 +1,701 @@
+package gossip
+
+import (
+	"errors"
+	"fmt"
+	"geecache"
+	"log"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 基于 SWIM 协议的集群成员管理：
+// 1.每个探测周期选择一个成员发送 ping，超时后请其他 k 个成员代为探测（ping-req），
+//   仍然没有收到 ack 则将其标记为疑似（suspect）；
+// 2.疑似成员在 SuspicionTimeout 内没有反驳（以更大的 incarnation 广播 alive）则标记为下线（dead）；
+// 3.成员变化通过 ping、ack 捎带以及定期的 gossip 消息在集群中传播，每条消息只重传有限次数；
+// 4.主动离开时向所有成员广播 left，其他成员立即将其移出哈希环。
+
+const (
+	defaultProbeInterval    = time.Second
+	defaultProbeTimeout     = 300 * time.Millisecond
+	defaultIndirectChecks   = 3
+	defaultSuspicionTimeout = 5 * time.Second
+	defaultGossipInterval   = 200 * time.Millisecond
+	defaultGossipNodes      = 3
+	defaultRetransmitMult   = 4
+	defaultJoinTimeout      = 2 * time.Second
+
+	maxPacketSize = 64 << 10 // UDP 报文的最大长度
+	maxPiggyback  = 8        // 每条消息最多捎带的成员变化数
+)
+
+// ErrJoinFailed 所有种子节点都没有响应
+var ErrJoinFailed = errors.New("加入集群失败：种子节点没有响应")
+
+// State 成员状态
+type State int
+
+const (
+	StateAlive   State = iota // 存活
+	StateSuspect              // 疑似下线，仍然在哈希环中
+	StateDead                 // 探测失败，已下线
+	StateLeft                 // 主动离开
+)
+
+func (s State) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	case StateDead:
+		return "dead"
+	case StateLeft:
+		return "left"
+	}
+	return "unknown"
+}
+
+// Member 集群成员
+type Member struct {
+	Name        string `json:"name"`  // 唯一的节点名称
+	Addr        string `json:"addr"`  // gossip 地址 host:port
+	Meta        string `json:"meta"`  // 缓存节点地址，如 http://localhost:8001
+	State       State  `json:"state"` // 成员状态
+	Incarnation uint64 `json:"inc"`   // 成员自己维护的版本号，用于反驳疑似、下线消息
+}
+
+// Options 用于配置 Membership，零值字段使用默认值
+type Options struct {
+	// Name 节点名称，默认为 gossip 地址
+	Name string
+	// Meta 缓存节点地址，写入 Peers 的就是各个成员的 Meta，默认为 gossip 地址
+	Meta string
+	// BindAddr gossip 监听的 UDP 地址，如 127.0.0.1:0
+	BindAddr string
+	// AdvertiseAddr 告知其他成员的 gossip 地址，默认为实际监听的地址
+	AdvertiseAddr string
+	// Seeds 种子节点的 gossip 地址，集群中只有自己时会定期尝试加入
+	Seeds []string
+	// Peers 成员变化时以全部存活成员（包括自己）的 Meta 调用 Set，可以为 nil
+	Peers geecache.PeerSetter
+	// OnChange 成员变化时的回调，参数为全部存活和疑似的成员，可以为 nil
+	OnChange func(members []Member)
+
+	// ProbeInterval 探测周期
+	ProbeInterval time.Duration
+	// ProbeTimeout 等待 ack 的超时时间，超时后发起间接探测，必须小于 ProbeInterval
+	ProbeTimeout time.Duration
+	// IndirectChecks 间接探测的成员数
+	IndirectChecks int
+	// SuspicionTimeout 疑似成员在该时间内没有反驳则标记为下线
+	SuspicionTimeout time.Duration
+	// GossipInterval 主动发送 gossip 消息的间隔
+	GossipInterval time.Duration
+	// GossipNodes 每次发送 gossip 消息的成员数
+	GossipNodes int
+	// RetransmitMult 每条成员变化重传 RetransmitMult * ceil(log10(n+1)) 次
+	RetransmitMult int
+	// JoinTimeout Join 等待种子节点响应的超时时间
+	JoinTimeout time.Duration
+}
+
+// fillDefaults 填充默认配置
+func (o *Options) fillDefaults() {
+	if o.ProbeInterval == 0 {
+		o.ProbeInterval = defaultProbeInterval
+	}
+	if o.ProbeTimeout == 0 {
+		o.ProbeTimeout = defaultProbeTimeout
+	}
+	if o.IndirectChecks == 0 {
+		o.IndirectChecks = defaultIndirectChecks
+	}
+	if o.SuspicionTimeout == 0 {
+		o.SuspicionTimeout = defaultSuspicionTimeout
+	}
+	if o.GossipInterval == 0 {
+		o.GossipInterval = defaultGossipInterval
+	}
+	if o.GossipNodes == 0 {
+		o.GossipNodes = defaultGossipNodes
+	}
+	if o.RetransmitMult == 0 {
+		o.RetransmitMult = defaultRetransmitMult
+	}
+	if o.JoinTimeout == 0 {
+		o.JoinTimeout = defaultJoinTimeout
+	}
+}
+
+// Membership 维护集群成员列表，并发安全
+type Membership struct {
+	opts Options
+	conn net.PacketConn
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	mu        sync.Mutex
+	self      Member
+	members   map[string]*Member     // 全部成员，包括自己以及下线、离开的成员（用于拒绝过期的消息）
+	suspects  map[string]*time.Timer // 疑似成员的计时器
+	acks      map[uint64]func()      // 等待 ack 的探测，key 为序号
+	seq       uint64
+	probeList []string // 本轮探测的顺序
+	probeIdx  int
+	queue     broadcastQueue
+	leaving   bool
+	seeds     []string      // Options.Seeds 以及 Join 传入的种子节点，离开时成员列表可能还是空的
+	joined    chan struct{} // 收到种子节点的成员列表后关闭
+	joinOnce  sync.Once
+
+	changed  chan struct{} // 成员变化通知，由 notifyLoop 调用 Peers 和 OnChange
+	lastMeta []string
+	closed   bool
+}
+
+// New 监听 BindAddr 并启动探测、gossip 协程，集群中此时只有自己
+func New(o Options) (*Membership, error) {
+	o.fillDefaults()
+	if o.ProbeTimeout >= o.ProbeInterval {
+		return nil, fmt.Errorf("ProbeTimeout（%v）必须小于 ProbeInterval（%v）", o.ProbeTimeout, o.ProbeInterval)
+	}
+	conn, err := net.ListenPacket("udp", o.BindAddr)
+	if err != nil {
+		return nil, err
+	}
+	addr := o.AdvertiseAddr
+	if addr == "" {
+		addr = conn.LocalAddr().String()
+	}
+	if o.Name == "" {
+		o.Name = addr
+	}
+	if o.Meta == "" {
+		o.Meta = addr
+	}
+	m := &Membership{
+		opts:     o,
+		conn:     conn,
+		done:     make(chan struct{}),
+		self:     Member{Name: o.Name, Addr: addr, Meta: o.Meta, State: StateAlive},
+		members:  make(map[string]*Member),
+		seeds:    append([]string(nil), o.Seeds...),
+		suspects: make(map[string]*time.Timer),
+		acks:     make(map[uint64]func()),
+		joined:   make(chan struct{}),
+		changed:  make(chan struct{}, 1),
+	}
+	self := m.self
+	m.members[self.Name] = &self
+	m.notify()
+
+	m.wg.Add(4)
+	go m.readLoop()
+	go m.probeLoop()
+	go m.gossipLoop()
+	go m.notifyLoop()
+	return m, nil
+}
+
+// Log 打印日志
+func (m *Membership) Log(format string, v ...interface{}) {
+	log.Printf("[Gossip %s] %s", m.opts.Name, fmt.Sprintf(format, v...))
+}
+
+// LocalAddr 返回实际监听的 gossip 地址
+func (m *Membership) LocalAddr() string {
+	return m.conn.LocalAddr().String()
+}
+
+// Join 向种子节点发送加入请求，任意一个种子节点返回成员列表后返回
+func (m *Membership) Join(seeds ...string) error {
+	if len(seeds) == 0 {
+		return nil
+	}
+	m.mu.Lock()
+	m.seeds = append(m.seeds, seeds...)
+	m.mu.Unlock()
+	m.sendJoin(seeds)
+	select {
+	case <-m.joined:
+		return nil
+	case <-time.After(m.opts.JoinTimeout):
+		return ErrJoinFailed
+	case <-m.done:
+		return ErrJoinFailed
+	}
+}
+
+// Members 返回存活和疑似的成员，按名称排序
+func (m *Membership) Members() []Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.liveMembers()
+}
+
+// liveMembers 返回存活和疑似的成员，需要持有 m.mu
+func (m *Membership) liveMembers() []Member {
+	var out []Member
+	for _, mem := range m.members {
+		if mem.State == StateAlive || mem.State == StateSuspect {
+			out = append(out, *mem)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Leave 向所有成员以及种子节点广播离开的消息，然后关闭；
+// 还没有收到成员列表时，种子节点已经知道自己加入，由它们传播离开的消息
+func (m *Membership) Leave() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.leaving = true
+	m.self.Incarnation++
+	m.self.State = StateLeft
+	u := m.self
+	seen := map[string]bool{m.self.Addr: true, m.LocalAddr(): true}
+	var targets []string
+	add := func(addr string) {
+		if !seen[addr] {
+			seen[addr] = true
+			targets = append(targets, addr)
+		}
+	}
+	for _, mem := range m.members {
+		if mem.Name != m.self.Name && (mem.State == StateAlive || mem.State == StateSuspect) {
+			add(mem.Addr)
+		}
+	}
+	for _, seed := range m.seeds {
+		add(seed)
+	}
+	m.mu.Unlock()
+	// UDP 可能丢包，直接发给每个成员两次，其他成员收到后还会继续传播
+	for i := 0; i < 2; i++ {
+		for _, addr := range targets {
+			m.send(addr, &message{Type: msgGossip, Updates: []Member{u}})
+		}
+	}
+	return m.Close()
+}
+
+// Close 直接关闭，不通知其他成员，其他成员会通过探测发现自己下线
+func (m *Membership) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	for _, t := range m.suspects {
+		t.Stop()
+	}
+	m.mu.Unlock()
+	close(m.done)
+	err := m.conn.Close()
+	m.wg.Wait()
+	return err
+}
+
+// apply 处理一条成员变化，返回是否接受，需要持有 m.mu
+func (m *Membership) apply(u Member) bool {
+	// 1.关于自己的疑似、下线消息，以更大的 incarnation 反驳
+	if u.Name == m.self.Name {
+		// 自己发出的 alive 消息，或者比当前 incarnation 旧的消息不需要反驳
+		if m.leaving || u.Incarnation < m.self.Incarnation || (u.State == StateAlive && u.Incarnation == m.self.Incarnation) {
+			return false
+		}
+		m.self.Incarnation = u.Incarnation + 1
+		self := m.self
+		m.members[self.Name] = &self
+		m.queue.push(self)
+		m.Log("反驳 %s 消息，incarnation 增加到 %d", u.State, self.Incarnation)
+		return false
+	}
+	// 2.按 SWIM 的规则判断消息是否比已知的状态更新
+	cur, ok := m.members[u.Name]
+	switch u.State {
+	case StateAlive:
+		if ok && u.Incarnation <= cur.Incarnation {
+			return false
+		}
+	case StateSuspect:
+		if !ok || cur.State == StateDead || cur.State == StateLeft {
+			return false
+		}
+		if u.Incarnation < cur.Incarnation || (cur.State == StateSuspect && u.Incarnation == cur.Incarnation) {
+			return false
+		}
+	case StateDead, StateLeft:
+		if ok && (u.Incarnation < cur.Incarnation || (cur.State == u.State && u.Incarnation == cur.Incarnation)) {
+			return false
+		}
+		if ok && cur.State == StateLeft && u.Incarnation == cur.Incarnation {
+			return false // 主动离开优先于下线
+		}
+	default:
+		return false
+	}
+	// 3.更新状态并继续传播
+	mem := u
+	m.members[u.Name] = &mem
+	m.queue.push(u)
+	if t, ok := m.suspects[u.Name]; ok {
+		t.Stop()
+		delete(m.suspects, u.Name)
+	}
+	if u.State == StateSuspect {
+		m.startSuspicion(u)
+	}
+	if !ok || cur.State != u.State {
+		m.Log("成员 %s（%s）：%s", u.Name, u.Meta, u.State)
+	}
+	m.notify()
+	return true
+}
+
+// startSuspicion 疑似成员超时后标记为下线，需要持有 m.mu
+func (m *Membership) startSuspicion(u Member) {
+	m.suspects[u.Name] = time.AfterFunc(m.opts.SuspicionTimeout, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		cur, ok := m.members[u.Name]
+		if m.closed || !ok || cur.State != StateSuspect || cur.Incarnation != u.Incarnation {
+			return
+		}
+		dead := *cur
+		dead.State = StateDead
+		m.apply(dead)
+	})
+}
+
+// suspect 将探测失败的成员标记为疑似
+func (m *Membership) suspect(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur, ok := m.members[name]
+	if !ok || cur.State != StateAlive {
+		return
+	}
+	u := *cur
+	u.State = StateSuspect
+	m.apply(u)
+}
+
+// notify 通知 notifyLoop 成员发生了变化，需要持有 m.mu
+func (m *Membership) notify() {
+	select {
+	case m.changed <- struct{}{}:
+	default:
+	}
+}
+
+// notifyLoop 按顺序调用 Peers 和 OnChange，回调时不持有锁
+func (m *Membership) notifyLoop() {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-m.changed:
+		}
+		m.mu.Lock()
+		members := m.liveMembers()
+		m.mu.Unlock()
+		metas := make([]string, len(members))
+		for i, mem := range members {
+			metas[i] = mem.Meta
+		}
+		sort.Strings(metas)
+		if !equalStrings(metas, m.lastMeta) {
+			m.lastMeta = metas
+			if m.opts.Peers != nil {
+				m.opts.Peers.Set(metas...)
+			}
+		}
+		if m.opts.OnChange != nil {
+			m.opts.OnChange(members)
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// probeLoop 每个探测周期探测一个成员
+func (m *Membership) probeLoop() {
+	defer m.wg.Done()
+	t := time.NewTicker(m.opts.ProbeInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-t.C:
+		}
+		// 集群中只有自己时重新尝试加入
+		if len(m.opts.Seeds) > 0 && len(m.Members()) <= 1 {
+			m.sendJoin(m.opts.Seeds)
+			continue
+		}
+		if target, ok := m.nextProbe(); ok {
+			m.probe(target)
+		}
+	}
+}
+
+// nextProbe 按随机打乱的顺序轮流选择探测目标，每个成员在一轮中只被探测一次
+func (m *Membership) nextProbe() (Member, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for tries := 0; tries < 2; tries++ {
+		for m.probeIdx < len(m.probeList) {
+			name := m.probeList[m.probeIdx]
+			m.probeIdx++
+			if mem, ok := m.members[name]; ok && (mem.State == StateAlive || mem.State == StateSuspect) {
+				return *mem, true
+			}
+		}
+		// 一轮结束，重新打乱
+		m.probeList = m.probeList[:0]
+		for name, mem := range m.members {
+			if name != m.self.Name && (mem.State == StateAlive || mem.State == StateSuspect) {
+				m.probeList = append(m.probeList, name)
+			}
+		}
+		rand.Shuffle(len(m.probeList), func(i, j int) {
+			m.probeList[i], m.probeList[j] = m.probeList[j], m.probeList[i]
+		})
+		m.probeIdx = 0
+	}
+	return Member{}, false
+}
+
+// probe 直接探测 target，超时后请其他成员间接探测，仍然失败则标记为疑似
+func (m *Membership) probe(target Member) {
+	acked := make(chan struct{}, 1)
+	m.mu.Lock()
+	m.seq++
+	seq := m.seq
+	m.acks[seq] = func() {
+		select {
+		case acked <- struct{}{}:
+		default:
+		}
+	}
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.acks, seq)
+		m.mu.Unlock()
+	}()
+
+	// 1.直接探测
+	m.send(target.Addr, &message{Type: msgPing, Seq: seq, Target: target.Name})
+	select {
+	case <-acked:
+		return
+	case <-m.done:
+		return
+	case <-time.After(m.opts.ProbeTimeout):
+	}
+	// 2.间接探测，ack 由中间成员转发回来，序号不变
+	for _, mem := range m.randomMembers(m.opts.IndirectChecks, target.Name) {
+		m.send(mem.Addr, &message{Type: msgPingReq, Seq: seq, Target: target.Name, TargetAddr: target.Addr})
+	}
+	select {
+	case <-acked:
+		return
+	case <-m.done:
+		return
+	case <-time.After(m.opts.ProbeInterval - m.opts.ProbeTimeout):
+	}
+	m.suspect(target.Name)
+}
+
+// randomMembers 随机选择最多 n 个存活的其他成员，不包括 exclude
+func (m *Membership) randomMembers(n int, exclude string) []Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Member
+	for name, mem := range m.members {
+		if name != m.self.Name && name != exclude && mem.State == StateAlive {
+			out = append(out, *mem)
+		}
+	}
+	rand.Shuffle(len(out), func(i, j int) { out[i], out[j] = out[j], out[i] })
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// gossipLoop 定期将待传播的成员变化发给随机的成员
+func (m *Membership) gossipLoop() {
+	defer m.wg.Done()
+	t := time.NewTicker(m.opts.GossipInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-t.C:
+		}
+		for _, mem := range m.randomMembers(m.opts.GossipNodes, "") {
+			msg := &message{Type: msgGossip}
+			m.piggyback(msg)
+			if len(msg.Updates) == 0 {
+				break
+			}
+			m.send(mem.Addr, msg)
+		}
+	}
+}
+
+// sendJoin 向种子节点发送加入请求
+func (m *Membership) sendJoin(seeds []string) {
+	m.mu.Lock()
+	self := m.self
+	m.mu.Unlock()
+	for _, seed := range seeds {
+		if seed != self.Addr {
+			m.send(seed, &message{Type: msgJoin, Members: []Member{self}})
+		}
+	}
+}
+
+// readLoop 读取并处理收到的消息
+func (m *Membership) readLoop() {
+	defer m.wg.Done()
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := m.conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-m.done:
+				return
+			default:
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		msg, err := decodeMessage(buf[:n])
+		if err != nil {
+			m.Log("来自 %s 的消息格式错误：%v", from, err)
+			continue
+		}
+		m.handle(from.String(), msg)
+	}
+}
+
+// handle 处理一条消息
+func (m *Membership) handle(from string, msg *message) {
+	// 1.先处理捎带的成员变化
+	m.mu.Lock()
+	for _, u := range msg.Updates {
+		m.apply(u)
+	}
+	m.mu.Unlock()
+
+	switch msg.Type {
+	case msgPing:
+		// 名称不一致说明地址已经被其他节点使用，不回复
+		if msg.Target != "" && msg.Target != m.opts.Name {
+			return
+		}
+		m.send(from, &message{Type: msgAck, Seq: msg.Seq})
+	case msgAck:
+		m.mu.Lock()
+		fn := m.acks[msg.Seq]
+		m.mu.Unlock()
+		if fn != nil {
+			fn()
+		}
+	case msgPingReq:
+		// 代为探测，收到 ack 后以原序号转发给发起方
+		m.mu.Lock()
+		m.seq++
+		seq := m.seq
+		m.acks[seq] = func() {
+			m.send(from, &message{Type: msgAck, Seq: msg.Seq})
+		}
+		m.mu.Unlock()
+		m.send(msg.TargetAddr, &message{Type: msgPing, Seq: seq, Target: msg.Target})
+		time.AfterFunc(m.opts.ProbeInterval, func() {
+			m.mu.Lock()
+			delete(m.acks, seq)
+			m.mu.Unlock()
+		})
+	case msgJoin:
+		// 新成员加入，回复完整的成员列表（包括下线的成员，新成员据此反驳过期的状态）
+		m.mu.Lock()
+		for _, u := range msg.Members {
+			m.apply(u)
+		}
+		var all []Member
+		for _, mem := range m.members {
+			all = append(all, *mem)
+		}
+		m.mu.Unlock()
+		m.send(from, &message{Type: msgSync, Members: all})
+	case msgSync:
+		m.mu.Lock()
+		for _, u := range msg.Members {
+			m.apply(u)
+		}
+		m.mu.Unlock()
+		m.joinOnce.Do(func() { close(m.joined) })
+	}
+}
+
+// send 发送消息，捎带待传播的成员变化
+func (m *Membership) send(addr string, msg *message) {
+	if msg.Type != msgGossip && msg.Type != msgSync {
+		m.piggyback(msg)
+	}
+	b, err := encodeMessage(msg)
+	if err != nil {
+		m.Log("编码消息失败：%v", err)
+		return
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		m.Log("地址 %s 格式错误：%v", addr, err)
+		return
+	}
+	// 发送失败与丢包一样由探测机制处理
+	m.conn.WriteTo(b, udpAddr)
+}
+
+// piggyback 从待传播队列中取出成员变化附加到 msg
+func (m *Membership) piggyback(msg *message) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, mem := range m.members {
+		if mem.State == StateAlive || mem.State == StateSuspect {
+			n++
+		}
+	}
+	msg.Updates = append(msg.Updates, m.queue.take(maxPiggyback, retransmitLimit(m.opts.RetransmitMult, n))...)
+}
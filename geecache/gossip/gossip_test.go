@@ -0,0 +1,246 @@
+package gossip
+
+import (
+	"fmt"
+	"geecache"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePool 记录最近一次 Set 传入的节点
+type fakePool struct {
+	mu    sync.Mutex
+	peers []string
+}
+
+func (p *fakePool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.peers = append([]string(nil), peers...)
+}
+
+func (p *fakePool) get() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.peers
+}
+
+// testNode 使用较短的探测周期启动一个节点
+func testNode(t *testing.T, name string, seeds ...string) (*Membership, *fakePool) {
+	t.Helper()
+	pool := &fakePool{}
+	m, err := New(Options{
+		Name:             name,
+		Meta:             "http://" + name,
+		BindAddr:         "127.0.0.1:0",
+		Seeds:            seeds,
+		Peers:            pool,
+		ProbeInterval:    50 * time.Millisecond,
+		ProbeTimeout:     20 * time.Millisecond,
+		SuspicionTimeout: 200 * time.Millisecond,
+		GossipInterval:   20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m, pool
+}
+
+// waitPeers 等待 pool 中的节点变为 want
+func waitPeers(t *testing.T, pool *fakePool, want ...string) {
+	t.Helper()
+	sort.Strings(want)
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if reflect.DeepEqual(pool.get(), want) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("节点应该为 %v，实际 %v", want, pool.get())
+}
+
+func metas(names ...string) []string {
+	out := make([]string, len(names))
+	for i, name := range names {
+		out[i] = "http://" + name
+	}
+	return out
+}
+
+// 测试通过种子节点加入集群，成员变化传播到所有节点
+func TestJoin(t *testing.T) {
+	a, poolA := testNode(t, "a")
+	waitPeers(t, poolA, metas("a")...)
+	b, poolB := testNode(t, "b")
+	if err := b.Join(a.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	// c 只知道 b，通过 gossip 得知 a
+	c, poolC := testNode(t, "c")
+	if err := c.Join(b.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	for _, pool := range []*fakePool{poolA, poolB, poolC} {
+		waitPeers(t, pool, metas("a", "b", "c")...)
+	}
+	if got := len(c.Members()); got != 3 {
+		t.Fatalf("c 应该有 3 个成员，实际 %d", got)
+	}
+}
+
+// 测试种子节点稍后才启动时自动重试加入
+func TestJoinRetry(t *testing.T) {
+	a, poolA := testNode(t, "a")
+	_, poolB := testNode(t, "b", a.LocalAddr())
+	waitPeers(t, poolA, metas("a", "b")...)
+	waitPeers(t, poolB, metas("a", "b")...)
+}
+
+func TestOptions(t *testing.T) {
+	_, err := New(Options{BindAddr: "127.0.0.1:0", ProbeInterval: time.Second, ProbeTimeout: time.Second})
+	if err == nil {
+		t.Fatalf("ProbeTimeout 不小于 ProbeInterval 时应该返回错误")
+	}
+}
+
+// 测试节点崩溃后先被标记为疑似，超时后下线并移出哈希环
+func TestFailureDetection(t *testing.T) {
+	a, poolA := testNode(t, "a")
+	_, poolB := testNode(t, "b", a.LocalAddr())
+	c, _ := testNode(t, "c", a.LocalAddr())
+	waitPeers(t, poolA, metas("a", "b", "c")...)
+	waitPeers(t, poolB, metas("a", "b", "c")...)
+
+	c.Close() // 不广播离开
+	waitPeers(t, poolA, metas("a", "b")...)
+	waitPeers(t, poolB, metas("a", "b")...)
+	for _, mem := range a.Members() {
+		if mem.Name == "c" {
+			t.Fatalf("c 应该已经下线：%+v", mem)
+		}
+	}
+}
+
+// 测试主动离开时其他节点在探测超时之前就将其移除
+func TestLeave(t *testing.T) {
+	a, poolA := testNode(t, "a")
+	b, poolB := testNode(t, "b", a.LocalAddr())
+	waitPeers(t, poolA, metas("a", "b")...)
+	waitPeers(t, poolB, metas("a", "b")...)
+
+	start := time.Now()
+	if err := b.Leave(); err != nil {
+		t.Fatal(err)
+	}
+	waitPeers(t, poolA, metas("a")...)
+	// 只依靠探测至少需要 ProbeInterval + SuspicionTimeout
+	if d := time.Since(start); d >= 250*time.Millisecond {
+		t.Fatalf("离开应该立即生效，实际用了 %v", d)
+	}
+}
+
+// 测试还没有收到成员列表就离开时，种子节点仍然会收到离开的消息
+func TestLeaveBeforeSync(t *testing.T) {
+	a, _ := testNode(t, "a")
+	b, err := New(Options{Name: "b", Meta: "http://b", BindAddr: "127.0.0.1:0", Seeds: []string{a.LocalAddr()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 发送加入请求后立即离开，不等待 a 返回成员列表
+	b.sendJoin([]string{a.LocalAddr()})
+	if err := b.Leave(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		a.mu.Lock()
+		mem, ok := a.members["b"]
+		left := ok && mem.State == StateLeft
+		a.mu.Unlock()
+		if left {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("a 应该收到 b 离开的消息")
+}
+
+// 测试节点收到关于自己的疑似消息时反驳
+func TestRefuteSuspicion(t *testing.T) {
+	a, poolA := testNode(t, "a")
+	testNode(t, "b", a.LocalAddr())
+	waitPeers(t, poolA, metas("a", "b")...)
+
+	// a 误认为 b 疑似下线，b 收到后以更大的 incarnation 反驳，不会被移出
+	a.suspect("b")
+	time.Sleep(400 * time.Millisecond) // 超过 SuspicionTimeout
+	var got Member
+	for _, mem := range a.Members() {
+		if mem.Name == "b" {
+			got = mem
+		}
+	}
+	if got.State != StateAlive || got.Incarnation == 0 {
+		t.Fatalf("b 应该反驳疑似消息：%+v", got)
+	}
+	waitPeers(t, poolA, metas("a", "b")...)
+}
+
+func TestBroadcastQueue(t *testing.T) {
+	var q broadcastQueue
+	for i := 0; i < 3; i++ {
+		q.push(Member{Name: fmt.Sprint(i)})
+	}
+	q.push(Member{Name: "1", Incarnation: 1}) // 替换旧消息
+	if got := q.take(2, 2); len(got) != 2 || got[0].Name != "1" || got[0].Incarnation != 1 {
+		t.Fatalf("应该优先发送最新的消息：%+v", got)
+	}
+	// 发送次数少的优先
+	if got := q.take(1, 2); len(got) != 1 || got[0].Name != "0" {
+		t.Fatalf("应该优先发送次数少的消息：%+v", got)
+	}
+	// 每条消息发送 2 次后移除
+	for i := 0; i < 3; i++ {
+		q.take(3, 2)
+	}
+	if got := q.take(3, 2); len(got) != 0 {
+		t.Fatalf("达到重传次数的消息应该被移除：%+v", got)
+	}
+	if retransmitLimit(4, 3) != 4 || retransmitLimit(4, 20) != 8 {
+		t.Fatalf("重传次数错误")
+	}
+}
+
+// 测试成员变化更新 HTTPPool 的哈希环
+func TestHTTPPoolRing(t *testing.T) {
+	selfA := "http://127.0.0.1:18001"
+	poolA := geecache.NewHTTPPool(selfA)
+	a, err := New(Options{Name: "a", Meta: selfA, BindAddr: "127.0.0.1:0", Peers: poolA,
+		ProbeInterval: 50 * time.Millisecond, ProbeTimeout: 20 * time.Millisecond, GossipInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	testNode(t, "b", a.LocalAddr())
+
+	// b 加入后 a 的哈希环中有两个节点，部分 key 由远程节点负责
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		remote := 0
+		for i := 0; i < 20; i++ {
+			if _, ok := poolA.PickPeer(fmt.Sprint("key", i)); ok {
+				remote++
+			}
+		}
+		if remote > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("b 加入后 a 的哈希环中应该有远程节点")
+}
@@ -0,0 +1,114 @@
+package gossip
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// msgType 消息类型
+type msgType uint8
+
+const (
+	msgPing    msgType = iota + 1 // 探测
+	msgAck                        // 探测的响应
+	msgPingReq                    // 请求其他成员代为探测
+	msgGossip                     // 只包含成员变化
+	msgJoin                       // 加入集群
+	msgSync                       // 加入集群的响应，包含完整的成员列表
+)
+
+// message gossip 消息，使用 JSON 编码，每条消息是一个 UDP 报文
+type message struct {
+	Type       msgType  `json:"t"`
+	Seq        uint64   `json:"seq,omitempty"`    // 探测序号
+	Target     string   `json:"target,omitempty"` // 探测目标的名称
+	TargetAddr string   `json:"taddr,omitempty"`  // 间接探测目标的地址
+	Members    []Member `json:"m,omitempty"`      // 加入、同步时的成员列表
+	Updates    []Member `json:"u,omitempty"`      // 捎带的成员变化
+}
+
+func encodeMessage(msg *message) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func decodeMessage(b []byte) (*message, error) {
+	msg := &message{}
+	if err := json.Unmarshal(b, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// retransmitLimit 每条成员变化的重传次数，随集群规模对数增长
+func retransmitLimit(mult, n int) int {
+	return mult * int(math.Ceil(math.Log10(float64(n+1))))
+}
+
+// broadcast 待传播的成员变化
+type broadcast struct {
+	update    Member
+	transmits int // 已经发送的次数
+}
+
+// broadcastQueue 待传播的成员变化，同一个成员只保留最新的一条
+type broadcastQueue struct {
+	items []*broadcast
+}
+
+// push 加入一条成员变化，替换同一个成员的旧消息
+func (q *broadcastQueue) push(u Member) {
+	for i, b := range q.items {
+		if b.update.Name == u.Name {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			break
+		}
+	}
+	q.items = append(q.items, &broadcast{update: u})
+}
+
+// take 取出最多 n 条发送次数最少的成员变化，发送次数达到 limit 的消息被移除
+func (q *broadcastQueue) take(n, limit int) []Member {
+	if len(q.items) == 0 {
+		return nil
+	}
+	// 发送次数少的优先，次数相同时新加入的优先
+	picked := make([]*broadcast, 0, n)
+	for len(picked) < n {
+		var best *broadcast
+		for i := len(q.items) - 1; i >= 0; i-- {
+			b := q.items[i]
+			if contains(picked, b) {
+				continue
+			}
+			if best == nil || b.transmits < best.transmits {
+				best = b
+			}
+		}
+		if best == nil {
+			break
+		}
+		picked = append(picked, best)
+	}
+	out := make([]Member, len(picked))
+	for i, b := range picked {
+		out[i] = b.update
+		b.transmits++
+	}
+	kept := q.items[:0]
+	for _, b := range q.items {
+		if b.transmits < limit {
+			kept = append(kept, b)
+		}
+	}
+	q.items = kept
+	return out
+}
+
+func contains(bs []*broadcast, b *broadcast) bool {
+	for _, x := range bs {
+		if x == b {
+			return true
+		}
+	}
+	return false
+}
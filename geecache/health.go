@@ -0,0 +1,296 @@
+package geecache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"geecache/breaker"
+	pb "geecache/geecachepb"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	healthPath = "_health" // 健康检查接口：/<basepath>/_health
+	statsPath  = "_stats"  // 统计信息接口：/<basepath>/_stats
+
+	defaultHealthInterval   = 5 * time.Second
+	defaultHealthTimeout    = time.Second
+	defaultFailureThreshold = 3
+	defaultSuccessThreshold = 2
+	defaultEjectDuration    = 10 * time.Second
+)
+
+// HealthEvent.Reason 的取值
+const (
+	HealthReasonProbe   = "probe"   // 主动探测失败
+	HealthReasonPassive = "passive" // 正常请求失败
+	HealthReasonReadmit = "readmit" // 探测恢复，重新加入
+)
+
+// HealthCheckOptions 节点健康检查配置，零值字段使用默认值
+type HealthCheckOptions struct {
+	// Interval 主动探测的间隔
+	Interval time.Duration
+	// Timeout 单次探测的超时时间
+	Timeout time.Duration
+	// FailureThreshold 连续失败多少次（主动探测或正常请求）后将节点摘除出哈希环
+	FailureThreshold int
+	// SuccessThreshold 被摘除的节点连续探测成功多少次后重新加入哈希环
+	SuccessThreshold int
+	// EjectDuration 节点被摘除后的最短时间，防止节点频繁上下线
+	EjectDuration time.Duration
+	// OnChange 节点健康状态变化时的回调，可以为 nil
+	OnChange func(HealthEvent)
+}
+
+// HealthEvent 节点健康状态变化事件
+type HealthEvent struct {
+	Peer    string    // 节点地址
+	Healthy bool      // 变化后的状态
+	Reason  string    // 变化原因：probe 主动探测、passive 请求失败、readmit 恢复
+	Err     string    // 导致摘除的错误信息
+	Time    time.Time // 发生时间
+}
+
+// PeerStats 单个远程节点的统计信息
+type PeerStats struct {
+	Requests  int64  `json:"requests"`             // 请求次数
+	Errors    int64  `json:"errors"`               // 失败次数
+	Hedges    int64  `json:"hedges"`               // 对冲请求次数
+	Healthy   bool   `json:"healthy"`              // 是否在哈希环中
+	Ejections int64  `json:"ejections"`            // 被摘除的次数
+	LastError string `json:"last_error,omitempty"` // 最近一次导致失败的错误
+	Breaker   string `json:"breaker,omitempty"`    // 熔断器状态，未配置熔断器时为空
+	Trips     int64  `json:"breaker_trips"`        // 熔断器打开的次数
+}
+
+// peerHealth 记录单个节点的健康状态，由 HTTPPool.mu 保护
+type peerHealth struct {
+	failures  int // 连续失败次数
+	successes int // 被摘除后连续探测成功的次数
+	ejected   bool
+	ejectedAt time.Time
+	left      bool // 节点通知自己主动下线，重新上线或被探测摘除后恢复时清除
+	ejections int64
+	lastErr   string
+}
+
+// fillDefaults 填充健康检查的默认配置
+func (o *HealthCheckOptions) fillDefaults() {
+	if o.Interval == 0 {
+		o.Interval = defaultHealthInterval
+	}
+	if o.Timeout == 0 {
+		o.Timeout = defaultHealthTimeout
+	}
+	if o.FailureThreshold == 0 {
+		o.FailureThreshold = defaultFailureThreshold
+	}
+	if o.SuccessThreshold == 0 {
+		o.SuccessThreshold = defaultSuccessThreshold
+	}
+	if o.EjectDuration == 0 {
+		o.EjectDuration = defaultEjectDuration
+	}
+}
+
+// isPeerFailure 判断错误是否说明节点本身不健康：只有网络错误、超时和 UNAVAILABLE 算。
+// 回源失败（INTERNAL）、NOT_FOUND、CACHE_MISS 说明节点正常处理了请求，不算，
+// 否则数据源出错时健康的所有者会被摘除；被主动取消（对冲请求的落后方）以及被熔断器拒绝的请求也不算
+func isPeerFailure(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, breaker.ErrOpen) {
+		return false
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		var pe *PeerError
+		if errors.As(se.err, &pe) {
+			return pe.Code == pb.Code_UNAVAILABLE
+		}
+		// 旧版本的节点不返回错误码，回源失败时同样返回 500，只有网关类状态码说明节点不可用
+		switch se.code {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var ne net.Error // 包括 *url.Error 以及读取响应体时的超时
+	return errors.As(err, &ne) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// observe 记录一次请求的结果，用于统计和被动健康检测
+func (p *HTTPPool) observe(g *httpGetter, err error) {
+	g.requests.Add(1)
+	if err != nil {
+		g.errors.Add(1)
+	}
+	if p.opts.HealthCheck == nil || (err != nil && !isPeerFailure(err)) {
+		return
+	}
+	p.mu.Lock()
+	ev, changed := p.updateHealth(g, err, false)
+	p.mu.Unlock()
+	if changed {
+		p.emitHealth(ev)
+	}
+}
+
+// updateHealth 根据请求或探测结果更新节点状态，需要持有 p.mu
+// 状态发生变化时重建哈希环并返回对应的事件
+func (p *HTTPPool) updateHealth(g *httpGetter, err error, probe bool) (ev HealthEvent, changed bool) {
+	// 1.节点已经被 Set 移除，忽略
+	if p.httpGetters[g.peer] != g {
+		return
+	}
+	o := p.opts.HealthCheck
+	h := &g.health
+	ev = HealthEvent{Peer: g.peer, Time: time.Now()}
+	if err == nil {
+		h.failures = 0
+		if !h.ejected || !probe {
+			return
+		}
+		// 2.被摘除的节点探测成功，达到阈值且超过最短摘除时间后重新加入
+		h.successes++
+		if h.successes < o.SuccessThreshold || time.Since(h.ejectedAt) < o.EjectDuration {
+			return
+		}
+		h.ejected = false
+		h.successes = 0
+		if h.left {
+			h.left = false
+			p.leftPeers.Add(-1)
+		}
+		ev.Healthy, ev.Reason = true, HealthReasonReadmit
+		p.rebuildRing()
+		return ev, true
+	}
+	// 3.请求或探测失败，连续失败达到阈值后摘除节点
+	h.successes = 0
+	h.failures++
+	h.lastErr = err.Error()
+	if h.ejected || h.failures < o.FailureThreshold {
+		return
+	}
+	h.ejected = true
+	h.ejectedAt = ev.Time
+	h.ejections++
+	ev.Reason, ev.Err = HealthReasonPassive, h.lastErr
+	if probe {
+		ev.Reason = HealthReasonProbe
+	}
+	p.rebuildRing()
+	return ev, true
+}
+
+// emitHealth 打印日志并通知回调，调用时不能持有 p.mu
+func (p *HTTPPool) emitHealth(ev HealthEvent) {
+	if ev.Healthy {
+		p.Log("节点 %s 恢复，重新加入哈希环", ev.Peer)
+	} else {
+		p.Log("节点 %s 不健康（%s：%s），摘除出哈希环", ev.Peer, ev.Reason, ev.Err)
+	}
+	if fn := p.opts.HealthCheck.OnChange; fn != nil {
+		fn(ev)
+	}
+}
+
+// healthLoop 定期主动探测所有远程节点，直到 Close 被调用
+func (p *HTTPPool) healthLoop() {
+	ticker := time.NewTicker(p.opts.HealthCheck.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.probeAll()
+		}
+	}
+}
+
+// probeAll 并发探测所有远程节点
+func (p *HTTPPool) probeAll() {
+	p.mu.Lock()
+	getters := make([]*httpGetter, 0, len(p.httpGetters))
+	for peer, g := range p.httpGetters {
+		if peer != p.self {
+			getters = append(getters, g)
+		}
+	}
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, g := range getters {
+		wg.Add(1)
+		go func(g *httpGetter) {
+			defer wg.Done()
+			err := g.probe(p.opts.HealthCheck.Timeout)
+			p.mu.Lock()
+			ev, changed := p.updateHealth(g, err, true)
+			p.mu.Unlock()
+			if changed {
+				p.emitHealth(ev)
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+// probe 访问远程节点的健康检查接口
+func (h *httpGetter) probe(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.baseURL+healthPath, nil)
+	if err != nil {
+		return err
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return &statusError{code: res.StatusCode}
+	}
+	return nil
+}
+
+// Stats 返回所有远程节点的统计信息
+func (p *HTTPPool) Stats() map[string]PeerStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make(map[string]PeerStats, len(p.httpGetters))
+	for peer, g := range p.httpGetters {
+		s := PeerStats{
+			Requests:  g.requests.Load(),
+			Errors:    g.errors.Load(),
+			Hedges:    g.hedges.Load(),
+			Healthy:   !g.health.ejected && !g.health.left,
+			Ejections: g.health.ejections,
+			LastError: g.health.lastErr,
+		}
+		if g.breaker != nil {
+			bs := g.breaker.Stats()
+			s.Breaker, s.Trips = bs.State.String(), bs.Trips
+		}
+		stats[peer] = s
+	}
+	return stats
+}
+
+// serveHealth 处理健康检查请求
+func (p *HTTPPool) serveHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok"))
+}
+
+// serveStats 以 JSON 格式返回节点统计信息
+func (p *HTTPPool) serveStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.Stats())
+}
@@ -0,0 +1,168 @@
+package geecache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	pb "geecache/geecachepb"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor 轮询 cond，超时则测试失败
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待超时：%s", msg)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// 测试主动探测摘除不健康的节点，节点恢复后重新加入哈希环
+func TestHealthCheckEjectAndReadmit(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer flaky.Close()
+	good := httptest.NewServer(NewHTTPPool("good"))
+	defer good.Close()
+
+	var mu sync.Mutex
+	var events []HealthEvent
+	p := NewHTTPPoolOpts("local", &HTTPPoolOptions{HealthCheck: &HealthCheckOptions{
+		Interval:         10 * time.Millisecond,
+		FailureThreshold: 2,
+		SuccessThreshold: 2,
+		EjectDuration:    50 * time.Millisecond,
+		OnChange: func(ev HealthEvent) {
+			mu.Lock()
+			events = append(events, ev)
+			mu.Unlock()
+		},
+	}})
+	defer p.Close()
+	p.Set(flaky.URL, good.URL)
+
+	// 1.节点不健康，应该被摘除，所有 key 都路由到健康的节点
+	healthy.Store(false)
+	waitFor(t, time.Second, func() bool { return !p.Stats()[flaky.URL].Healthy }, "节点被摘除")
+	for _, key := range []string{"Tom", "Jack", "Sam", "a", "b", "c"} {
+		peer, ok := p.PickPeer(key)
+		if !ok || peer.(*httpGetter).peer != good.URL {
+			t.Fatalf("key %s 不应该路由到被摘除的节点", key)
+		}
+	}
+
+	// 2.节点恢复后重新加入哈希环
+	healthy.Store(true)
+	waitFor(t, time.Second, func() bool { return p.Stats()[flaky.URL].Healthy }, "节点重新加入")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 || events[0].Healthy || events[0].Reason != HealthReasonProbe ||
+		!events[1].Healthy || events[1].Reason != HealthReasonReadmit {
+		t.Fatalf("健康事件不符合预期：%+v", events)
+	}
+	if p.Stats()[flaky.URL].Ejections != 1 {
+		t.Fatalf("应该记录一次摘除")
+	}
+}
+
+// 测试正常请求失败时被动摘除节点
+func TestHealthCheckPassive(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	deadURL := dead.URL
+	dead.Close() // 关闭后的地址会连接失败
+
+	p := NewHTTPPoolOpts("local", &HTTPPoolOptions{HealthCheck: &HealthCheckOptions{
+		Interval:         time.Hour, // 不依赖主动探测
+		FailureThreshold: 2,
+	}})
+	defer p.Close()
+	p.Set(deadURL)
+	for i := 0; i < 2; i++ {
+		peer, ok := p.PickPeer("Tom")
+		if !ok {
+			t.Fatalf("第 %d 次请求前节点不应该被摘除", i+1)
+		}
+		if err := peer.Get(&pb.Request{Group: []byte("g"), Key: []byte("Tom")}, &pb.Response{}); err == nil {
+			t.Fatalf("请求已关闭的节点应该失败")
+		}
+	}
+	if _, ok := p.PickPeer("Tom"); ok {
+		t.Fatalf("连续失败后节点应该被摘除")
+	}
+	if s := p.Stats()[deadURL]; s.Requests != 2 || s.Errors != 2 || s.Healthy {
+		t.Fatalf("统计信息错误：%+v", s)
+	}
+}
+
+func TestHealthAndStatsEndpoints(t *testing.T) {
+	p := NewHTTPPool("local")
+	p.Set("http://peer")
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + defaultBasePath + healthPath)
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("健康检查接口异常：%v", err)
+	}
+	res.Body.Close()
+
+	res, err = http.Get(srv.URL + defaultBasePath + statsPath)
+	if err != nil {
+		t.Fatalf("统计接口异常：%v", err)
+	}
+	defer res.Body.Close()
+	var stats map[string]PeerStats
+	if err := json.NewDecoder(res.Body).Decode(&stats); err != nil {
+		t.Fatalf("解码统计信息失败：%v", err)
+	}
+	if s, ok := stats["http://peer"]; !ok || !s.Healthy {
+		t.Fatalf("统计信息错误：%+v", stats)
+	}
+}
+
+// 测试数据源出错或 key 不存在时不摘除健康的节点
+func TestHealthCheckIgnoresOriginErrors(t *testing.T) {
+	NewGroup("health-origin", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, fmt.Errorf("%w：%s", ErrNotFound, key)
+		}
+		return nil, errors.New("数据库不可用")
+	}))
+	remote := httptest.NewServer(NewHTTPPool("remote"))
+	defer remote.Close()
+
+	p := NewHTTPPoolOpts("local", &HTTPPoolOptions{HealthCheck: &HealthCheckOptions{
+		Interval:         time.Hour, // 不依赖主动探测
+		FailureThreshold: 2,
+	}})
+	defer p.Close()
+	p.Set(remote.URL)
+	for i, key := range []string{"Tom", "missing", "Tom", "missing"} {
+		peer, ok := p.PickPeer(key)
+		if !ok {
+			t.Fatalf("第 %d 次请求前节点不应该被摘除", i+1)
+		}
+		if err := peer.Get(&pb.Request{Group: []byte("health-origin"), Key: []byte(key)}, &pb.Response{}); err == nil {
+			t.Fatalf("回源失败时请求应该返回错误")
+		}
+	}
+	if s := p.Stats()[remote.URL]; s.Errors != 4 || !s.Healthy || s.Ejections != 0 {
+		t.Fatalf("回源失败不应该摘除节点：%+v", s)
+	}
+}
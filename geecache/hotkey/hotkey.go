@@ -0,0 +1,154 @@
+package hotkey
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCapacity  = 64
+	defaultWindow    = 10 * time.Second
+	defaultBuckets   = 10
+	defaultThreshold = 100
+)
+
+// Options 用于配置 Detector，零值字段使用默认值
+type Options struct {
+	// Capacity 每个时间片最多监控的 key 数，即 top-K 中的 K，默认为 64
+	Capacity int
+	// Window 滑动窗口的长度，默认为 10s
+	Window time.Duration
+	// Buckets 滑动窗口划分的时间片数，越多过期越平滑，默认为 10
+	Buckets int
+	// Threshold 窗口内访问次数不小于该值的 key 为热点，默认为 100
+	Threshold int64
+}
+
+// Item 热点 key 及其在窗口内的访问次数
+type Item struct {
+	Key   string
+	Count int64
+}
+
+// Detector 在滑动窗口内统计访问次数最多的 key：窗口划分为多个时间片，
+// 每个时间片使用 space-saving 算法统计，时间片过期后整体清空
+type Detector struct {
+	mu      sync.Mutex
+	opts    Options
+	span    time.Duration // 每个时间片的长度
+	buckets []*spaceSaving
+	cur     int       // 当前时间片的下标
+	start   time.Time // 当前时间片的开始时间
+	now     func() time.Time
+}
+
+// New 创建 Detector，o 为 nil 时全部使用默认值
+func New(o *Options) *Detector {
+	d := &Detector{now: time.Now}
+	if o != nil {
+		d.opts = *o
+	}
+	// 1.填充默认值
+	if d.opts.Capacity <= 0 {
+		d.opts.Capacity = defaultCapacity
+	}
+	if d.opts.Window <= 0 {
+		d.opts.Window = defaultWindow
+	}
+	if d.opts.Buckets <= 0 {
+		d.opts.Buckets = defaultBuckets
+	}
+	if d.opts.Threshold <= 0 {
+		d.opts.Threshold = defaultThreshold
+	}
+	// 2.初始化时间片
+	d.span = d.opts.Window / time.Duration(d.opts.Buckets)
+	if d.span <= 0 {
+		d.span = 1
+	}
+	d.buckets = make([]*spaceSaving, d.opts.Buckets)
+	for i := range d.buckets {
+		d.buckets[i] = newSpaceSaving(d.opts.Capacity)
+	}
+	d.start = d.now()
+	return d
+}
+
+// advance 清空已经过期的时间片，需要持有 d.mu
+func (d *Detector) advance() {
+	steps := int(d.now().Sub(d.start) / d.span)
+	if steps <= 0 {
+		return
+	}
+	for i := 0; i < steps && i < len(d.buckets); i++ {
+		d.cur = (d.cur + 1) % len(d.buckets)
+		d.buckets[d.cur].reset()
+	}
+	d.start = d.start.Add(time.Duration(steps) * d.span)
+}
+
+// count 返回 key 在窗口内的次数，需要持有 d.mu
+func (d *Detector) count(key string) int64 {
+	var n int64
+	for _, b := range d.buckets {
+		n += b.count(key)
+	}
+	return n
+}
+
+// Touch 记录一次访问，返回 key 是否为热点
+func (d *Detector) Touch(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.advance()
+	d.buckets[d.cur].add(key)
+	return d.count(key) >= d.opts.Threshold
+}
+
+// IsHot 判断 key 是否为热点，不记录访问
+func (d *Detector) IsHot(key string) bool {
+	return d.Count(key) >= d.opts.Threshold
+}
+
+// Count 返回 key 在窗口内的访问次数，是不大于真实值的估计
+func (d *Detector) Count(key string) int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.advance()
+	return d.count(key)
+}
+
+// Top 返回窗口内访问次数最多的最多 n 个 key，按次数从大到小排序
+func (d *Detector) Top(n int) []Item {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.advance()
+	counts := make(map[string]int64)
+	for _, b := range d.buckets {
+		for key := range b.counters {
+			counts[key] += b.count(key)
+		}
+	}
+	items := make([]Item, 0, len(counts))
+	for key, c := range counts {
+		items = append(items, Item{Key: key, Count: c})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Key < items[j].Key
+	})
+	if n >= 0 && len(items) > n {
+		items = items[:n]
+	}
+	return items
+}
+
+// Hot 返回窗口内的全部热点 key，按次数从大到小排序
+func (d *Detector) Hot() []Item {
+	items := d.Top(-1)
+	i := sort.Search(len(items), func(i int) bool { return items[i].Count < d.opts.Threshold })
+	return items[:i]
+}
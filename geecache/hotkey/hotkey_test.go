@@ -0,0 +1,60 @@
+package hotkey
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// 测试 space-saving 在容量远小于 key 的数量时仍然能找出热点
+func TestSpaceSaving(t *testing.T) {
+	d := New(&Options{Capacity: 8, Threshold: 100})
+	for i := 0; i < 1000; i++ {
+		d.Touch("hot-a")
+		if i%2 == 0 {
+			d.Touch("hot-b")
+		}
+		// 每个冷 key 只访问一次
+		d.Touch("cold-" + strconv.Itoa(i))
+	}
+	top := d.Top(2)
+	if len(top) != 2 || top[0].Key != "hot-a" || top[1].Key != "hot-b" {
+		t.Fatalf("期望 hot-a、hot-b，实际 %v", top)
+	}
+	if top[0].Count != 1000 {
+		t.Fatalf("一直被监控的 key 次数应该准确：%d", top[0].Count)
+	}
+	hot := d.Hot()
+	if len(hot) != 2 || !d.IsHot("hot-a") || d.IsHot("cold-999") {
+		t.Fatalf("热点判断错误：%v", hot)
+	}
+}
+
+// 测试访问次数随滑动窗口过期
+func TestWindow(t *testing.T) {
+	now := time.Unix(0, 0)
+	d := New(&Options{Window: 10 * time.Second, Buckets: 10, Threshold: 10})
+	d.now = func() time.Time { return now }
+	d.start = now
+	for i := 0; i < 10; i++ {
+		if hot := d.Touch("k"); hot != (i == 9) {
+			t.Fatalf("第 %d 次访问，热点判断错误", i+1)
+		}
+	}
+	// 1.窗口内继续保持热点
+	now = now.Add(5 * time.Second)
+	if d.Count("k") != 10 {
+		t.Fatalf("期望 10 次，实际 %d", d.Count("k"))
+	}
+	d.Touch("k")
+	// 2.第一批访问所在的时间片过期，只剩下后来的一次
+	now = now.Add(5 * time.Second)
+	if c := d.Count("k"); c != 1 || d.IsHot("k") {
+		t.Fatalf("期望只剩 1 次，实际 %d", c)
+	}
+	// 3.整个窗口过期
+	now = now.Add(time.Hour)
+	if c := d.Count("k"); c != 0 {
+		t.Fatalf("期望 0 次，实际 %d", c)
+	}
+}
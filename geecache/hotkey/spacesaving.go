@@ -0,0 +1,94 @@
+package hotkey
+
+import "container/heap"
+
+// counter space-saving 算法中被监控的 key
+type counter struct {
+	key   string
+	count int64 // 估计的访问次数，不小于真实值
+	err   int64 // 估计的误差上限，count-err 不大于真实值
+	index int   // 在最小堆中的下标
+}
+
+// minHeap 按 count 排序的最小堆，堆顶是最容易被替换的 key
+type minHeap []*counter
+
+func (h minHeap) Len() int           { return len(h) }
+func (h minHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h minHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *minHeap) Push(x interface{}) {
+	c := x.(*counter)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *minHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return c
+}
+
+// spaceSaving 使用固定的内存统计出现次数最多的 key：
+// 最多监控 capacity 个 key，新的 key 替换次数最少的 key 并继承它的次数，
+// 真实次数超过 N/capacity 的 key 一定会被监控（N 为总次数）
+type spaceSaving struct {
+	capacity int
+	counters map[string]*counter
+	heap     minHeap
+}
+
+func newSpaceSaving(capacity int) *spaceSaving {
+	return &spaceSaving{
+		capacity: capacity,
+		counters: make(map[string]*counter, capacity),
+		heap:     make(minHeap, 0, capacity),
+	}
+}
+
+// add 记录一次访问
+func (s *spaceSaving) add(key string) {
+	// 1.已经被监控，次数加一
+	if c, ok := s.counters[key]; ok {
+		c.count++
+		heap.Fix(&s.heap, c.index)
+		return
+	}
+	// 2.还有空位，直接监控
+	if len(s.heap) < s.capacity {
+		c := &counter{key: key, count: 1}
+		s.counters[key] = c
+		heap.Push(&s.heap, c)
+		return
+	}
+	// 3.替换次数最少的 key，继承它的次数作为误差
+	c := s.heap[0]
+	delete(s.counters, c.key)
+	c.key, c.err = key, c.count
+	c.count++
+	s.counters[key] = c
+	heap.Fix(&s.heap, 0)
+}
+
+// count 返回 key 被监控以来确定的次数 count-err，不大于真实值，
+// 避免刚替换进来的冷 key 继承的次数使它被误判为热点；未被监控时返回 0
+func (s *spaceSaving) count(key string) int64 {
+	if c, ok := s.counters[key]; ok {
+		return c.count - c.err
+	}
+	return 0
+}
+
+// reset 清空统计
+func (s *spaceSaving) reset() {
+	for k := range s.counters {
+		delete(s.counters, k)
+	}
+	s.heap = s.heap[:0]
+}
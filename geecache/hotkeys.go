@@ -0,0 +1,206 @@
+package geecache
+
+import (
+	"geecache/hotkey"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// 热点 key：抢购等场景下一个 key 的读取集中在它的所有者上。
+// Group.Get、GetStream 和 Client 每次读取时调用 Touch 统计访问次数（命中缓存也计数，
+// 否则保存副本后访问次数下降，key 会在热点与非热点之间反复切换），超过阈值的 key 为热点：
+// 1.PickPeer 在所有者和哈希环上之后的 N 个副本之间随机选择，分散读取；
+// 2.副本和读取热点的节点从所有者获取值后保存在 hotCache 中，之后直接从本地返回。
+// 写入所有者时不通知副本，副本只保存 TTL，所有者更新后副本最多在这段时间内返回旧值。
+// hotCache 的容量为 cacheBytes/8，不包含在 Group 的 cacheBytes 中。
+
+const (
+	hotHeader = "X-Geecache-Hot" // HTTP 请求中表示热点 key
+
+	defaultHotReplicas = 2
+	defaultReplicaTTL  = time.Second
+
+	// hotLoadKey 从所有者获取副本时 singleflight 使用的前缀，失败时不影响同一个 key 的普通请求
+	hotLoadKey = "\x00hot\x00"
+)
+
+// HotKeyOptions 用于配置热点 key 的检测与复制，零值字段使用默认值
+type HotKeyOptions struct {
+	// Detector 热点检测的配置，默认 10s 内访问 100 次为热点
+	Detector hotkey.Options
+	// Replicas 除所有者外分担读取的副本数，默认为 2，为负数时所有节点都分担
+	Replicas int
+	// TTL 副本（包括按可用区保存的副本）的有效期，所有者更新后副本最多在这段时间内返回旧值，默认为 1s
+	TTL time.Duration
+}
+
+func (o *HotKeyOptions) fillDefaults() {
+	if o.Replicas == 0 {
+		o.Replicas = defaultHotReplicas
+	}
+	if o.TTL == 0 {
+		o.TTL = defaultReplicaTTL
+	}
+}
+
+// HotKeyPicker PickPeer 在多个副本之间分散热点 key 的读取时实现该接口，HTTPPool 实现了该接口
+type HotKeyPicker interface {
+	// Touch 记录一次读取，返回 key 是否为热点
+	Touch(key string) bool
+	// IsHot 判断 key 是否为热点，不记录读取
+	IsHot(key string) bool
+	// PickOwner 返回 key 的所有者，自己是所有者时返回 false
+	PickOwner(key string) (peerGetter PeerGetter, ok bool)
+	// ReplicaTTL 副本的有效期
+	ReplicaTTL() time.Duration
+}
+
+var _ HotKeyPicker = (*HTTPPool)(nil)
+
+// Touch 记录一次读取，返回 key 是否为热点，未配置 HotKeys 时总是返回 false
+func (p *HTTPPool) Touch(key string) bool {
+	return p.hot != nil && p.hot.Touch(key)
+}
+
+// IsHot 判断 key 是否为热点，未配置 HotKeys 时总是返回 false
+func (p *HTTPPool) IsHot(key string) bool {
+	return p.hot != nil && p.hot.IsHot(key)
+}
+
+// HotKeys 返回当前的热点 key，按访问次数从大到小排序
+func (p *HTTPPool) HotKeys() []hotkey.Item {
+	if p.hot == nil {
+		return nil
+	}
+	return p.hot.Hot()
+}
+
+// ReplicaTTL 返回副本的有效期，未配置 HotKeys 时（只按可用区保存副本）为 1s
+func (p *HTTPPool) ReplicaTTL() time.Duration {
+	if p.opts.HotKeys == nil {
+		return defaultReplicaTTL
+	}
+	return p.opts.HotKeys.TTL
+}
+
+// PickOwner 返回 key 在哈希环上的所有者，不考虑热点副本
+func (p *HTTPPool) PickOwner(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+		return p.httpGetters[peer], true
+	}
+	return nil, false
+}
+
+// pickReplica 在所有者和之后的副本中随机选择一个节点，有同一可用区的副本时只在其中选择，需要持有 p.mu
+func (p *HTTPPool) pickReplica(key string) string {
+	n := p.opts.HotKeys.Replicas + 1
+	if n <= 0 {
+		n = len(p.all)
+	}
+	replicas := p.replicaSet(key, n)
+	if local := p.localReplicas(replicas); len(local) > 0 {
+		replicas = local
+	}
+	return replicas[rand.Intn(len(replicas))]
+}
+
+// touch 记录一次读取，在查找缓存之前调用，命中缓存的读取同样计入热点检测
+func (g *Group) touch(key string) {
+	if hk, ok := g.peers.(HotKeyPicker); ok {
+		hk.Touch(key)
+	}
+}
+
+// isHot 判断 key 是否为热点
+func (g *Group) isHot(key string) bool {
+	hk, ok := g.peers.(HotKeyPicker)
+	return ok && hk.IsHot(key)
+}
+
+// getFromOwner PickPeer 为热点 key 或按可用区保存副本的 key 选择了自己作为副本时，
+// 从所有者获取值并保存，不回源；不从副本读取、自己是所有者或所有者不可用时返回 false
+func (g *Group) getFromOwner(key string) (ByteView, bool) {
+	if !g.isHot(key) && !g.zoneReplicated() {
+		return ByteView{}, false
+	}
+	return g.fetchFromOwner(key)
+}
+
+// fetchFromOwner 从所有者获取值并保存到 hotCache，请求中不标记热点，
+// 避免各节点的哈希环不一致时在副本之间互相转发
+func (g *Group) fetchFromOwner(key string) (ByteView, bool) {
+	hk, ok := g.peers.(HotKeyPicker)
+	if !ok {
+		return ByteView{}, false
+	}
+	peer, ok := hk.PickOwner(key)
+	if !ok {
+		return ByteView{}, false
+	}
+	v, err := g.getFromPeer(peer, key)
+	if err != nil {
+		log.Printf("[Group %s] 从所有者获取热点 %s 失败：%v", g.name, key, err)
+		return ByteView{}, false
+	}
+	g.stats.peerLoads.Add(1)
+	g.addReplica(key, v)
+	return v, true
+}
+
+// addReplica 将副本保存到 hotCache，有效期不超过 ReplicaTTL
+func (g *Group) addReplica(key string, v ByteView) {
+	ttl := defaultReplicaTTL
+	if hk, ok := g.peers.(HotKeyPicker); ok {
+		ttl = hk.ReplicaTTL()
+	}
+	if e := time.Now().Add(ttl); v.e.IsZero() || e.Before(v.e) {
+		v.e = e
+	}
+	g.hotCache.Add(key, v)
+}
+
+// getHotForPeer 处理其他节点对热点 key 的请求：自己作为副本时从所有者获取，而不是回源
+func (g *Group) getHotForPeer(key string) (ByteView, error) {
+	// 1.已经保存了副本
+	if v, ok := g.hotCache.Get(key); ok {
+		g.stats.serverRequests.Add(1)
+		return v, nil
+	}
+	// 2.自己是所有者，与普通请求相同
+	if _, ok := g.pickOwner(key); !ok {
+		return g.getForPeer(key)
+	}
+	// 3.自己是副本，从所有者获取，相同 key 的并发请求只获取一次；
+	// 所有者不可用时回源，结果也只作为副本保存，不写入 mainCache
+	g.stats.serverRequests.Add(1)
+	view, err := g.peerLoader.Do(hotLoadKey+key, func() (interface{}, error) {
+		if v, ok := g.fetchFromOwner(key); ok {
+			return v, nil
+		}
+		return g.loadReplica(key)
+	})
+	if err != nil {
+		return ByteView{}, err
+	}
+	return view.(ByteView), nil
+}
+
+// loadReplica 副本从所有者获取失败时回源，结果只保存在 hotCache 中，过期后再从所有者获取
+func (g *Group) loadReplica(key string) (ByteView, error) {
+	b, err := g.callGetter(key)
+	if err != nil {
+		g.stats.localLoadErrs.Add(1)
+		return ByteView{}, err
+	}
+	g.stats.localLoads.Add(1)
+	// 与 store 一样拷贝一份，回调函数之后复用缓冲区不会修改副本
+	v := g.newView(cloneBytes(b))
+	g.addReplica(key, v)
+	return v, nil
+}
@@ -0,0 +1,214 @@
+package geecache
+
+import (
+	pb "geecache/geecachepb"
+	"geecache/hotkey"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 测试热点 key 的读取分散到所有者和副本
+func TestHotKeyPickPeer(t *testing.T) {
+	self := "http://c.invalid"
+	p := NewHTTPPoolOpts(self, &HTTPPoolOptions{HotKeys: &HotKeyOptions{
+		Detector: hotkey.Options{Threshold: 5},
+		Replicas: -1,
+	}})
+	p.Set(self, "http://a.invalid", "http://b.invalid")
+	owner := p.peers.Get("sku-1")
+	picked := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		peer := self
+		p.Touch("sku-1") // Group.Get 在选择节点前记录读取
+		if g, ok := p.PickPeer("sku-1"); ok {
+			peer = g.(*httpGetter).peer
+		}
+		// 1.成为热点之前总是选择所有者
+		if i < 4 && peer != owner {
+			t.Fatalf("第 %d 次访问不是热点，应该选择所有者 %s，实际 %s", i+1, owner, peer)
+		}
+		picked[peer]++
+	}
+	// 2.成为热点后三个节点都会被选择
+	if len(picked) != 3 {
+		t.Fatalf("热点 key 应该分散到所有节点：%v", picked)
+	}
+	if !p.IsHot("sku-1") || p.IsHot("sku-2") {
+		t.Fatalf("热点判断错误")
+	}
+	if hot := p.HotKeys(); len(hot) != 1 || hot[0].Key != "sku-1" {
+		t.Fatalf("期望热点 sku-1，实际 %v", hot)
+	}
+}
+
+// 测试命中缓存的读取同样计入热点检测，持续读取时 key 一直是热点
+func TestHotKeySustained(t *testing.T) {
+	self := "http://self.invalid"
+	p := NewHTTPPoolOpts(self, &HTTPPoolOptions{HotKeys: &HotKeyOptions{
+		Detector: hotkey.Options{Threshold: 5, Window: 40 * time.Millisecond, Buckets: 2},
+	}})
+	p.Set(self)
+	g := newLocalGroup("hot-sustained", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), p)
+	for i := 0; i < 5; i++ {
+		g.Get("sku-1")
+	}
+	// 持续读取超过多个窗口，除第一次外都命中缓存
+	for deadline := time.Now().Add(200 * time.Millisecond); time.Now().Before(deadline); {
+		if _, err := g.Get("sku-1"); err != nil {
+			t.Fatal(err)
+		}
+		if !p.IsHot("sku-1") {
+			t.Fatalf("持续读取的 key 应该一直是热点")
+		}
+		time.Sleep(100 * time.Microsecond)
+	}
+	if st := g.Stats(); st.LocalLoads != 1 {
+		t.Fatalf("应该只回源一次，实际 %d 次", st.LocalLoads)
+	}
+}
+
+// 测试副本节点和读取热点的节点从所有者获取并保存副本，不再回源
+func TestHotKeyReplication(t *testing.T) {
+	// 1.所有者 A
+	var loads atomic.Int64
+	var poolA *HTTPPool
+	srvA := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		poolA.ServeHTTP(w, r)
+	}))
+	defer srvA.Close()
+	poolA = NewHTTPPool(srvA.URL)
+	groupA := NewGroup("hot-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		return []byte("stock-" + key), nil
+	}))
+
+	// 2.副本 R 收到标记为热点的请求，从 A 获取，之后直接返回副本
+	localGetter := GetterFunc(func(key string) ([]byte, error) {
+		t.Fatalf("不应该回源 %s", key)
+		return nil, nil
+	})
+	poolR := NewHTTPPoolOpts("http://r.invalid", &HTTPPoolOptions{HotKeys: &HotKeyOptions{}})
+	poolR.Set(srvA.URL)
+	groupR := newLocalGroup("hot-scores", localGetter, poolR)
+	for i := 0; i < 3; i++ {
+		if v, err := groupR.getHotForPeer("sku-1"); err != nil || v.String() != "stock-sku-1" {
+			t.Fatalf("期望 stock-sku-1，实际 %q，错误 %v", v.String(), err)
+		}
+	}
+	if got := groupA.Stats().ServerRequests; got != 1 {
+		t.Fatalf("副本只应该向所有者请求一次，实际 %d 次", got)
+	}
+
+	// 3.读取节点 C 在 key 成为热点后保存副本，不再访问所有者
+	poolC := NewHTTPPoolOpts("http://c.invalid", &HTTPPoolOptions{HotKeys: &HotKeyOptions{
+		Detector: hotkey.Options{Threshold: 3},
+	}})
+	poolC.Set(srvA.URL)
+	groupC := newLocalGroup("hot-scores", localGetter, poolC)
+	for i := 0; i < 10; i++ {
+		if v, err := groupC.Get("sku-2"); err != nil || v.String() != "stock-sku-2" {
+			t.Fatalf("期望 stock-sku-2，实际 %q，错误 %v", v.String(), err)
+		}
+	}
+	if got := groupA.Stats().ServerRequests; got != 1+3 {
+		t.Fatalf("成为热点后不应该再访问所有者，实际共 %d 次", got)
+	}
+	if loads.Load() != 2 {
+		t.Fatalf("每个 key 只应该回源一次，实际 %d 次", loads.Load())
+	}
+	// 4.写入或删除时清除副本
+	groupC.Remove("sku-2")
+	if _, ok := groupC.hotCache.Get("sku-2"); ok {
+		t.Fatalf("删除后不应该保留副本")
+	}
+
+	// 5.写入所有者后，副本最多在 TTL 内返回旧值
+	poolT := NewHTTPPoolOpts("http://t.invalid", &HTTPPoolOptions{HotKeys: &HotKeyOptions{TTL: 50 * time.Millisecond}})
+	poolT.Set(srvA.URL)
+	groupT := newLocalGroup("hot-scores", localGetter, poolT)
+	groupT.getHotForPeer("sku-3")
+	groupA.Set("sku-3", []byte("sold-out"))
+	if v, _ := groupT.getHotForPeer("sku-3"); v.String() != "stock-sku-3" {
+		t.Fatalf("TTL 内应该返回副本，实际 %q", v.String())
+	}
+	time.Sleep(60 * time.Millisecond)
+	if v, _ := groupT.getHotForPeer("sku-3"); v.String() != "sold-out" {
+		t.Fatalf("副本过期后应该从所有者获取新值，实际 %q", v.String())
+	}
+}
+
+// 测试所有者不可用时副本回源，结果只作为副本保存，不写入 mainCache；
+// 回调函数之后复用返回的缓冲区不影响副本
+func TestHotKeyOwnerUnavailable(t *testing.T) {
+	poolR := NewHTTPPoolOpts("http://r.invalid", &HTTPPoolOptions{HotKeys: &HotKeyOptions{}})
+	poolR.Set("http://owner.invalid")
+	buf := make([]byte, 64)
+	groupR := newLocalGroup("hot-fallback", GetterFunc(func(key string) ([]byte, error) {
+		return buf[:copy(buf, "origin-"+key)], nil
+	}), poolR)
+	if v, err := groupR.getHotForPeer("sku-1"); err != nil || v.String() != "origin-sku-1" {
+		t.Fatalf("期望 origin-sku-1，实际 %q，错误 %v", v.String(), err)
+	}
+	copy(buf, "reused-buffer")
+	if v, _ := groupR.hotCache.Get("sku-1"); v.String() != "origin-sku-1" {
+		t.Fatalf("复用缓冲区后副本被修改：%q", v.String())
+	}
+	if _, ok := groupR.mainCache.Get("sku-1"); ok {
+		t.Fatalf("副本回源的结果不应该写入 mainCache")
+	}
+	if v, ok := groupR.hotCache.Get("sku-1"); !ok || !v.Expire().Before(time.Now().Add(defaultReplicaTTL+time.Second)) {
+		t.Fatalf("副本回源的结果应该保存在 hotCache 中，并且有效期不超过 TTL")
+	}
+}
+
+// hotStreamPeer 总是将 key 视为热点，记录收到的流式请求
+type hotStreamPeer struct {
+	req *pb.Request
+}
+
+func (p *hotStreamPeer) PickPeer(key string) (PeerGetter, bool)  { return p, true }
+func (p *hotStreamPeer) PickOwner(key string) (PeerGetter, bool) { return p, true }
+func (p *hotStreamPeer) Touch(key string) bool                   { return true }
+func (p *hotStreamPeer) IsHot(key string) bool                   { return true }
+func (p *hotStreamPeer) ReplicaTTL() time.Duration               { return time.Second }
+
+func (p *hotStreamPeer) Get(in *pb.Request, out *pb.Response) error {
+	out.Value = []byte("owner-" + string(in.GetKey()))
+	return nil
+}
+
+func (p *hotStreamPeer) GetStream(in *pb.Request) (io.ReadCloser, error) {
+	p.req = in
+	return io.NopCloser(strings.NewReader("replica")), nil
+}
+
+// 测试流式读取热点 key 时标记热点，副本收到后从所有者获取，不回源
+func TestHotKeyStream(t *testing.T) {
+	peer := &hotStreamPeer{}
+	g := newLocalGroup("hot-stream", GetterFunc(func(key string) ([]byte, error) {
+		t.Fatalf("不应该回源 %s", key)
+		return nil, nil
+	}), peer)
+	rc, err := g.GetStream("sku-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+	if peer.req == nil || !peer.req.GetHot() {
+		t.Fatalf("热点 key 的流式请求应该标记热点：%v", peer.req)
+	}
+	_, r, _, err := g.streamForPeer("sku-2", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(r); string(b) != "owner-sku-2" {
+		t.Fatalf("副本应该从所有者获取，实际 %q", b)
+	}
+}
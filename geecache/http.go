@@ -1,38 +1,206 @@
 package geecache
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"geecache/breaker"
 	"geecache/consistenthash"
 	pb "geecache/geecachepb"
+	"geecache/hotkey"
 	"github.com/golang/protobuf/proto"
-	"io/ioutil"
+	"io"
 	"log"
+	"net"
 	"net/http"
-	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	defaultBasePath = "/_geecache/"
 	defaultReplicas = 50
+
+	defaultMaxIdleConnsPerHost   = 32
+	defaultDialTimeout           = 2 * time.Second
+	defaultResponseHeaderTimeout = 5 * time.Second
+	defaultRequestTimeout        = 10 * time.Second
+	defaultMaxResponseBytes      = 64 << 20
 )
 
 type HTTPPool struct {
 	self        string
 	basePath    string
+	opts        HTTPPoolOptions
+	client      *http.Client  // 所有 httpGetter 共享的 HTTP 客户端，复用连接池
+	certs       *certReloader // TLS 证书，未配置 TLS 时为 nil
+	auth        *hmacAuth     // 请求签名，未配置 HMAC 时为 nil
+	done        chan struct{} // 关闭后停止后台的健康检查
+	closeOnce   sync.Once
 	mu          sync.Mutex
-	peers       *consistenthash.Map    // 用于根据 key 选择节点
+	all         []string               // Set 传入的全部节点，包括被摘除的节点
+	peers       *consistenthash.Map    // 用于根据 key 选择节点，只包含健康的节点
 	httpGetters map[string]*httpGetter // 映射远程节点与对应的 httpGetter
+	leaving     bool                   // 调用了 Leave，自己不再在哈希环中
+	leftPeers   atomic.Int32           // 通知主动下线的节点数，为 0 时处理请求不需要检查来源节点
+	prevPeers   *consistenthash.Map    // 节点变化前的哈希环，过渡期内用于从之前的所有者预热
+	prevUntil   time.Time              // 过渡期的结束时间
+	hot         *hotkey.Detector       // 热点 key 检测，未配置 HotKeys 时为 nil
+	zones       map[string]string      // 节点所在的可用区，由 SetZones 设置
 	// 一个远程节点对应一个 httpGetter，因为 httpGetter 与远程节点的地址 baseURL 有关
 }
 
+// HTTPPoolOptions 用于配置 HTTPPool，零值字段使用默认值
+type HTTPPoolOptions struct {
+	// BasePath 节点间通信的路径前缀，默认为 "/_geecache/"
+	BasePath string
+	// Replicas 一致性哈希的虚拟节点倍数，默认为 50
+	Replicas int
+	// HashFn 一致性哈希使用的哈希函数，默认为 crc32.ChecksumIEEE
+	HashFn consistenthash.Hash
+
+	// Transport 自定义的 RoundTripper，设置后忽略下面的连接池、超时配置
+	Transport http.RoundTripper
+	// MaxIdleConnsPerHost 每个节点保持的空闲长连接数
+	MaxIdleConnsPerHost int
+	// DialTimeout 建立 TCP 连接的超时时间
+	DialTimeout time.Duration
+	// ResponseHeaderTimeout 发送请求后等待响应头的超时时间
+	ResponseHeaderTimeout time.Duration
+	// Timeout 单次请求的总超时时间（包括读取响应体），防止慢节点一直占用协程
+	Timeout time.Duration
+	// MaxResponseBytes 允许的最大响应体大小，超过则返回错误
+	MaxResponseBytes int64
+	// MaxKeyLength group 和 key 的最大字节数，超过时客户端直接返回错误，服务端返回 414
+	MaxKeyLength int
+
+	// Retry 请求失败时的重试策略，为 nil 时不重试
+	Retry *RetryPolicy
+	// Hedge 对冲请求策略，为 nil 时不发送对冲请求
+	Hedge *HedgePolicy
+	// HealthCheck 健康检查配置，为 nil 时不做健康检查，也不会摘除节点
+	HealthCheck *HealthCheckOptions
+	// Zone 本节点所在的可用区，其他节点的可用区通过 SetZones 设置；为空时不考虑拓扑
+	Zone string
+	// ZoneReplicas 每个 key 除所有者外的副本数，副本尽量分布在不同的可用区；
+	// 大于 0 且自己标记了可用区时，读取优先选择同一可用区的副本，为 0 时只读取所有者
+	ZoneReplicas int
+	// HotKeys 热点 key 的检测与复制，为 nil 时不检测
+	HotKeys *HotKeyOptions
+	// RebalanceWindow 节点变化后的过渡期，期间本节点新负责的 key 未命中时，先只查找之前的所有者的缓存，
+	// 命中则写入本地缓存，避免扩容时新的所有者全部回源；为 0 时不启用
+	RebalanceWindow time.Duration
+	// TLS 节点间通信的 TLS 配置，为 nil 时使用明文 HTTP
+	// 配置后节点地址应该使用 https:// 前缀，并使用 ServerTLSConfig 启动 HTTPS 服务
+	TLS *TLSOptions
+	// HMAC 节点间请求的签名配置，为 nil 时不签名也不校验
+	HMAC *HMACOptions
+	// AllowUnauthenticatedWrites 未配置 HMAC 或双向认证时也接受其他节点的写入（PUT）和下线通知，
+	// 任何能访问端口的人都可以借此修改缓存、将节点移出哈希环，只应在可信网络中使用
+	AllowUnauthenticatedWrites bool
+	// Breaker 每个远程节点的熔断器配置，为 nil 时不使用熔断器
+	// 熔断器打开时请求直接失败，Group.load 立即回退到本地加载，不必等待超时
+	Breaker *breaker.Options
+}
+
 // 初始化 HTTPPool
 func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
-		self:     self,
-		basePath: defaultBasePath,
+	return NewHTTPPoolOpts(self, nil)
+}
+
+// NewHTTPPoolOpts 使用自定义配置初始化 HTTPPool，o 为 nil 时全部使用默认值
+func NewHTTPPoolOpts(self string, o *HTTPPoolOptions) *HTTPPool {
+	p := &HTTPPool{self: self, done: make(chan struct{})}
+	if o != nil {
+		p.opts = *o
+	}
+	// 1.填充默认值
+	if p.opts.BasePath == "" {
+		p.opts.BasePath = defaultBasePath
+	}
+	if p.opts.Replicas == 0 {
+		p.opts.Replicas = defaultReplicas
+	}
+	if p.opts.MaxIdleConnsPerHost == 0 {
+		p.opts.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	if p.opts.DialTimeout == 0 {
+		p.opts.DialTimeout = defaultDialTimeout
+	}
+	if p.opts.ResponseHeaderTimeout == 0 {
+		p.opts.ResponseHeaderTimeout = defaultResponseHeaderTimeout
 	}
+	if p.opts.Timeout == 0 {
+		p.opts.Timeout = defaultRequestTimeout
+	}
+	if p.opts.MaxResponseBytes == 0 {
+		p.opts.MaxResponseBytes = defaultMaxResponseBytes
+	}
+	if p.opts.MaxKeyLength == 0 {
+		p.opts.MaxKeyLength = defaultMaxKeyLength
+	}
+	p.basePath = p.opts.BasePath
+	if p.opts.TLS != nil {
+		p.certs = newCertReloader(*p.opts.TLS)
+		if err := p.certs.load(); err != nil {
+			// 证书可能稍后才准备好，握手时会再次尝试加载
+			p.Log("加载 TLS 证书失败：%v", err)
+		}
+	}
+	if p.opts.HMAC != nil {
+		p.auth = newHMACAuth(p.opts.HMAC)
+	}
+	if p.opts.HotKeys != nil {
+		hk := *p.opts.HotKeys
+		hk.fillDefaults()
+		p.opts.HotKeys = &hk
+		p.hot = hotkey.New(&hk.Detector)
+	}
+	// 2.构造共享的 HTTP 客户端
+	p.client = &http.Client{
+		Transport: p.transport(),
+		Timeout:   p.opts.Timeout,
+	}
+	// 3.启动健康检查
+	if p.opts.HealthCheck != nil {
+		hc := *p.opts.HealthCheck
+		hc.fillDefaults()
+		p.opts.HealthCheck = &hc
+		go p.healthLoop()
+	}
+	return p
+}
+
+// Close 停止后台的健康检查，可以重复调用
+func (p *HTTPPool) Close() error {
+	p.closeOnce.Do(func() { close(p.done) })
+	return nil
+}
+
+// transport 返回节点间通信使用的 RoundTripper
+func (p *HTTPPool) transport() http.RoundTripper {
+	if p.opts.Transport != nil {
+		return p.opts.Transport
+	}
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   p.opts.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          p.opts.MaxIdleConnsPerHost * 8,
+		MaxIdleConnsPerHost:   p.opts.MaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		ResponseHeaderTimeout: p.opts.ResponseHeaderTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+		ForceAttemptHTTP2:     true,
+	}
+	if p.certs != nil {
+		t.TLSClientConfig = p.certs.clientConfig()
+	}
+	return t
 }
 
 // 日志打印方法
@@ -46,48 +214,97 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		// 前缀不匹配
 		panic("HTTPPoll 提供的路径不匹配：" + r.URL.Path)
 	}
-	p.Log("%s %s", r.Method, r.URL.Path)
-
-	// 2.获取请求路径中去掉前缀的部分
-	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
-	if len(parts) != 2 {
-		http.Error(w, "错误请求", http.StatusBadRequest)
-	}
-	// 约定访问路径为 /<basepath>/<groupname>/<key>
-	// 3.获取 groupname, key
-	groupName := parts[0]
-	key := parts[1]
-
-	// 4.通过名称尝试获取 group
-	group := GetGroup(groupName)
-	if group == nil {
-		http.Error(w, "未获取到 group："+groupName, http.StatusNotFound)
+	// 健康检查接口不需要签名，方便负载均衡器等外部系统探测
+	if r.URL.Path[len(p.basePath):] == healthPath {
+		p.serveHealth(w, r)
+		return
+	}
+	// 校验请求签名
+	if p.auth != nil {
+		if err := p.auth.verify(r); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+	// 来自主动下线后重新上线的节点的请求，将其重新加入哈希环
+	p.peerSeen(r)
+	// 统计信息、下线通知接口
+	switch r.URL.Path[len(p.basePath):] {
+	case statsPath:
+		p.serveStats(w, r)
+		return
+	case leavePath:
+		p.serveLeave(w, r)
 		return
 	}
+	if r.Method == http.MethodPut {
+		p.serveSet(w, r)
+		return
+	}
+	p.Log("%s %s", r.Method, r.URL.Path)
 
-	// 5.group 不为 nil, 尝试获取 key
-	view, err := group.Get(key)
+	// 2.获取请求路径中去掉前缀的部分
+	// 约定访问路径为 /<basepath>/<base64(groupname)>/<base64(key)>
+	// 3.解码 groupname, key
+	groupName, key, err := decodePeerPath(r.URL.Path[len(p.basePath):])
+	var res *pb.Response
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		res = errorResponse(p.self, pb.Code_BAD_REQUEST, err)
+	} else if r.Header.Get(streamHeader) == "1" {
+		// 流式请求成功时响应体为原始的值，失败时与普通请求一样返回错误码
+		if res = p.serveStream(w, &pb.Request{Group: groupName, Key: key, Hot: r.Header.Get(hotHeader) == "1"}); res == nil {
+			return
+		}
+	} else {
+		// 4.查找 group 和 key，错误通过响应中的错误码返回
+		// 来自其他节点的请求只在本地查找或回源，不再转发，避免节点间环形转发，
+		// 也让收到对冲请求的副本节点可以直接返回结果
+		res = serveGet(p.self, &pb.Request{
+			Group:          groupName,
+			Key:            key,
+			AcceptEncoding: parseAcceptEncoding(r.Header.Get("Accept-Encoding")),
+			Peek:           r.Header.Get(peekHeader) == "1",
+			Hot:            r.Header.Get(hotHeader) == "1",
+		}, p.opts.MaxKeyLength)
 	}
 
 	// 引入 protobuf，使用 proto.Marshal() 编码 HTTP 响应
-	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice()})
+	body, err := proto.Marshal(res)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// 6.到这里，获取到了缓存，设置响应头，返回类型为文件字节流
+	// 5.设置响应头，返回类型为文件字节流，出错时状态码与错误码对应，响应体同样是 pb.Response
 	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Vary", "Accept-Encoding")
+	w.WriteHeader(httpStatus(res.GetCode()))
 	w.Write(body)
-
 }
 
 // HTTP 客户端类 httpGetter
 type httpGetter struct {
-	baseURL string
+	peer         string    // 远程节点地址
+	pool         *HTTPPool // 所属的 HTTPPool，用于上报请求结果，可以为 nil
+	baseURL      string
+	client       *http.Client     // 由 HTTPPool 统一创建，复用连接
+	maxBytes     int64            // 允许的最大响应体大小
+	maxKeyLength int              // group 和 key 的长度上限
+	retry        *RetryPolicy     // 重试策略，可以为 nil
+	breaker      *breaker.Breaker // 熔断器，可以为 nil
+	auth         *hmacAuth        // 请求签名，可以为 nil
+
+	latency latencyTracker // 最近的请求耗时，用于计算对冲阈值
+	hedges  atomic.Int64   // 对该节点发起对冲请求的次数
+
+	requests atomic.Int64 // 请求次数
+	errors   atomic.Int64 // 失败次数
+	health   peerHealth   // 健康状态，由 pool.mu 保护
+}
+
+// bufferPool 复用读取响应体的缓冲区，避免每次请求都分配新的内存
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
 }
 
 // httpGetter 实现 PeerGetter接口
@@ -97,31 +314,128 @@ var _ PeerGetter = (*httpGetter)(nil)
 // 可以在编译时检查 httpGetter 是否实现 PeerGetter 接口
 
 func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
-	// 1.拼接访问路径，为了安全使用 url.QueryEscape 对字符串进行转义
-	u := fmt.Sprintf(
-		"%v%v/%v",
-		h.baseURL,
-		url.QueryEscape(in.GetGroup()),
-		url.QueryEscape(in.GetKey()))
-	res, err := http.Get(u) // 获取请求响应
+	return h.get(context.Background(), in, out)
+}
+
+// get 按照重试策略访问远程节点，ctx 取消时立即返回
+func (h *httpGetter) get(ctx context.Context, in *pb.Request, out *pb.Response) (err error) {
+	if h.pool != nil {
+		defer func() { h.pool.observe(h, err) }()
+	}
+	attempts := 1
+	if h.retry != nil && h.retry.Attempts > 1 {
+		attempts = h.retry.Attempts
+	}
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			if !h.retry.retryable(err) {
+				return err
+			}
+			if serr := sleepContext(ctx, h.retry.backoff(i)); serr != nil {
+				return err
+			}
+		}
+		start := time.Now()
+		if err = h.doOnce(ctx, in, out); err == nil {
+			h.latency.record(time.Since(start))
+			return nil
+		}
+	}
+	return err
+}
+
+// doOnce 在熔断器的保护下向远程节点发送一次请求
+func (h *httpGetter) doOnce(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	if h.breaker == nil {
+		return h.getOnce(ctx, in, out)
+	}
+	return h.breaker.Do(func() error {
+		return h.getOnce(ctx, in, out)
+	})
+}
+
+// newRequest 构造访问远程节点的请求，stream 为 true 时请求以流的形式返回原始的值
+func (h *httpGetter) newRequest(ctx context.Context, in *pb.Request, stream bool) (*http.Request, error) {
+	// 拼接访问路径，group 和 key 使用 base64url 编码，支持任意字节序列
+	if err := checkKeyLength(in.GetGroup(), in.GetKey(), h.maxKeyLength); err != nil {
+		return nil, err
+	}
+	u := h.baseURL + encodePeerPath(in.GetGroup(), in.GetKey())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	h.setPeerHeader(req)
+	if stream {
+		req.Header.Set(streamHeader, "1")
+	}
+	if in.GetPeek() {
+		req.Header.Set(peekHeader, "1")
+	}
+	if in.GetHot() {
+		req.Header.Set(hotHeader, "1")
+	}
+	// 协商压缩算法：压缩过的缓存值可以原样传输，由请求方解压，
+	// 显式设置 Accept-Encoding 后 http.Transport 不会再自动解压响应体
+	if len(in.GetAcceptEncoding()) > 0 {
+		req.Header.Set("Accept-Encoding", strings.Join(in.GetAcceptEncoding(), ", "))
+	}
+	if h.auth != nil {
+		if err = h.auth.sign(req, nil); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// readError 读取状态码不是 OK 的响应，响应体中可能带有错误码，旧版本的节点返回的是纯文本
+func (h *httpGetter) readError(res *http.Response) error {
+	se := &statusError{code: res.StatusCode}
+	body, err := io.ReadAll(io.LimitReader(res.Body, h.maxBytes))
+	if err != nil {
+		return se
+	}
+	errRes := &pb.Response{}
+	if proto.Unmarshal(body, errRes) == nil {
+		se.err = responseError(errRes)
+	}
+	return se
+}
+
+// getOnce 向远程节点发送一次请求
+func (h *httpGetter) getOnce(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	// 1.构造请求
+	req, err := h.newRequest(ctx, in, false)
+	if err != nil {
+		return err
+	}
+	res, err := h.client.Do(req) // 获取请求响应
 	// 2.请求是否异常
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
-	// 3.请求正常，判断响应状态码是否 OK
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("服务端返回：%v", res.StatusCode)
+		return h.readError(res)
 	}
-
-	bytes, err := ioutil.ReadAll(res.Body)
-	// 4.状态码 OK，判断响应体是否为空
-	if err != nil {
+	// 3.检查响应体大小
+	if res.ContentLength > h.maxBytes {
+		return fmt.Errorf("响应体过大：%d 字节，上限 %d 字节", res.ContentLength, h.maxBytes)
+	}
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer bufferPool.Put(buf)
+	// 多读一个字节用于判断是否超过上限
+	if _, err = buf.ReadFrom(io.LimitReader(res.Body, h.maxBytes+1)); err != nil {
 		return fmt.Errorf("获取响应体：%v", err)
 	}
+	if int64(buf.Len()) > h.maxBytes {
+		return fmt.Errorf("响应体过大：超过上限 %d 字节", h.maxBytes)
+	}
 
 	// 引入 protobuf，使用 proto.Unmarshal() 解码 HTTP 响应
-	if err = proto.Unmarshal(bytes, out); err != nil {
+	// Unmarshal 会拷贝 bytes 字段，因此缓冲区可以安全地放回 bufferPool
+	if err = proto.Unmarshal(buf.Bytes(), out); err != nil {
 		return fmt.Errorf("解码响应体：%v", err)
 	}
 	return nil
@@ -131,25 +445,114 @@ func (p *HTTPPool) Set(peers ...string) {
 	// 1.上锁
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	// 2.实例化一致性哈希算法
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
-	// 3.添加传入的节点
+	// 2.添加传入的节点，仍然存在的节点保留原来的 httpGetter（健康状态、熔断器、统计信息），
+	// 正在进行的请求不受影响，连接由共享的 HTTP 客户端复用
+	old, oldAll, oldRing := p.httpGetters, p.all, p.peers
+	p.all = append([]string(nil), peers...)
 	p.httpGetters = make(map[string]*httpGetter, len(peers))
 	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+		if g, ok := old[peer]; ok {
+			p.httpGetters[peer] = g
+			continue
+		}
+		p.httpGetters[peer] = &httpGetter{
+			peer:         peer,
+			pool:         p,
+			baseURL:      peer + p.basePath,
+			client:       p.client,
+			maxBytes:     p.opts.MaxResponseBytes,
+			maxKeyLength: p.opts.MaxKeyLength,
+			retry:        p.opts.Retry,
+			breaker:      p.newBreaker(peer),
+			auth:         p.auth,
+		}
+	}
+	// 3.重新统计主动下线的节点，实例化一致性哈希算法
+	var left int32
+	for _, g := range p.httpGetters {
+		if g.health.left {
+			left++
+		}
 	}
+	p.leftPeers.Store(left)
+	p.rebuildRing()
+	// 4.节点集合变化时保存原来的哈希环，过渡期内新的所有者先从之前的所有者预热
+	p.recordPrevious(oldAll, oldRing)
+}
+
+// newBreaker 为远程节点创建熔断器，未配置熔断器时返回 nil
+func (p *HTTPPool) newBreaker(peer string) *breaker.Breaker {
+	if p.opts.Breaker == nil {
+		return nil
+	}
+	o := *p.opts.Breaker
+	if o.IsFailure == nil {
+		o.IsFailure = isPeerFailure
+	}
+	onChange := o.OnStateChange
+	o.OnStateChange = func(from, to breaker.State) {
+		p.Log("节点 %s 的熔断器：%s -> %s", peer, from, to)
+		if onChange != nil {
+			onChange(from, to)
+		}
+	}
+	return breaker.New(o)
+}
+
+// rebuildRing 使用未被摘除的节点重建哈希环，需要持有 p.mu
+func (p *HTTPPool) rebuildRing() {
+	peers := consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	for _, peer := range p.all {
+		// 被摘除、主动下线的节点不在哈希环中，自己主动下线后也不再负责任何 key
+		h := &p.httpGetters[peer].health
+		if h.ejected || h.left || (p.leaving && peer == p.self) {
+			continue
+		}
+		peers.Add(peer)
+	}
+	p.peers = peers
 }
 
 var _ PeerPicker = (*HTTPPool)(nil)
 
 // 根据 key 选择对应的节点，由节点得到对应的 HTTP 客户端
 func (p *HTTPPool) PickPeer(key string) (peerGetter PeerGetter, ok bool) {
+	hot := p.IsHot(key) // 读取次数由 Group.Get 等调用 Touch 统计，这里不重复计数
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if peer := p.peers.Get(key); peer != "" || peer != p.self {
+	if p.peers == nil {
+		return nil, false
+	}
+	peer := p.peers.Get(key)
+	// 热点 key 在所有者和副本之间分散读取，其他 key 优先读取同一可用区的副本
+	if hot && peer != "" {
+		peer = p.pickReplica(key)
+	} else if p.zoneReplicated() && peer != "" {
+		peer = p.pickZoneReplica(key, peer)
+	}
+	if peer != "" && peer != p.self {
 		p.Log("选择节点 %s", peer)
-		return p.httpGetters[peer], true
+		getter := p.httpGetters[peer]
+		if p.opts.Hedge != nil {
+			if backup := p.pickBackup(key, peer); backup != nil {
+				return &hedgedGetter{primary: getter, backup: backup, policy: p.opts.Hedge}, true
+			}
+		}
+		return getter, true
 	}
 	return nil, false
 }
+
+// pickBackup 沿哈希环为 key 选择除主节点和自己以外的下一个副本节点，需要持有 p.mu
+func (p *HTTPPool) pickBackup(key, primary string) *httpGetter {
+	// 标记了可用区时副本分布在不同的可用区，优先选择同一可用区的副本
+	replicas := p.replicaSet(key, 3)
+	for _, peers := range [][]string{p.localReplicas(replicas), replicas} {
+		for _, peer := range peers {
+			if peer != primary && peer != p.self {
+				return p.httpGetters[peer]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package geecache
+
+import (
+	"errors"
+	"fmt"
+	"geecache/breaker"
+	pb "geecache/geecachepb"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 测试通过 HTTPPool 从远程节点获取缓存值
+func TestHTTPPoolGet(t *testing.T) {
+	NewGroup("http-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value-" + key), nil
+	}))
+	// 1.远程节点
+	remote := httptest.NewServer(NewHTTPPool("remote"))
+	defer remote.Close()
+	// 2.本地节点只知道远程节点，PickPeer 一定会选择远程节点
+	local := NewHTTPPool("local")
+	local.Set(remote.URL)
+	peer, ok := local.PickPeer("Tom")
+	if !ok {
+		t.Fatalf("应该选择远程节点")
+	}
+	res := &pb.Response{}
+	if err := peer.Get(&pb.Request{Group: []byte("http-scores"), Key: []byte("Tom")}, res); err != nil {
+		t.Fatalf("获取远程缓存失败：%v", err)
+	}
+	if string(res.GetValue()) != "value-Tom" {
+		t.Fatalf("期望 value-Tom，实际 %q", res.GetValue())
+	}
+}
+
+// 测试 PickPeer 不会选择自己
+func TestHTTPPoolPickSelf(t *testing.T) {
+	p := NewHTTPPool("http://self")
+	p.Set("http://self")
+	if _, ok := p.PickPeer("Tom"); ok {
+		t.Fatalf("不应该选择自己")
+	}
+}
+
+// 测试重新 Set 时保留仍然存在的节点的 httpGetter
+func TestHTTPPoolSetKeepsGetters(t *testing.T) {
+	p := NewHTTPPool("http://self")
+	p.Set("http://a", "http://b")
+	a := p.httpGetters["http://a"]
+	p.Set("http://a", "http://c")
+	if p.httpGetters["http://a"] != a {
+		t.Fatalf("仍然存在的节点应该保留原来的 httpGetter")
+	}
+	if _, ok := p.httpGetters["http://b"]; ok || p.httpGetters["http://c"] == nil {
+		t.Fatalf("应该删除 b 并创建 c")
+	}
+}
+
+// 测试慢节点会在超时时间内返回错误，而不是一直阻塞
+func TestHTTPGetterTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	p := NewHTTPPoolOpts("local", &HTTPPoolOptions{Timeout: 50 * time.Millisecond})
+	p.Set(slow.URL)
+	peer, _ := p.PickPeer("Tom")
+	start := time.Now()
+	err := peer.Get(&pb.Request{Group: []byte("g"), Key: []byte("Tom")}, &pb.Response{})
+	if err == nil {
+		t.Fatalf("慢节点应该返回超时错误")
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Fatalf("超时未生效，耗时 %v", elapsed)
+	}
+}
+
+// 测试响应体超过上限时返回错误
+func TestHTTPGetterMaxResponseBytes(t *testing.T) {
+	big := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 不设置 Content-Length，强制客户端边读边检查
+		w.(http.Flusher).Flush()
+		fmt.Fprint(w, strings.Repeat("x", 1024))
+	}))
+	defer big.Close()
+
+	p := NewHTTPPoolOpts("local", &HTTPPoolOptions{MaxResponseBytes: 16})
+	p.Set(big.URL)
+	peer, _ := p.PickPeer("Tom")
+	err := peer.Get(&pb.Request{Group: []byte("g"), Key: []byte("Tom")}, &pb.Response{})
+	if err == nil || !strings.Contains(err.Error(), "响应体过大") {
+		t.Fatalf("期望响应体过大错误，实际 %v", err)
+	}
+}
+
+// 测试熔断器打开后请求直接失败，不再访问远程节点
+func TestHTTPGetterBreaker(t *testing.T) {
+	var calls int32
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	p := NewHTTPPoolOpts("local", &HTTPPoolOptions{
+		Breaker: &breaker.Options{MinRequests: 2, OpenTimeout: time.Minute},
+	})
+	p.Set(broken.URL)
+	peer, _ := p.PickPeer("Tom")
+	for i := 0; i < 3; i++ {
+		peer.Get(&pb.Request{Group: []byte("g"), Key: []byte("Tom")}, &pb.Response{})
+	}
+	err := peer.Get(&pb.Request{Group: []byte("g"), Key: []byte("Tom")}, &pb.Response{})
+	if !errors.Is(err, breaker.ErrOpen) {
+		t.Fatalf("熔断器打开后应该返回 ErrOpen，实际 %v", err)
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("熔断器打开后不应该再访问远程节点，实际访问 %d 次", calls)
+	}
+	if s := p.Stats()[broken.URL]; s.Breaker != "open" || s.Trips != 1 {
+		t.Fatalf("统计信息应该包含熔断器状态：%+v", s)
+	}
+}
+
+// 测试所有者回源失败不会打开该节点的熔断器
+func TestHTTPGetterBreakerIgnoresOriginErrors(t *testing.T) {
+	var loads int32
+	NewGroup("breaker-origin", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		return nil, errors.New("数据库不可用")
+	}))
+	remote := httptest.NewServer(NewHTTPPool("remote"))
+	defer remote.Close()
+
+	p := NewHTTPPoolOpts("local", &HTTPPoolOptions{
+		Breaker: &breaker.Options{MinRequests: 2, OpenTimeout: time.Minute},
+	})
+	p.Set(remote.URL)
+	peer, _ := p.PickPeer("Tom")
+	for i := 0; i < 4; i++ {
+		err := peer.Get(&pb.Request{Group: []byte("breaker-origin"), Key: []byte("Tom")}, &pb.Response{})
+		if err == nil || errors.Is(err, breaker.ErrOpen) {
+			t.Fatalf("期望回源错误，实际 %v", err)
+		}
+	}
+	if atomic.LoadInt32(&loads) != 4 {
+		t.Fatalf("每次请求都应该到达所有者，实际 %d 次", loads)
+	}
+	if s := p.Stats()[remote.URL]; s.Breaker != "closed" || s.Trips != 0 {
+		t.Fatalf("回源失败不应该打开熔断器：%+v", s)
+	}
+}
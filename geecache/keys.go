@@ -0,0 +1,45 @@
+package geecache
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// 节点间请求路径中 group 和 key 的长度上限（编码前的字节数）
+const defaultMaxKeyLength = 4096
+
+// ErrKeyTooLong key 或 group 的长度超过上限
+var ErrKeyTooLong = fmt.Errorf("key 长度超过上限")
+
+// 约定访问路径为 /<basepath>/<base64(group)>/<base64(key)>
+// 使用不带填充的 base64url 编码：编码结果只包含 [A-Za-z0-9-_]，不会被 URL 转义，
+// 包含 /、+、空格、% 甚至非 UTF-8 的任意字节序列都能原样往返
+
+// encodePeerPath 将 group 和 key 编码为请求路径中 basePath 之后的部分
+func encodePeerPath(group, key []byte) string {
+	return base64.RawURLEncoding.EncodeToString(group) + "/" + base64.RawURLEncoding.EncodeToString(key)
+}
+
+// decodePeerPath 从请求路径中 basePath 之后的部分解码出 group 和 key
+func decodePeerPath(path string) (group, key []byte, err error) {
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 {
+		return nil, nil, fmt.Errorf("错误请求：%q", path)
+	}
+	if group, err = base64.RawURLEncoding.DecodeString(parts[0]); err != nil {
+		return nil, nil, fmt.Errorf("解码 group：%v", err)
+	}
+	if key, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return nil, nil, fmt.Errorf("解码 key：%v", err)
+	}
+	return group, key, nil
+}
+
+// checkKeyLength 检查 group 和 key 的长度
+func checkKeyLength(group, key []byte, max int) error {
+	if len(group) > max || len(key) > max {
+		return fmt.Errorf("%w：%d 字节", ErrKeyTooLong, max)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package geecache
+
+import (
+	"bytes"
+	"errors"
+	pb "geecache/geecachepb"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var binaryKeys = []string{
+	"a/b/c",
+	"a+b c",
+	"100%",
+	"%2F",
+	"?x=1#frag",
+	"..",
+	"中文",
+	"\xff\xfe\x00\x01",
+	"",
+}
+
+// 测试任意字节序列经过真实的 URL 解析后都能原样往返
+func FuzzPeerPathRoundTrip(f *testing.F) {
+	for _, k := range binaryKeys {
+		f.Add([]byte("scores/"+k), []byte(k))
+	}
+	f.Fuzz(func(t *testing.T, group, key []byte) {
+		r := httptest.NewRequest(http.MethodGet, "http://peer"+defaultBasePath+encodePeerPath(group, key), nil)
+		gotGroup, gotKey, err := decodePeerPath(r.URL.Path[len(defaultBasePath):])
+		if err != nil {
+			t.Fatalf("解码失败：%v", err)
+		}
+		if !bytes.Equal(gotGroup, group) || !bytes.Equal(gotKey, key) {
+			t.Fatalf("往返后不一致：%q/%q -> %q/%q", group, key, gotGroup, gotKey)
+		}
+	})
+}
+
+// 测试包含特殊字符的 group 和 key 可以通过节点间协议正确获取
+func TestBinaryKeysOverHTTP(t *testing.T) {
+	groupName := "scores/binary \xff"
+	NewGroup(groupName, 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value:" + key), nil
+	}))
+	remote := httptest.NewServer(NewHTTPPool("remote"))
+	defer remote.Close()
+	local := NewHTTPPool("local")
+	local.Set(remote.URL)
+
+	for _, key := range binaryKeys[:len(binaryKeys)-1] {
+		peer, _ := local.PickPeer(key)
+		res := &pb.Response{}
+		if err := peer.Get(&pb.Request{Group: []byte(groupName), Key: []byte(key)}, res); err != nil {
+			t.Fatalf("获取 %q 失败：%v", key, err)
+		}
+		if string(res.GetValue()) != "value:"+key {
+			t.Fatalf("key %q 被篡改：%q", key, res.GetValue())
+		}
+	}
+}
+
+// 测试超长的 key 在客户端和服务端都会被拒绝
+func TestKeyTooLong(t *testing.T) {
+	remote := httptest.NewServer(NewHTTPPoolOpts("remote", &HTTPPoolOptions{MaxKeyLength: 8}))
+	defer remote.Close()
+
+	local := NewHTTPPoolOpts("local", &HTTPPoolOptions{MaxKeyLength: 8})
+	local.Set(remote.URL)
+	peer, _ := local.PickPeer("k")
+	long := []byte(strings.Repeat("k", 9))
+	err := peer.Get(&pb.Request{Group: []byte("g"), Key: long}, &pb.Response{})
+	if !errors.Is(err, ErrKeyTooLong) {
+		t.Fatalf("客户端应该拒绝超长的 key，实际 %v", err)
+	}
+
+	// 绕过客户端的检查，服务端返回 414
+	res, err := http.Get(remote.URL + defaultBasePath + encodePeerPath([]byte("g"), long))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusRequestURITooLong {
+		t.Fatalf("服务端应该返回 414，实际 %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,113 @@
+package limiter
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrQueueFull 等待队列已满
+	ErrQueueFull = errors.New("等待队列已满")
+	// ErrTimeout 排队等待超时
+	ErrTimeout = errors.New("排队等待超时")
+	// ErrRateLimited 超过速率限制
+	ErrRateLimited = errors.New("超过速率限制")
+)
+
+// Bulkhead 舱壁隔离：限制同时执行的任务数，超出的任务进入有界队列等待
+type Bulkhead struct {
+	sem      chan struct{} // 容量即最大并发数
+	maxQueue int64
+	waiting  atomic.Int64 // 正在排队的任务数
+	timeout  time.Duration
+}
+
+// NewBulkhead 创建舱壁，maxConcurrent 为最大并发数，maxQueue 为最大排队数，
+// timeout 为排队的最长时间，为 0 表示一直等待
+func NewBulkhead(maxConcurrent, maxQueue int, timeout time.Duration) *Bulkhead {
+	return &Bulkhead{
+		sem:      make(chan struct{}, maxConcurrent),
+		maxQueue: int64(maxQueue),
+		timeout:  timeout,
+	}
+}
+
+// Acquire 申请一个执行名额，成功后必须调用 release 归还
+func (b *Bulkhead) Acquire() (release func(), err error) {
+	release = func() { <-b.sem }
+	// 1.有空闲名额直接返回
+	select {
+	case b.sem <- struct{}{}:
+		return release, nil
+	default:
+	}
+	// 2.没有空闲名额，进入等待队列
+	if b.waiting.Add(1) > b.maxQueue {
+		b.waiting.Add(-1)
+		return nil, ErrQueueFull
+	}
+	defer b.waiting.Add(-1)
+	if b.timeout <= 0 {
+		b.sem <- struct{}{}
+		return release, nil
+	}
+	t := time.NewTimer(b.timeout)
+	defer t.Stop()
+	select {
+	case b.sem <- struct{}{}:
+		return release, nil
+	case <-t.C:
+		return nil, ErrTimeout
+	}
+}
+
+// InFlight 返回正在执行的任务数
+func (b *Bulkhead) InFlight() int {
+	return len(b.sem)
+}
+
+// Waiting 返回正在排队的任务数
+func (b *Bulkhead) Waiting() int {
+	return int(b.waiting.Load())
+}
+
+// TokenBucket 令牌桶限流器
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // 每秒生成的令牌数
+	burst  float64 // 桶的容量
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket 创建令牌桶，初始时桶是满的
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Allow 尝试取走一个令牌，没有令牌时返回 false
+func (tb *TokenBucket) Allow() bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	now := time.Now()
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
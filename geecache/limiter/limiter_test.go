@@ -0,0 +1,54 @@
+package limiter
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// 测试舱壁的并发数、排队数和排队超时
+func TestBulkhead(t *testing.T) {
+	b := NewBulkhead(1, 1, 20*time.Millisecond)
+	release, err := b.Acquire()
+	if err != nil {
+		t.Fatalf("第一个任务应该直接执行：%v", err)
+	}
+	// 1.第二个任务排队，第三个任务队列已满
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var queuedErr error
+	go func() {
+		defer wg.Done()
+		_, queuedErr = b.Acquire()
+	}()
+	for b.Waiting() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := b.Acquire(); err != ErrQueueFull {
+		t.Fatalf("队列已满应该返回 ErrQueueFull，实际 %v", err)
+	}
+	// 2.排队超时
+	wg.Wait()
+	if queuedErr != ErrTimeout {
+		t.Fatalf("排队超时应该返回 ErrTimeout，实际 %v", queuedErr)
+	}
+	// 3.归还名额后可以继续执行
+	release()
+	if _, err := b.Acquire(); err != nil {
+		t.Fatalf("归还名额后应该可以执行：%v", err)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	tb := NewTokenBucket(100, 2)
+	if !tb.Allow() || !tb.Allow() {
+		t.Fatalf("初始时桶应该是满的")
+	}
+	if tb.Allow() {
+		t.Fatalf("令牌用完后应该限流")
+	}
+	time.Sleep(15 * time.Millisecond)
+	if !tb.Allow() {
+		t.Fatalf("一段时间后应该生成新的令牌")
+	}
+}
@@ -81,3 +81,28 @@ func (c *Cache) Add(key string, value Value) {
 		c.RemoveOldest()
 	}
 }
+
+// Remove 删除 key 对应的节点，主动删除不属于淘汰，不会调用 OnEvicted
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.ll.Remove(ele)
+		kv := ele.Value.(*entry)
+		delete(c.cache, kv.key)
+		c.nBytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	}
+}
+
+// Bytes 返回当前占用的内存
+func (c *Cache) Bytes() int64 {
+	return c.nBytes
+}
+
+// Range 从最近访问到最久未访问依次调用 fn，fn 返回 false 时停止，不改变访问顺序
+func (c *Cache) Range(fn func(key string, value Value) bool) {
+	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
+		kv := ele.Value.(*entry)
+		if !fn(kv.key, kv.value) {
+			return
+		}
+	}
+}
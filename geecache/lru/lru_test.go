@@ -1,6 +1,8 @@
 package lru
 
 import (
+	"bytes"
+	"errors"
 	"reflect"
 	"testing"
 )
@@ -56,3 +58,98 @@ func TestOnEvicted(t *testing.T) {
 		t.Fatalf("Call OnEvicted failed, expect keys equals to %s", expect)
 	}
 }
+
+// 测试 Remove 方法
+func TestRemove(t *testing.T) {
+	evicted := false
+	lru := New(int64(0), func(string, Value) { evicted = true })
+	lru.Add("key1", String("1234"))
+	lru.Remove("key1")
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 0 || lru.Bytes() != 0 {
+		t.Fatalf("Remove失败")
+	}
+	if evicted {
+		t.Fatalf("Remove 不应该调用 OnEvicted")
+	}
+}
+
+// 测试 Range 方法：从最近访问到最久未访问遍历
+func TestRange(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("k1", String("1"))
+	lru.Add("k2", String("2"))
+	lru.Add("k3", String("3"))
+	lru.Get("k1")
+	var keys []string
+	lru.Range(func(key string, value Value) bool {
+		keys = append(keys, key)
+		return len(keys) < 2
+	})
+	if expect := []string{"k1", "k3"}; !reflect.DeepEqual(keys, expect) {
+		t.Fatalf("Range 失败，期望 %v，实际 %v", expect, keys)
+	}
+}
+
+// 测试快照按访问顺序保存和恢复，跳过指定的条目，只恢复放得下的最近访问的条目
+func TestSnapshot(t *testing.T) {
+	lru := New(int64(0), nil)
+	for _, k := range []string{"k1", "k2", "k3", "k4"} {
+		lru.Add(k, String("v"+k[1:]))
+	}
+	lru.Get("k1")
+	var buf bytes.Buffer
+	encode := func(key string, value Value) ([]byte, bool) {
+		return []byte(value.(String)), key != "k2"
+	}
+	if n, err := lru.Snapshot(&buf, encode); err != nil || n != 3 {
+		t.Fatalf("Snapshot 失败：%d，%v", n, err)
+	}
+	decode := func(key string, data []byte) (Value, bool) {
+		return String(data), true
+	}
+	// 1.容量只够两个条目，恢复最近访问的 k4、k1
+	restored := New(int64(8), nil)
+	if n, err := restored.Restore(bytes.NewReader(buf.Bytes()), decode); err != nil || n != 2 {
+		t.Fatalf("Restore 失败：%d，%v", n, err)
+	}
+	var keys []string
+	restored.Range(func(key string, value Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if expect := []string{"k1", "k4"}; !reflect.DeepEqual(keys, expect) {
+		t.Fatalf("Restore 失败，期望 %v，实际 %v", expect, keys)
+	}
+	// 2.损坏的快照不修改缓存
+	data := append([]byte(nil), buf.Bytes()...)
+	data[10] ^= 0xff
+	empty := New(int64(0), nil)
+	if _, err := empty.Restore(bytes.NewReader(data), decode); !errors.Is(err, ErrBadSnapshot) || empty.Len() != 0 {
+		t.Fatalf("损坏的快照应该返回 ErrBadSnapshot：%v", err)
+	}
+}
+
+// failingWriter 写入超过 n 字节后返回错误
+type failingWriter struct{ n int }
+
+var errWrite = errors.New("磁盘已满")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, errWrite
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+// 测试写入失败时返回错误，不会把截断的快照当作成功
+func TestWriteSnapshotError(t *testing.T) {
+	entries := []SnapshotEntry{{"k1", bytes.Repeat([]byte("a"), 5000)}, {"k2", bytes.Repeat([]byte("b"), 5000)}}
+	for _, limit := range []int{0, 100, 6000, 10010} {
+		if _, err := WriteSnapshot(&failingWriter{n: limit}, entries); !errors.Is(err, errWrite) {
+			t.Fatalf("写入 %d 字节后失败时应该返回错误，实际 %v", limit, err)
+		}
+	}
+}
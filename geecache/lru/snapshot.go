@@ -0,0 +1,225 @@
+package lru
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// 快照的格式：
+//
+//	magic "GLRU" | 版本号 uint16 |
+//	条目：1 | uvarint(len(key)) | key | uvarint(len(data)) | data，从最久未访问到最近访问 |
+//	结束标记 0 | 前面所有内容的 CRC32（IEEE），uint32
+//
+// 整数均为大端序。按从旧到新的顺序恢复，恢复后的访问顺序与保存时相同。
+
+const (
+	snapshotMagic   = "GLRU"
+	snapshotVersion = 1
+
+	// maxSnapshotField 单个 key 或值的长度上限，防止损坏的文件导致分配过多内存
+	maxSnapshotField = 1 << 30
+)
+
+// ErrBadSnapshot 快照文件已损坏或不是快照文件
+var ErrBadSnapshot = errors.New("快照文件已损坏")
+
+// SnapshotEntry 快照中的一个条目，Data 为编码后的值
+type SnapshotEntry struct {
+	Key  string
+	Data []byte
+}
+
+// Snapshot 按从最久未访问到最近访问的顺序将条目写入 w，不改变访问顺序；
+// encode 将值编码为字节，返回 false 时跳过该条目（如已经过期）
+func (c *Cache) Snapshot(w io.Writer, encode func(key string, value Value) ([]byte, bool)) (int, error) {
+	var entries []SnapshotEntry
+	for ele := c.ll.Front(); ele != nil; ele = ele.Next() {
+		kv := ele.Value.(*entry)
+		if data, ok := encode(kv.key, kv.value); ok {
+			entries = append(entries, SnapshotEntry{kv.key, data})
+		}
+	}
+	return WriteSnapshot(w, entries)
+}
+
+// WriteSnapshot 将 entries 按顺序（从最久未访问到最近访问）写入 w，返回写入的条目数。
+// 不访问缓存，调用方可以先在锁内复制条目，再在锁外写入
+func WriteSnapshot(w io.Writer, entries []SnapshotEntry) (int, error) {
+	bw := bufio.NewWriter(w)
+	crc := crc32.NewIEEE()
+	out := &errWriter{w: io.MultiWriter(bw, crc)}
+	// 1.文件头
+	header := make([]byte, len(snapshotMagic)+2)
+	copy(header, snapshotMagic)
+	binary.BigEndian.PutUint16(header[len(snapshotMagic):], snapshotVersion)
+	out.Write(header)
+	// 2.条目
+	n := 0
+	var buf [binary.MaxVarintLen64]byte
+	for _, e := range entries {
+		out.Write([]byte{1})
+		out.Write(buf[:binary.PutUvarint(buf[:], uint64(len(e.Key)))])
+		io.WriteString(out, e.Key)
+		out.Write(buf[:binary.PutUvarint(buf[:], uint64(len(e.Data)))])
+		out.Write(e.Data)
+		if out.err != nil {
+			return n, out.err
+		}
+		n++
+	}
+	// 3.结束标记和校验和，校验和本身不参与计算
+	out.Write([]byte{0})
+	if out.err != nil {
+		return n, out.err
+	}
+	binary.BigEndian.PutUint32(buf[:4], crc.Sum32())
+	if _, err := bw.Write(buf[:4]); err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+// errWriter 记录第一次写入的错误，之后的写入直接跳过，调用方只需要在适当的位置检查 err
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := e.w.Write(p)
+	e.err = err
+	return n, err
+}
+
+// snapshotReader 读取快照，同时计算校验和
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (s *snapshotReader) ReadByte() (byte, error) {
+	b, err := s.r.ReadByte()
+	if err == nil {
+		s.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (s *snapshotReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.crc.Write(p[:n])
+	return n, err
+}
+
+// readField 读取 uvarint 长度和相应的字节
+func (s *snapshotReader) readField() ([]byte, error) {
+	n, err := binary.ReadUvarint(s)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxSnapshotField {
+		return nil, ErrBadSnapshot
+	}
+	b := make([]byte, n)
+	if _, err = io.ReadFull(s, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// RestoredEntry 从快照中恢复的一个条目，Value 为解码后的值
+type RestoredEntry struct {
+	Key   string
+	Value Value
+}
+
+// Restore 读取 Snapshot 写入的快照，校验通过后再加入缓存，返回加入的条目数；
+// decode 将字节解码为值，返回 false 时跳过该条目（如已经过期）。
+// 恢复的条目比缓存中已有的条目更新；设置了 maxBytes 时只恢复放得下的最近访问的条目
+func (c *Cache) Restore(r io.Reader, decode func(key string, data []byte) (Value, bool)) (int, error) {
+	entries, err := ReadSnapshot(r)
+	if err != nil {
+		return 0, err
+	}
+	restored := make([]RestoredEntry, 0, len(entries))
+	for _, e := range entries {
+		if value, ok := decode(e.Key, e.Data); ok {
+			restored = append(restored, RestoredEntry{e.Key, value})
+		}
+	}
+	return c.AddRestored(restored), nil
+}
+
+// ReadSnapshot 读取 WriteSnapshot 写入的快照并校验，返回从最久未访问到最近访问的条目。
+// 不访问缓存，调用方可以在锁外读取和校验，再在锁内调用 AddRestored
+func ReadSnapshot(r io.Reader) ([]SnapshotEntry, error) {
+	sr := &snapshotReader{r: bufio.NewReader(r), crc: crc32.NewIEEE()}
+	// 1.文件头
+	header := make([]byte, len(snapshotMagic)+2)
+	if _, err := io.ReadFull(sr, header); err != nil || string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, ErrBadSnapshot
+	}
+	if v := binary.BigEndian.Uint16(header[len(snapshotMagic):]); v != snapshotVersion {
+		return nil, fmt.Errorf("不支持的快照版本 %d", v)
+	}
+	// 2.读取全部条目
+	var entries []SnapshotEntry
+	for {
+		flag, err := sr.ReadByte()
+		if err != nil {
+			return nil, ErrBadSnapshot
+		}
+		if flag == 0 {
+			break
+		}
+		if flag != 1 {
+			return nil, ErrBadSnapshot
+		}
+		key, err := sr.readField()
+		if err != nil {
+			return nil, ErrBadSnapshot
+		}
+		data, err := sr.readField()
+		if err != nil {
+			return nil, ErrBadSnapshot
+		}
+		entries = append(entries, SnapshotEntry{string(key), data})
+	}
+	// 3.校验和
+	sum := sr.crc.Sum32()
+	var trailer [4]byte
+	if _, err := io.ReadFull(sr.r, trailer[:]); err != nil || binary.BigEndian.Uint32(trailer[:]) != sum {
+		return nil, ErrBadSnapshot
+	}
+	return entries, nil
+}
+
+// AddRestored 将从旧到新排列的条目加入缓存，返回加入的条目数。
+// 从最近访问的条目开始计算放得下的条目，再从旧到新加入，恢复后的访问顺序与保存时相同
+func (c *Cache) AddRestored(entries []RestoredEntry) int {
+	start := 0
+	if c.maxBytes != 0 {
+		var size int64
+		start = len(entries)
+		for i := len(entries) - 1; i >= 0; i-- {
+			size += int64(len(entries[i].Key)) + int64(entries[i].Value.Len())
+			if size > c.maxBytes {
+				break
+			}
+			start = i
+		}
+	}
+	for _, e := range entries[start:] {
+		c.Add(e.Key, e.Value)
+	}
+	return len(entries) - start
+}
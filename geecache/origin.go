@@ -0,0 +1,107 @@
+package geecache
+
+import (
+	"errors"
+	"geecache/breaker"
+	"geecache/limiter"
+	"log"
+	"time"
+)
+
+// applyOptions 根据配置初始化回源保护
+func (g *Group) applyOptions(o *GroupOptions) {
+	if o.MaxConcurrentLoads > 0 {
+		g.bulkhead = limiter.NewBulkhead(o.MaxConcurrentLoads, o.MaxQueuedLoads, o.QueueTimeout)
+	}
+	if o.LoadRate > 0 {
+		g.rate = limiter.NewTokenBucket(o.LoadRate, o.LoadBurst)
+	}
+	if o.Breaker != nil {
+		bo := *o.Breaker
+		onChange := bo.OnStateChange
+		bo.OnStateChange = func(from, to breaker.State) {
+			log.Printf("[Group %s] 回源熔断器：%s -> %s", g.name, from, to)
+			if onChange != nil {
+				onChange(from, to)
+			}
+		}
+		g.breaker = breaker.New(bo)
+	}
+	g.ttl = o.TTL
+	g.chunkSize = o.ChunkSize
+	if o.Compression != "" {
+		c, ok := getCompressor(o.Compression)
+		if !ok {
+			panic("未注册的压缩算法：" + o.Compression)
+		}
+		g.compressor = c
+		g.compressThreshold = o.CompressThreshold
+		if g.compressThreshold == 0 {
+			g.compressThreshold = defaultCompressThreshold
+		}
+	}
+	if o.StaleCacheBytes > 0 {
+		g.staleCache = &cache{cacheBytes: o.StaleCacheBytes}
+		// 主缓存淘汰或过期的值转移到旧值缓存，旧值本身就可能已经过期，因此清除过期时间，
+		// 分块存储的值不保存旧值
+		g.mainCache.onEvicted = func(key string, value ByteView) {
+			if value.chunked || isChunkKey(key) {
+				return
+			}
+			value.e = time.Time{}
+			g.staleCache.Add(key, value)
+		}
+	}
+}
+
+// callGetter 在限流、舱壁和熔断器的保护下调用回调函数
+func (g *Group) callGetter(key string) ([]byte, error) {
+	var bytes []byte
+	err := g.protect(func() (err error) {
+		bytes, err = g.getter.Get(key)
+		return err
+	})
+	return bytes, err
+}
+
+// protect 在限流、舱壁和熔断器的保护下执行回源操作 fn
+func (g *Group) protect(fn func() error) error {
+	// 1.超过速率限制直接失败
+	if g.rate != nil && !g.rate.Allow() {
+		return limiter.ErrRateLimited
+	}
+	// 2.申请回源名额，名额用完时排队等待
+	if g.bulkhead != nil {
+		release, err := g.bulkhead.Acquire()
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+	// 3.熔断器打开时直接失败
+	if g.breaker == nil {
+		return fn()
+	}
+	return g.breaker.Do(fn)
+}
+
+// isLoadRejected 判断错误是否是回源被保护机制拒绝，而不是回调函数本身返回的错误
+func isLoadRejected(err error) bool {
+	return errors.Is(err, breaker.ErrOpen) ||
+		errors.Is(err, limiter.ErrRateLimited) ||
+		errors.Is(err, limiter.ErrQueueFull) ||
+		errors.Is(err, limiter.ErrTimeout)
+}
+
+// getStale 回源被拒绝时从旧值缓存中查找 key
+func (g *Group) getStale(key string, err error) (ByteView, bool) {
+	if g.staleCache == nil || !isLoadRejected(err) {
+		return ByteView{}, false
+	}
+	v, ok := g.staleCache.Get(key)
+	if ok {
+		log.Printf("[Group %s] 回源被拒绝（%v），返回旧值 %s", g.name, err, key)
+		v.stale = true
+	}
+	return v, ok
+}
@@ -0,0 +1,110 @@
+package geecache
+
+import (
+	"errors"
+	"fmt"
+	"geecache/breaker"
+	"geecache/limiter"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 测试同时回源的数量不超过 MaxConcurrentLoads，超出排队数的请求直接失败
+func TestGroupBulkhead(t *testing.T) {
+	var inFlight, maxInFlight int32
+	unblock := make(chan struct{})
+	g := NewGroupOpts("origin-bulkhead", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		<-unblock
+		return []byte(key), nil
+	}), &GroupOptions{MaxConcurrentLoads: 2, MaxQueuedLoads: 1})
+
+	// 1.两个请求回源，一个请求排队
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			g.Get(fmt.Sprintf("key%d", i))
+		}(i)
+	}
+	waitFor(t, time.Second, func() bool {
+		return atomic.LoadInt32(&inFlight) == 2 && g.bulkhead.Waiting() == 1
+	}, "两个请求回源，一个请求排队")
+	// 2.第四个请求队列已满，直接失败
+	if _, err := g.Get("key3"); !errors.Is(err, limiter.ErrQueueFull) {
+		t.Fatalf("队列已满应该返回 ErrQueueFull，实际 %v", err)
+	}
+	close(unblock)
+	wg.Wait()
+	if maxInFlight != 2 {
+		t.Fatalf("最大并发回源数应该为 2，实际 %d", maxInFlight)
+	}
+}
+
+// 测试回源速率限制
+func TestGroupLoadRate(t *testing.T) {
+	g := NewGroupOpts("origin-rate", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), &GroupOptions{LoadRate: 0.001, LoadBurst: 1})
+	if _, err := g.Get("a"); err != nil {
+		t.Fatalf("第一次回源应该成功：%v", err)
+	}
+	if _, err := g.Get("b"); !errors.Is(err, limiter.ErrRateLimited) {
+		t.Fatalf("超过速率应该返回 ErrRateLimited，实际 %v", err)
+	}
+	// 已经缓存的值不受限制
+	if _, err := g.Get("a"); err != nil {
+		t.Fatalf("缓存命中不应该被限流：%v", err)
+	}
+}
+
+// 测试回调函数错误率过高时熔断，并返回被淘汰的旧值
+func TestGroupBreakerServesStale(t *testing.T) {
+	var failing atomic.Bool
+	var calls int32
+	g := NewGroupOpts("origin-stale", 6, GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		if failing.Load() {
+			return nil, errors.New("数据库不可用")
+		}
+		return []byte("v" + key[1:]), nil
+	}), &GroupOptions{
+		Breaker:         &breaker.Options{MinRequests: 1, ErrorRate: 0.3, OpenTimeout: time.Minute},
+		StaleCacheBytes: 2 << 10,
+	})
+	// 1.主缓存只能放下一个值，加载 k2 时 k1 被淘汰到旧值缓存
+	g.Get("k1")
+	g.Get("k2")
+	if _, ok := g.mainCache.Get("k1"); ok {
+		t.Fatalf("k1 应该被淘汰")
+	}
+	// 2.数据库故障，错误率达到阈值后熔断
+	failing.Store(true)
+	if _, err := g.Get("k3"); err == nil {
+		t.Fatalf("数据库故障时应该返回错误")
+	}
+	if g.breaker.State() != breaker.Open {
+		t.Fatalf("熔断器应该打开")
+	}
+	// 3.熔断期间返回旧值，不再调用回调函数
+	before := atomic.LoadInt32(&calls)
+	if v, err := g.Get("k1"); err != nil || v.String() != "v1" {
+		t.Fatalf("熔断期间应该返回旧值，实际 %q %v", v, err)
+	}
+	if _, err := g.Get("k4"); !errors.Is(err, breaker.ErrOpen) {
+		t.Fatalf("没有旧值时应该快速失败，实际 %v", err)
+	}
+	if atomic.LoadInt32(&calls) != before {
+		t.Fatalf("熔断期间不应该调用回调函数")
+	}
+}
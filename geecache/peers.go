@@ -17,3 +17,9 @@ type PeerGetter interface {
 	// 修改后
 	Get(in *pb.Request, out *pb.Response) error
 }
+
+// 3.PeerSetter 接口，接收节点地址，HTTPPool、TCPPool、RPCPool、Client 都实现了该接口，
+// 节点发现、gossip、配置文件通过它更新节点
+type PeerSetter interface {
+	Set(peers ...string)
+}
@@ -0,0 +1,162 @@
+package geecache
+
+import (
+	"errors"
+	"fmt"
+	pb "geecache/geecachepb"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ProtocolVersion 节点间协议的版本号，新增的字段都向后兼容：
+// 旧版本的节点不设置版本号（为 0），也不会设置错误码等字段，此时只使用 value
+const ProtocolVersion = 1
+
+// ErrNotFound 数据源中不存在 key。回调函数返回包装了 ErrNotFound 的错误时，
+// 其他节点会收到 NOT_FOUND 错误码，不会再从本地重复回源
+var ErrNotFound = errors.New("key 不存在")
+
+// PeerError 远程节点通过错误码返回的错误
+type PeerError struct {
+	Code    pb.Code
+	Message string
+	Server  string
+}
+
+func (e *PeerError) Error() string {
+	return fmt.Sprintf("节点 %s 返回 %s：%s", e.Server, e.Code, e.Message)
+}
+
+// Is 使 errors.Is(err, ErrNotFound) 对 NOT_FOUND 错误码成立
+func (e *PeerError) Is(target error) bool {
+	return target == ErrNotFound && e.Code == pb.Code_NOT_FOUND
+}
+
+// errorCode 将处理请求时的错误转换为错误码
+func errorCode(err error) pb.Code {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return pb.Code_NOT_FOUND
+	case errors.Is(err, ErrKeyTooLong):
+		return pb.Code_KEY_TOO_LONG
+	case isLoadRejected(err):
+		return pb.Code_UNAVAILABLE
+	case errors.Is(err, errCacheMiss):
+		return pb.Code_CACHE_MISS
+	}
+	return pb.Code_INTERNAL
+}
+
+// httpStatus 返回错误码对应的 HTTP 状态码，HTTPPool 的重试和健康检查仍然依据状态码
+func httpStatus(code pb.Code) int {
+	switch code {
+	case pb.Code_OK:
+		return http.StatusOK
+	case pb.Code_NOT_FOUND, pb.Code_GROUP_NOT_FOUND, pb.Code_CACHE_MISS:
+		return http.StatusNotFound
+	case pb.Code_BAD_REQUEST:
+		return http.StatusBadRequest
+	case pb.Code_KEY_TOO_LONG:
+		return http.StatusRequestURITooLong
+	case pb.Code_UNAVAILABLE:
+		return http.StatusServiceUnavailable
+	case pb.Code_FORBIDDEN:
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// errorResponse 构造带有错误码的响应
+func errorResponse(server string, code pb.Code, err error) *pb.Response {
+	return &pb.Response{
+		Code:            code,
+		Message:         strings.ToValidUTF8(err.Error(), "�"),
+		ServerId:        server,
+		ProtocolVersion: ProtocolVersion,
+	}
+}
+
+// lookupGroup 校验请求并返回对应的 Group，失败时返回带有错误码的响应
+func lookupGroup(server string, in *pb.Request, maxKeyLength int) (*Group, *pb.Response) {
+	if err := checkKeyLength(in.GetGroup(), in.GetKey(), maxKeyLength); err != nil {
+		return nil, errorResponse(server, pb.Code_KEY_TOO_LONG, err)
+	}
+	group := GetGroup(string(in.GetGroup()))
+	if group == nil {
+		return nil, errorResponse(server, pb.Code_GROUP_NOT_FOUND, fmt.Errorf("未获取到 group：%q", in.GetGroup()))
+	}
+	return group, nil
+}
+
+// serveGet 处理其他节点的 Get 请求，各种传输方式共用，错误通过响应中的错误码返回
+func serveGet(server string, in *pb.Request, maxKeyLength int) *pb.Response {
+	// 1.校验请求
+	group, errRes := lookupGroup(server, in, maxKeyLength)
+	if errRes != nil {
+		return errRes
+	}
+	// 2.来自其他节点的请求只在本地查找或回源，不再转发，避免节点间环形转发
+	// 分块存储的值拼接为完整的值，其他值保持缓存中的编码；peek 请求只查找缓存，
+	// 热点请求由副本节点从所有者获取
+	key := string(in.GetKey())
+	var view ByteView
+	var err error
+	switch {
+	case in.GetPeek():
+		view, err = group.peek(key)
+	case in.GetHot():
+		view, err = group.getHotForPeer(key)
+	default:
+		view, err = group.getForPeer(key)
+	}
+	if err == nil && view.chunked {
+		view, err = group.getForPeerFull(key)
+	}
+	if err != nil {
+		return errorResponse(server, errorCode(err), err)
+	}
+	// 3.缓存中压缩过的值，对方支持时原样返回，不支持时解压后返回
+	if view.enc != "" && !acceptsEncoding(in.GetAcceptEncoding(), view.enc) {
+		if view, err = decodeView(view); err != nil {
+			return errorResponse(server, pb.Code_INTERNAL, err)
+		}
+	}
+	// 4.带上过期时间、版本号等信息
+	res := &pb.Response{
+		Value:           view.ByteSlice(),
+		ContentEncoding: view.enc,
+		Version:         view.version,
+		ServerId:        server,
+		ProtocolVersion: ProtocolVersion,
+	}
+	if !view.e.IsZero() {
+		res.Expire = view.e.UnixNano()
+	}
+	if view.stale {
+		res.Flags |= uint32(pb.Flag_STALE)
+	}
+	return res
+}
+
+// responseError 根据响应中的错误码返回错误，OK 时返回 nil
+func responseError(res *pb.Response) error {
+	if res.GetCode() == pb.Code_OK {
+		return nil
+	}
+	return &PeerError{Code: res.GetCode(), Message: res.GetMessage(), Server: res.GetServerId()}
+}
+
+// viewFromResponse 将响应转换为 ByteView
+func viewFromResponse(res *pb.Response) ByteView {
+	v := ByteView{
+		b:       res.GetValue(),
+		version: res.GetVersion(),
+		stale:   res.GetFlags()&uint32(pb.Flag_STALE) != 0,
+		enc:     res.GetContentEncoding(),
+	}
+	if res.GetExpire() != 0 {
+		v.e = time.Unix(0, res.GetExpire())
+	}
+	return v
+}
@@ -0,0 +1,175 @@
+package geecache
+
+import (
+	"errors"
+	"fmt"
+	"geecache/breaker"
+	pb "geecache/geecachepb"
+	"geecache/singleflight"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newLocalGroup 构造一个不注册到全局的 Group，与远程节点上同名的 Group 区分开
+func newLocalGroup(name string, getter Getter, peers PeerPicker) *Group {
+	return &Group{
+		name:       name,
+		getter:     getter,
+		mainCache:  cache{cacheBytes: 2 << 10},
+		peers:      peers,
+		loader:     &singleflight.Group{},
+		peerLoader: &singleflight.Group{},
+	}
+}
+
+// 测试远程节点返回 NOT_FOUND 时不再从本地回源
+func TestPeerNotFound(t *testing.T) {
+	NewGroup("proto-notfound", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s：%w", key, ErrNotFound)
+	}))
+	remote := httptest.NewServer(NewHTTPPool("remote"))
+	defer remote.Close()
+	peers := NewHTTPPool("local")
+	peers.Set(remote.URL)
+
+	var localCalls int32
+	g := newLocalGroup("proto-notfound", GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt32(&localCalls, 1)
+		return []byte(key), nil
+	}), peers)
+	_, err := g.Get("Tom")
+	var pe *PeerError
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &pe) || pe.Code != pb.Code_NOT_FOUND || pe.Server != "remote" {
+		t.Fatalf("应该返回远程节点的 NOT_FOUND，实际 %v", err)
+	}
+	if localCalls != 0 {
+		t.Fatalf("远程节点确认不存在后不应该从本地回源")
+	}
+}
+
+// 测试各种传输方式都通过错误码返回 group 不存在
+func TestPeerErrorCodes(t *testing.T) {
+	remote := httptest.NewServer(NewHTTPPool("remote"))
+	defer remote.Close()
+	_, tcpAddr := startTCPPeer(t, "tcp")
+	httpPeers := NewHTTPPool("local")
+	httpPeers.Set(remote.URL)
+	tcpPeers := NewTCPPool("local", nil)
+	defer tcpPeers.Close()
+	tcpPeers.Set(tcpAddr)
+	rpcPeers := NewRPCPool("local", nil)
+	defer rpcPeers.Close()
+	rpcPeers.Set(startRPCPeer(t, nil))
+
+	for name, picker := range map[string]PeerPicker{"http": httpPeers, "tcp": tcpPeers, "rpc": rpcPeers} {
+		peer, _ := picker.PickPeer("Tom")
+		err := peer.Get(&pb.Request{Group: []byte("proto-unknown"), Key: []byte("Tom")}, &pb.Response{})
+		var pe *PeerError
+		if !errors.As(err, &pe) || pe.Code != pb.Code_GROUP_NOT_FOUND {
+			t.Errorf("%s：应该返回 GROUP_NOT_FOUND，实际 %v", name, err)
+		}
+	}
+}
+
+// 测试过期时间、版本号和旧值标志随响应返回
+func TestPeerResponseMetadata(t *testing.T) {
+	var failing atomic.Bool
+	remoteGroup := NewGroupOpts("proto-meta", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if failing.Load() {
+			return nil, errors.New("数据库不可用")
+		}
+		return []byte("v"), nil
+	}), &GroupOptions{
+		TTL:             time.Minute,
+		Breaker:         &breaker.Options{MinRequests: 1, ErrorRate: 0.1, OpenTimeout: time.Minute},
+		StaleCacheBytes: 2 << 10,
+	})
+	remote := httptest.NewServer(NewHTTPPool("remote"))
+	defer remote.Close()
+	peers := NewHTTPPool("local")
+	peers.Set(remote.URL)
+	g := newLocalGroup("proto-meta", GetterFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("不应该从本地回源")
+	}), peers)
+
+	// 1.新加载的值带有过期时间和版本号
+	before := time.Now()
+	v, err := g.Get("Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Expire().Before(before.Add(time.Minute)) || v.Expire().After(time.Now().Add(time.Minute)) {
+		t.Fatalf("过期时间错误：%v", v.Expire())
+	}
+	if v.Version() < before.UnixNano() || v.Stale() {
+		t.Fatalf("版本号或旧值标志错误：%d %v", v.Version(), v.Stale())
+	}
+
+	// 2.远程节点上的值被删除、回源熔断后返回旧值，带有旧值标志
+	remoteGroup.Remove("Tom")
+	remoteGroup.mainCache.onEvicted("Tom", ByteView{b: []byte("old")})
+	failing.Store(true)
+	remoteGroup.Get("Jack") // 触发熔断
+	g.mainCache.Remove("Tom")
+	v, err = g.getFromPeer(mustPick(t, peers, "Tom"), "Tom")
+	if err != nil || v.String() != "old" || !v.Stale() {
+		t.Fatalf("应该返回带有旧值标志的旧值，实际 %q %v %v", v, v.Stale(), err)
+	}
+}
+
+func mustPick(t *testing.T, p PeerPicker, key string) PeerGetter {
+	t.Helper()
+	peer, ok := p.PickPeer(key)
+	if !ok {
+		t.Fatalf("key %s 应该选择远程节点", key)
+	}
+	return peer
+}
+
+// 测试本地缓存过期后重新回源
+func TestGroupTTL(t *testing.T) {
+	var calls int32
+	g := NewGroupOpts("proto-ttl", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		return []byte(key), nil
+	}), &GroupOptions{TTL: 20 * time.Millisecond})
+	g.Get("Tom")
+	g.Get("Tom")
+	if calls != 1 {
+		t.Fatalf("过期前应该命中缓存")
+	}
+	time.Sleep(30 * time.Millisecond)
+	g.Get("Tom")
+	if calls != 2 {
+		t.Fatalf("过期后应该重新回源，实际回源 %d 次", calls)
+	}
+}
+
+// 测试旧版本的节点只返回 value、出错时返回纯文本，仍然可以正常处理
+func TestLegacyPeerResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == defaultBasePath+encodePeerPath([]byte("g"), []byte("bad")) {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		writeValue(w, "old")
+	}))
+	defer srv.Close()
+	g := newLocalGroup("g", GetterFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("不应该从本地回源")
+	}), nil)
+	h := newTestGetter(srv, nil)
+
+	v, err := g.getFromPeer(h, "Tom")
+	if err != nil || v.String() != "old" || !v.Expire().IsZero() || v.Version() != 0 {
+		t.Fatalf("旧版本节点的响应处理错误：%q %v", v, err)
+	}
+	_, err = g.getFromPeer(h, "bad")
+	var se *statusError
+	if !errors.As(err, &se) || se.code != http.StatusInternalServerError || se.err != nil {
+		t.Fatalf("纯文本错误应该返回状态码，实际 %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package geecache
+
+import (
+	"errors"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"log"
+	"time"
+)
+
+// 成员变化后的预热：节点加入或离开时，一部分 key 换了所有者，新的所有者缓存为空，
+// 如果直接回源，扩容的瞬间数据源会收到大量请求。过渡期内新的所有者未命中时，
+// 先向之前的所有者发送只查找缓存的 peek 请求，命中则写入本地缓存，未命中再回源
+
+const peekHeader = "X-Geecache-Peek" // HTTP 请求中表示 peek 请求
+
+// errCacheMiss peek 请求在缓存中未命中
+var errCacheMiss = errors.New("缓存未命中")
+
+// PreviousPeerPicker 在成员变化后的过渡期内，为本节点新负责的 key 返回之前的所有者，
+// HTTPPool 实现了该接口
+type PreviousPeerPicker interface {
+	PickPreviousPeer(key string) (peerGetter PeerGetter, ok bool)
+}
+
+var _ PreviousPeerPicker = (*HTTPPool)(nil)
+
+// PickPreviousPeer 过渡期内 key 现在由自己负责、之前由仍然健康的远程节点负责时，返回之前的所有者
+func (p *HTTPPool) PickPreviousPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.prevPeers == nil || p.peers == nil {
+		return nil, false
+	}
+	if time.Now().After(p.prevUntil) {
+		p.prevPeers = nil
+		return nil, false
+	}
+	if p.peers.Get(key) != p.self {
+		return nil, false
+	}
+	prev := p.prevPeers.Get(key)
+	if prev == "" || prev == p.self {
+		return nil, false
+	}
+	g, ok := p.httpGetters[prev]
+	if !ok || g.health.ejected || g.health.left {
+		return nil, false
+	}
+	return g, true
+}
+
+// recordPrevious 节点集合变化时保存原来的哈希环，需要持有 p.mu
+func (p *HTTPPool) recordPrevious(old []string, ring *consistenthash.Map) {
+	if p.opts.RebalanceWindow <= 0 || ring == nil || samePeerSet(old, p.all) {
+		return
+	}
+	p.prevPeers = ring
+	p.prevUntil = time.Now().Add(p.opts.RebalanceWindow)
+}
+
+// samePeerSet 判断两组节点是否相同，不考虑顺序和重复
+func samePeerSet(a, b []string) bool {
+	toSet := func(peers []string) map[string]bool {
+		set := make(map[string]bool, len(peers))
+		for _, peer := range peers {
+			set[peer] = true
+		}
+		return set
+	}
+	sa, sb := toSet(a), toSet(b)
+	if len(sa) != len(sb) {
+		return false
+	}
+	for peer := range sa {
+		if !sb[peer] {
+			return false
+		}
+	}
+	return true
+}
+
+// getFromPrevious 从 key 之前的所有者的缓存中获取值并写入本地缓存，
+// 未命中、之前的所有者不可用或返回旧值时返回 false，由调用方正常回源
+func (g *Group) getFromPrevious(key string) (ByteView, bool) {
+	pp, ok := g.peers.(PreviousPeerPicker)
+	if !ok {
+		return ByteView{}, false
+	}
+	peer, ok := pp.PickPreviousPeer(key)
+	if !ok {
+		return ByteView{}, false
+	}
+	// 1.只查找之前的所有者的缓存，不让它回源
+	req := &pb.Request{
+		Group:           []byte(g.name),
+		Key:             []byte(key),
+		ProtocolVersion: ProtocolVersion,
+		Peek:            true,
+	}
+	res := &pb.Response{}
+	if err := peer.Get(req, res); err != nil || responseError(res) != nil {
+		return ByteView{}, false
+	}
+	v := viewFromResponse(res)
+	if v.stale {
+		return ByteView{}, false
+	}
+	v, err := decodeView(v)
+	if err != nil {
+		return ByteView{}, false
+	}
+	// 2.写入本地缓存，保留原来的版本号和过期时间，按本地的配置压缩、分块
+	g.stats.warmLoads.Add(1)
+	log.Printf("[Group %s] 从之前的所有者 %s 预热 %s", g.name, res.GetServerId(), key)
+	// 响应中的值由本次请求独占，不需要拷贝
+	b := v.rawBytes()
+	if g.chunkSize > 0 && len(b) > g.chunkSize {
+		return g.store(key, b), true
+	}
+	nv := g.newView(b)
+	if v.version != 0 {
+		nv.version, nv.e = v.version, v.e
+	}
+	nv = g.encodeView(nv)
+	g.populateGroup(key, nv)
+	return nv, true
+}
+
+// peek 处理 peek 请求：只在本地缓存中查找，分块存储的值拼接为完整的值，不回源
+func (g *Group) peek(key string) (ByteView, error) {
+	g.stats.serverRequests.Add(1)
+	v, ok := g.mainCache.Get(key)
+	if !ok {
+		return ByteView{}, errCacheMiss
+	}
+	if v.chunked {
+		return g.resolve(key, v, func() (ByteView, error) { return ByteView{}, errCacheMiss })
+	}
+	return v, nil
+}
@@ -0,0 +1,88 @@
+package geecache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 测试扩容后新的所有者从之前的所有者预热，不再回源
+func TestRebalanceWarmup(t *testing.T) {
+	// 1.节点 A 负责所有的 key，缓存了 key-0 ~ key-49
+	var loadsA, loadsB atomic.Int64
+	var poolA *HTTPPool
+	srvA := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		poolA.ServeHTTP(w, r)
+	}))
+	defer srvA.Close()
+	poolA = NewHTTPPool(srvA.URL)
+	groupA := NewGroup("rebalance-scores", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		loadsA.Add(1)
+		return []byte("value-" + key), nil
+	}))
+	for i := 0; i < 50; i++ {
+		groupA.Set(fmt.Sprintf("key-%d", i), []byte(fmt.Sprintf("value-key-%d", i)))
+	}
+
+	// 2.节点 B 加入，一部分 key 改由 B 负责
+	self := "http://b.invalid"
+	poolB := NewHTTPPoolOpts(self, &HTTPPoolOptions{RebalanceWindow: time.Minute})
+	poolB.Set(srvA.URL)
+	poolB.Set(srvA.URL, self)
+	groupB := newLocalGroup("rebalance-scores", GetterFunc(func(key string) ([]byte, error) {
+		loadsB.Add(1)
+		return []byte("origin-" + key), nil
+	}), poolB)
+	groupB.mainCache.cacheBytes = 2 << 20
+
+	// 3.A 缓存过的 key 从 A 预热，B 和 A 都不回源
+	moved := 0
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if _, ok := poolB.PickPeer(key); ok {
+			continue
+		}
+		moved++
+		v, err := groupB.Get(key)
+		if err != nil || v.String() != "value-"+key {
+			t.Fatalf("%s 期望从 A 预热，实际 %q，错误 %v", key, v.String(), err)
+		}
+	}
+	if moved == 0 {
+		t.Fatalf("应该有 key 改由 B 负责")
+	}
+	if loadsA.Load() != 0 || loadsB.Load() != 0 {
+		t.Fatalf("预热不应该回源：A %d 次，B %d 次", loadsA.Load(), loadsB.Load())
+	}
+	if got := groupB.Stats().WarmLoads; got != int64(moved) {
+		t.Fatalf("期望预热 %d 次，实际 %d", moved, got)
+	}
+
+	// 4.A 没有缓存的 key，peek 未命中，由 B 回源，A 不回源
+	for i := 50; ; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if _, ok := poolB.PickPeer(key); ok {
+			continue
+		}
+		if v, err := groupB.Get(key); err != nil || v.String() != "origin-"+key {
+			t.Fatalf("%s 期望由 B 回源，实际 %q，错误 %v", key, v.String(), err)
+		}
+		break
+	}
+	if loadsA.Load() != 0 || loadsB.Load() != 1 {
+		t.Fatalf("peek 未命中时只应该由 B 回源：A %d 次，B %d 次", loadsA.Load(), loadsB.Load())
+	}
+
+	// 5.过渡期结束后不再向之前的所有者查找
+	poolB.mu.Lock()
+	poolB.prevUntil = time.Now().Add(-time.Second)
+	poolB.mu.Unlock()
+	for i := 0; i < 50; i++ {
+		if _, ok := poolB.PickPreviousPeer(fmt.Sprintf("key-%d", i)); ok {
+			t.Fatalf("过渡期结束后不应该返回之前的所有者")
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "geecache/geecachepb"
+	"github.com/golang/protobuf/proto"
+	"math/rand"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RetryPolicy 访问远程节点失败时的重试策略
+type RetryPolicy struct {
+	// Attempts 总尝试次数（包括第一次），小于等于 1 表示不重试
+	Attempts int
+	// BaseBackoff 第一次重试前的等待时间，之后每次翻倍
+	BaseBackoff time.Duration
+	// MaxBackoff 等待时间的上限，为 0 表示不限制
+	MaxBackoff time.Duration
+	// Jitter 随机抖动比例（0~1），避免大量请求同时重试
+	Jitter float64
+	// RetryableStatus 可以重试的 HTTP 状态码，为空时使用 502/503/504
+	RetryableStatus []int
+}
+
+var defaultRetryableStatus = []int{502, 503, 504}
+
+// backoff 返回第 attempt 次重试（从 1 开始）前需要等待的时间
+func (r *RetryPolicy) backoff(attempt int) time.Duration {
+	d := r.BaseBackoff << uint(attempt-1)
+	if d <= 0 || (r.MaxBackoff > 0 && d > r.MaxBackoff) {
+		d = r.MaxBackoff
+	}
+	if r.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * r.Jitter * float64(d))
+	}
+	return d
+}
+
+// retryable 判断错误是否可以重试：网络错误以及指定的状态码可以重试，
+// 响应体过大、解码失败等错误重试也无济于事
+func (r *RetryPolicy) retryable(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		codes := r.RetryableStatus
+		if len(codes) == 0 {
+			codes = defaultRetryableStatus
+		}
+		for _, code := range codes {
+			if se.code == code {
+				return true
+			}
+		}
+		return false
+	}
+	var ue *url.Error
+	return errors.As(err, &ue)
+}
+
+// statusError 表示远程节点返回了非 200 的状态码，err 为响应体中的错误码对应的错误
+type statusError struct {
+	code int
+	err  error // 旧版本的节点不返回错误码，此时为 nil
+}
+
+func (e *statusError) Error() string {
+	if e.err != nil {
+		return fmt.Sprintf("HTTP %d，%v", e.code, e.err)
+	}
+	return fmt.Sprintf("节点返回 HTTP %d", e.code)
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+// sleepContext 等待 d，ctx 取消时提前返回
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// HedgePolicy 对冲请求策略：主请求迟迟没有返回时，向副本节点再发送一次请求，
+// 取先返回的结果，用少量额外流量换取更低的尾延迟
+type HedgePolicy struct {
+	// Percentile 主请求耗时超过该节点历史耗时的这个分位数（如 0.95）时发送对冲请求
+	Percentile float64
+	// MinDelay 对冲延迟的下限，样本不足时也使用该值
+	MinDelay time.Duration
+}
+
+const (
+	latencyWindow     = 128 // 每个节点保留的最近耗时样本数
+	latencyMinSamples = 16  // 样本数少于该值时不计算分位数
+)
+
+// latencyTracker 记录单个节点最近的请求耗时
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples [latencyWindow]time.Duration
+	n       int // 已记录的样本总数
+}
+
+func (l *latencyTracker) record(d time.Duration) {
+	l.mu.Lock()
+	l.samples[l.n%latencyWindow] = d
+	l.n++
+	l.mu.Unlock()
+}
+
+// percentile 返回最近样本的 q 分位数，样本不足时 ok 为 false
+func (l *latencyTracker) percentile(q float64) (d time.Duration, ok bool) {
+	l.mu.Lock()
+	n := l.n
+	if n > latencyWindow {
+		n = latencyWindow
+	}
+	if n < latencyMinSamples {
+		l.mu.Unlock()
+		return 0, false
+	}
+	sorted := make([]time.Duration, n)
+	copy(sorted, l.samples[:n])
+	l.mu.Unlock()
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(q * float64(n-1))
+	return sorted[idx], true
+}
+
+// hedgeDelay 返回向 peer 发送对冲请求前需要等待的时间
+func (h *HedgePolicy) hedgeDelay(peer *httpGetter) time.Duration {
+	d, ok := peer.latency.percentile(h.Percentile)
+	if !ok || d < h.MinDelay {
+		d = h.MinDelay
+	}
+	return d
+}
+
+// hedgedGetter 包装主节点与副本节点，实现对冲请求
+type hedgedGetter struct {
+	primary *httpGetter
+	backup  *httpGetter
+	policy  *HedgePolicy
+}
+
+var _ PeerGetter = (*hedgedGetter)(nil)
+
+type hedgeResult struct {
+	res *pb.Response
+	err error
+}
+
+func (h *hedgedGetter) Get(in *pb.Request, out *pb.Response) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel() // 返回时取消仍在进行中的请求
+	results := make(chan hedgeResult, 2)
+	send := func(peer *httpGetter) {
+		res := &pb.Response{}
+		err := peer.get(ctx, in, res)
+		results <- hedgeResult{res, err}
+	}
+	// 1.先向主节点发送请求
+	go send(h.primary)
+	pending := 1
+	timer := time.NewTimer(h.policy.hedgeDelay(h.primary))
+	defer timer.Stop()
+	hedged := false // 是否已经向副本节点发送请求，不能根据 timer.Stop 的结果推断
+	var lastErr error
+	for {
+		select {
+		case <-timer.C:
+			// 2.主节点超过阈值仍未返回，向副本节点发送对冲请求
+			if !hedged {
+				hedged = true
+				h.primary.hedges.Add(1)
+				go send(h.backup)
+				pending++
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// 3.取先成功返回的结果
+				out.Reset()
+				proto.Merge(out, r.res)
+				return nil
+			}
+			// 4.key 不存在时副本节点的结果也一样，不再对冲或转移，避免未命中时请求量翻倍
+			if errors.Is(r.err, ErrNotFound) {
+				return r.err
+			}
+			lastErr = r.err
+			if pending == 0 {
+				if hedged {
+					// 两个请求都失败了
+					return lastErr
+				}
+				// 主节点快速失败，不必再等，直接请求副本节点
+				hedged = true
+				go send(h.backup)
+				pending++
+			}
+		}
+	}
+}
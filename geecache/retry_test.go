@@ -0,0 +1,186 @@
+package geecache
+
+import (
+	"errors"
+	pb "geecache/geecachepb"
+	"github.com/golang/protobuf/proto"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	r := &RetryPolicy{BaseBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	expect := []time.Duration{10, 20, 40, 50, 50}
+	for i, d := range expect {
+		if got := r.backoff(i + 1); got != d*time.Millisecond {
+			t.Errorf("第 %d 次重试应等待 %v，实际 %v", i+1, d*time.Millisecond, got)
+		}
+	}
+	// 抖动后的等待时间不会超过原值
+	r.Jitter = 0.5
+	for i := 1; i <= 5; i++ {
+		if got := r.backoff(i); got > 50*time.Millisecond || got < 5*time.Millisecond {
+			t.Errorf("抖动后的等待时间超出范围：%v", got)
+		}
+	}
+}
+
+// newTestGetter 构造直接访问 srv 的 httpGetter
+func newTestGetter(srv *httptest.Server, retry *RetryPolicy) *httpGetter {
+	return &httpGetter{
+		baseURL:      srv.URL + defaultBasePath,
+		client:       srv.Client(),
+		maxBytes:     defaultMaxResponseBytes,
+		maxKeyLength: defaultMaxKeyLength,
+		retry:        retry,
+	}
+}
+
+// writeValue 向 w 写入编码后的 pb.Response
+func writeValue(w http.ResponseWriter, value string) {
+	body, _ := proto.Marshal(&pb.Response{Value: []byte(value)})
+	w.Write(body)
+}
+
+func TestHTTPGetterRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 前两次返回 503，第三次成功
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		writeValue(w, "ok")
+	}))
+	defer srv.Close()
+
+	h := newTestGetter(srv, &RetryPolicy{Attempts: 3, BaseBackoff: time.Millisecond})
+	res := &pb.Response{}
+	if err := h.Get(&pb.Request{Group: []byte("g"), Key: []byte("k")}, res); err != nil {
+		t.Fatalf("重试后应该成功：%v", err)
+	}
+	if string(res.GetValue()) != "ok" || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("期望请求 3 次，实际 %d 次", calls)
+	}
+}
+
+func TestHTTPGetterNotRetryable(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	h := newTestGetter(srv, &RetryPolicy{Attempts: 3, BaseBackoff: time.Millisecond})
+	if err := h.Get(&pb.Request{Group: []byte("g"), Key: []byte("k")}, &pb.Response{}); err == nil {
+		t.Fatalf("404 应该返回错误")
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("404 不应该重试，实际请求 %d 次", calls)
+	}
+}
+
+func TestHedgedGetter(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+		writeValue(w, "slow")
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeValue(w, "fast")
+	}))
+	defer fast.Close()
+
+	h := &hedgedGetter{
+		primary: newTestGetter(slow, nil),
+		backup:  newTestGetter(fast, nil),
+		policy:  &HedgePolicy{Percentile: 0.95, MinDelay: 20 * time.Millisecond},
+	}
+	start := time.Now()
+	res := &pb.Response{}
+	if err := h.Get(&pb.Request{Group: []byte("g"), Key: []byte("k")}, res); err != nil {
+		t.Fatalf("对冲请求失败：%v", err)
+	}
+	if string(res.GetValue()) != "fast" {
+		t.Fatalf("应该返回副本节点的结果，实际 %q", res.GetValue())
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("对冲请求没有降低延迟，耗时 %v", elapsed)
+	}
+	if h.primary.hedges.Load() != 1 {
+		t.Fatalf("应该记录一次对冲请求")
+	}
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	var l latencyTracker
+	if _, ok := l.percentile(0.9); ok {
+		t.Fatalf("样本不足时不应该计算分位数")
+	}
+	for i := 1; i <= 100; i++ {
+		l.record(time.Duration(i) * time.Millisecond)
+	}
+	if d, _ := l.percentile(0.9); d < 85*time.Millisecond || d > 95*time.Millisecond {
+		t.Fatalf("p90 计算错误：%v", d)
+	}
+}
+
+// 测试主节点失败与对冲计时器同时发生时仍然转移到副本节点
+func TestHedgedGetterFailover(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close() // 关闭后的地址会立即连接失败
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeValue(w, "fast")
+	}))
+	defer fast.Close()
+
+	for _, delay := range []time.Duration{0, 50 * time.Microsecond, 200 * time.Microsecond, time.Millisecond} {
+		h := &hedgedGetter{
+			primary: newTestGetter(dead, nil),
+			backup:  newTestGetter(fast, nil),
+			policy:  &HedgePolicy{Percentile: 0.95, MinDelay: delay},
+		}
+		for i := 0; i < 20; i++ {
+			res := &pb.Response{}
+			if err := h.Get(&pb.Request{Group: []byte("g"), Key: []byte("k")}, res); err != nil || string(res.GetValue()) != "fast" {
+				t.Fatalf("延迟 %v：主节点失败后应该返回副本节点的结果，实际 %q %v", delay, res.GetValue(), err)
+			}
+		}
+	}
+}
+
+// 测试主节点返回 NOT_FOUND 时不再请求副本节点
+func TestHedgedGetterNotFound(t *testing.T) {
+	missing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := proto.Marshal(errorResponse("primary", pb.Code_NOT_FOUND, ErrNotFound))
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(b)
+	}))
+	defer missing.Close()
+	var calls int32
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		writeValue(w, "backup")
+	}))
+	defer backup.Close()
+
+	h := &hedgedGetter{
+		primary: newTestGetter(missing, nil),
+		backup:  newTestGetter(backup, nil),
+		policy:  &HedgePolicy{Percentile: 0.95, MinDelay: 50 * time.Millisecond},
+	}
+	if err := h.Get(&pb.Request{Group: []byte("g"), Key: []byte("k")}, &pb.Response{}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("期望 ErrNotFound，实际 %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if atomic.LoadInt32(&calls) != 0 {
+		t.Fatalf("NOT_FOUND 不应该请求副本节点，实际 %d 次", calls)
+	}
+}
@@ -0,0 +1,537 @@
+package geecache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"github.com/golang/protobuf/proto"
+	"io"
+	"log"
+	"net"
+	"net/rpc"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// rpcServiceName 与 geecachepb.proto 中声明的 service 名称一致
+	rpcServiceName = "GroupCache"
+	// defaultMaxMultiKeys 单次 GetMulti 默认的最大 key 数
+	defaultMaxMultiKeys = 1000
+)
+
+// ErrTooManyKeys 单次 GetMulti 的 key 超过了 MaxMultiKeys
+var ErrTooManyKeys = errors.New("GetMulti 的 key 过多")
+
+// GroupCacheService 实现 geecachepb.proto 中声明的 GroupCache 服务，
+// 每个方法的签名都符合 net/rpc 的要求，可以直接注册到 rpc.Server
+type GroupCacheService struct {
+	self         string
+	maxKeyLength int
+	maxMultiKeys int
+	allowWrites  bool // 是否接受 Set、Remove，RPCPool 不支持认证，默认不接受
+}
+
+// group 校验 group、key 的长度并返回对应的 Group
+func (s *GroupCacheService) group(name []byte, keys ...[]byte) (*Group, error) {
+	for _, key := range keys {
+		if err := checkKeyLength(name, key, s.maxKeyLength); err != nil {
+			return nil, err
+		}
+	}
+	g := GetGroup(string(name))
+	if g == nil {
+		return nil, fmt.Errorf("未获取到 group：%q", name)
+	}
+	return g, nil
+}
+
+// Get 只查找本地缓存或调用回调函数，与 HTTPPool 一样不会再转发给其他节点，
+// group、key 相关的错误通过响应中的错误码返回
+func (s *GroupCacheService) Get(in *pb.Request, out *pb.Response) error {
+	proto.Merge(out, serveGet(s.self, in, s.maxKeyLength))
+	return nil
+}
+
+// Set 将值写入本节点的缓存
+func (s *GroupCacheService) Set(in *pb.SetRequest, out *pb.Empty) error {
+	if !s.allowWrites {
+		return ErrPeerWritesDisabled
+	}
+	g, err := s.group(in.GetGroup(), in.GetKey())
+	if err != nil {
+		return err
+	}
+	g.Set(string(in.GetKey()), in.GetValue())
+	return nil
+}
+
+// Remove 从本节点的缓存中删除 key
+func (s *GroupCacheService) Remove(in *pb.Request, out *pb.Empty) error {
+	if !s.allowWrites {
+		return ErrPeerWritesDisabled
+	}
+	g, err := s.group(in.GetGroup(), in.GetKey())
+	if err != nil {
+		return err
+	}
+	g.Remove(string(in.GetKey()))
+	return nil
+}
+
+// GetMulti 批量获取，单个 key 失败不影响其他 key，错误信息记录在对应的 Item 中；
+// key 的数量不超过 MaxMultiKeys，与 Client 一样同时加载的 key 不超过 defaultGetMultiParallel 个
+func (s *GroupCacheService) GetMulti(in *pb.GetMultiRequest, out *pb.GetMultiResponse) error {
+	if len(in.GetKeys()) > s.maxMultiKeys {
+		return fmt.Errorf("%w：%d 个，最多 %d 个", ErrTooManyKeys, len(in.GetKeys()), s.maxMultiKeys)
+	}
+	g, err := s.group(in.GetGroup(), in.GetKeys()...)
+	if err != nil {
+		return err
+	}
+	out.Items = make([]*pb.Item, len(in.GetKeys()))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, defaultGetMultiParallel)
+	for i, key := range in.GetKeys() {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, key []byte) {
+			defer func() { <-sem; wg.Done() }()
+			item := &pb.Item{Key: key}
+			if view, err := g.getForPeerFull(string(key)); err != nil {
+				item.Error = strings.ToValidUTF8(err.Error(), "�")
+			} else {
+				item.Value = view.ByteSlice()
+			}
+			out.Items[i] = item
+		}(i, key)
+	}
+	wg.Wait()
+	return nil
+}
+
+// Stats 返回本节点上 group 的统计信息
+func (s *GroupCacheService) Stats(in *pb.StatsRequest, out *pb.StatsResponse) error {
+	g, err := s.group(in.GetGroup())
+	if err != nil {
+		return err
+	}
+	st := g.Stats()
+	out.Gets = st.Gets
+	out.CacheHits = st.CacheHits
+	out.PeerLoads = st.PeerLoads
+	out.PeerErrors = st.PeerErrors
+	out.LocalLoads = st.LocalLoads
+	out.LocalLoadErrs = st.LocalLoadErrs
+	out.ServerRequests = st.ServerRequests
+	out.WarmLoads = st.WarmLoads
+	out.CacheBytes = st.CacheBytes
+	out.CacheItems = st.CacheItems
+	return nil
+}
+
+// protobuf 编解码器：每条消息为 uvarint 长度加上 protobuf 编码，
+// 每个请求和响应由一个 pb.RPCHeader 和一个消息体组成
+type pbCodec struct {
+	conn     io.ReadWriteCloser
+	r        *bufio.Reader
+	w        *bufio.Writer
+	maxBytes uint32
+	wmu      sync.Mutex // 服务端会在多个协程中写入响应
+	lenBuf   [binary.MaxVarintLen64]byte
+}
+
+func newPBCodec(conn io.ReadWriteCloser, maxBytes uint32) *pbCodec {
+	return &pbCodec{
+		conn:     conn,
+		r:        bufio.NewReader(conn),
+		w:        bufio.NewWriter(conn),
+		maxBytes: maxBytes,
+	}
+}
+
+// writeMessage 写入一条消息，m 不是 protobuf 消息时（如 net/rpc 出错时的占位响应）写入空消息
+func (c *pbCodec) writeMessage(m interface{}) error {
+	var body []byte
+	if msg, ok := m.(proto.Message); ok {
+		var err error
+		if body, err = proto.Marshal(msg); err != nil {
+			return err
+		}
+	}
+	n := binary.PutUvarint(c.lenBuf[:], uint64(len(body)))
+	if _, err := c.w.Write(c.lenBuf[:n]); err != nil {
+		return err
+	}
+	_, err := c.w.Write(body)
+	return err
+}
+
+// readMessage 读取一条消息，m 为 nil 时丢弃消息内容
+func (c *pbCodec) readMessage(m interface{}) error {
+	n, err := binary.ReadUvarint(c.r)
+	if err != nil {
+		return err
+	}
+	if n > uint64(c.maxBytes) {
+		return fmt.Errorf("消息长度超过上限：%d 字节", n)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return err
+	}
+	if m == nil {
+		return nil
+	}
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T 不是 protobuf 消息", m)
+	}
+	return proto.Unmarshal(body, msg)
+}
+
+func (c *pbCodec) write(header *pb.RPCHeader, body interface{}) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := c.writeMessage(header); err != nil {
+		return err
+	}
+	if err := c.writeMessage(body); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+func (c *pbCodec) Close() error {
+	return c.conn.Close()
+}
+
+// pbServerCodec 实现 rpc.ServerCodec
+type pbServerCodec struct{ *pbCodec }
+
+func (c pbServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	h := &pb.RPCHeader{}
+	if err := c.readMessage(h); err != nil {
+		return err
+	}
+	r.ServiceMethod = h.GetMethod()
+	r.Seq = h.GetSeq()
+	return nil
+}
+
+func (c pbServerCodec) ReadRequestBody(body interface{}) error {
+	return c.readMessage(body)
+}
+
+func (c pbServerCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	return c.write(&pb.RPCHeader{
+		Method: r.ServiceMethod,
+		Seq:    r.Seq,
+		Error:  strings.ToValidUTF8(r.Error, "�"),
+	}, body)
+}
+
+// pbClientCodec 实现 rpc.ClientCodec
+type pbClientCodec struct{ *pbCodec }
+
+func (c pbClientCodec) WriteRequest(r *rpc.Request, body interface{}) error {
+	return c.write(&pb.RPCHeader{Method: r.ServiceMethod, Seq: r.Seq}, body)
+}
+
+func (c pbClientCodec) ReadResponseHeader(r *rpc.Response) error {
+	h := &pb.RPCHeader{}
+	if err := c.readMessage(h); err != nil {
+		return err
+	}
+	r.ServiceMethod = h.GetMethod()
+	r.Seq = h.GetSeq()
+	r.Error = h.GetError()
+	return nil
+}
+
+func (c pbClientCodec) ReadResponseBody(body interface{}) error {
+	return c.readMessage(body)
+}
+
+// RPCPoolOptions 用于配置 RPCPool，零值字段使用默认值
+type RPCPoolOptions struct {
+	// Replicas 一致性哈希的虚拟节点倍数，默认为 50
+	Replicas int
+	// HashFn 一致性哈希使用的哈希函数，默认为 crc32.ChecksumIEEE
+	HashFn consistenthash.Hash
+	// DialTimeout 建立连接的超时时间
+	DialTimeout time.Duration
+	// Timeout 单次调用的超时时间
+	Timeout time.Duration
+	// MaxMessageBytes 允许的最大消息长度
+	MaxMessageBytes uint32
+	// MaxKeyLength group 和 key 的最大字节数
+	MaxKeyLength int
+	// MaxMultiKeys 单次 GetMulti 的最大 key 数，默认为 1000
+	MaxMultiKeys int
+	// AllowUnauthenticatedWrites 接受其他节点的写入（Set、Remove）。RPCPool 不支持认证，
+	// 开启后任何能访问端口的人都可以修改缓存，只应在可信网络中使用
+	AllowUnauthenticatedWrites bool
+}
+
+// RPCPool 使用 net/rpc 和 protobuf 编解码器实现 GroupCache 服务，
+// 地址格式与 TCPPool 相同，可以代替 HTTPPool 注册到 Group
+type RPCPool struct {
+	self   string
+	opts   RPCPoolOptions
+	server *rpc.Server
+
+	mu         sync.Mutex
+	peers      *consistenthash.Map
+	rpcGetters map[string]*RPCGetter
+	listeners  []net.Listener
+	closed     bool
+}
+
+// NewRPCPool 初始化 RPCPool，o 为 nil 时全部使用默认值
+func NewRPCPool(self string, o *RPCPoolOptions) *RPCPool {
+	p := &RPCPool{self: self}
+	if o != nil {
+		p.opts = *o
+	}
+	if p.opts.Replicas == 0 {
+		p.opts.Replicas = defaultReplicas
+	}
+	if p.opts.DialTimeout == 0 {
+		p.opts.DialTimeout = defaultDialTimeout
+	}
+	if p.opts.Timeout == 0 {
+		p.opts.Timeout = defaultRequestTimeout
+	}
+	if p.opts.MaxMessageBytes == 0 {
+		p.opts.MaxMessageBytes = defaultMaxFrameBytes
+	}
+	if p.opts.MaxKeyLength == 0 {
+		p.opts.MaxKeyLength = defaultMaxKeyLength
+	}
+	if p.opts.MaxMultiKeys == 0 {
+		p.opts.MaxMultiKeys = defaultMaxMultiKeys
+	}
+	p.server = rpc.NewServer()
+	svc := &GroupCacheService{
+		self:         self,
+		maxKeyLength: p.opts.MaxKeyLength,
+		maxMultiKeys: p.opts.MaxMultiKeys,
+		allowWrites:  p.opts.AllowUnauthenticatedWrites,
+	}
+	if err := p.server.RegisterName(rpcServiceName, svc); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Log 日志打印方法
+func (p *RPCPool) Log(format string, v ...interface{}) {
+	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+// ListenAndServe 监听本节点地址并处理其他节点的请求
+func (p *RPCPool) ListenAndServe() error {
+	network, address, err := parseTCPAddr(p.self)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	return p.Serve(l)
+}
+
+// Serve 在 l 上接受连接并处理请求，直到 l 被关闭
+func (p *RPCPool) Serve(l net.Listener) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		l.Close()
+		return ErrConnClosed
+	}
+	p.listeners = append(p.listeners, l)
+	p.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			p.mu.Lock()
+			closed := p.closed
+			p.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		go p.server.ServeCodec(pbServerCodec{newPBCodec(conn, p.opts.MaxMessageBytes)})
+	}
+}
+
+// Set 更新节点列表，地址格式与 self 相同
+func (p *RPCPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	p.peers.Add(peers...)
+	// 保留仍然存在的节点的连接，只为新节点创建 RPCGetter
+	old := p.rpcGetters
+	p.rpcGetters = make(map[string]*RPCGetter, len(peers))
+	for _, peer := range peers {
+		if g, ok := old[peer]; ok {
+			p.rpcGetters[peer] = g
+			delete(old, peer)
+			continue
+		}
+		p.rpcGetters[peer] = &RPCGetter{addr: peer, opts: &p.opts}
+	}
+	// 被移除的节点等正在进行的调用结束后再关闭连接
+	for _, g := range old {
+		time.AfterFunc(p.opts.Timeout, g.close)
+	}
+}
+
+var _ PeerPicker = (*RPCPool)(nil)
+
+// PickPeer 根据 key 选择对应的节点，返回的 PeerGetter 为 *RPCGetter
+func (p *RPCPool) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+		return p.rpcGetters[peer], true
+	}
+	return nil, false
+}
+
+// Close 关闭监听和所有到远程节点的连接
+func (p *RPCPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, l := range p.listeners {
+		l.Close()
+	}
+	for _, g := range p.rpcGetters {
+		g.close()
+	}
+	return nil
+}
+
+// RPCGetter 是 GroupCache 服务的客户端，除了 PeerGetter 的 Get 方法，
+// 还提供 Set、Remove、GetMulti、Stats 方法
+type RPCGetter struct {
+	addr string
+	opts *RPCPoolOptions
+
+	mu     sync.Mutex
+	client *rpc.Client
+}
+
+var _ PeerGetter = (*RPCGetter)(nil)
+
+// Get 获取 key 对应的值
+func (g *RPCGetter) Get(in *pb.Request, out *pb.Response) error {
+	if err := checkKeyLength(in.GetGroup(), in.GetKey(), g.opts.MaxKeyLength); err != nil {
+		return err
+	}
+	if err := g.call("Get", in, out); err != nil {
+		return err
+	}
+	return responseError(out)
+}
+
+// Set 将值写入远程节点的缓存
+func (g *RPCGetter) Set(in *pb.SetRequest) error {
+	if err := checkKeyLength(in.GetGroup(), in.GetKey(), g.opts.MaxKeyLength); err != nil {
+		return err
+	}
+	return g.call("Set", in, &pb.Empty{})
+}
+
+// Remove 从远程节点的缓存中删除 key
+func (g *RPCGetter) Remove(in *pb.Request) error {
+	if err := checkKeyLength(in.GetGroup(), in.GetKey(), g.opts.MaxKeyLength); err != nil {
+		return err
+	}
+	return g.call("Remove", in, &pb.Empty{})
+}
+
+// GetMulti 批量获取多个 key，通过一次调用完成
+func (g *RPCGetter) GetMulti(in *pb.GetMultiRequest, out *pb.GetMultiResponse) error {
+	for _, key := range in.GetKeys() {
+		if err := checkKeyLength(in.GetGroup(), key, g.opts.MaxKeyLength); err != nil {
+			return err
+		}
+	}
+	return g.call("GetMulti", in, out)
+}
+
+// Stats 获取远程节点上 group 的统计信息
+func (g *RPCGetter) Stats(in *pb.StatsRequest, out *pb.StatsResponse) error {
+	return g.call("Stats", in, out)
+}
+
+// call 调用远程方法，连接断开后下一次调用重新建立连接
+func (g *RPCGetter) call(method string, in, out proto.Message) error {
+	client, err := g.dial()
+	if err != nil {
+		return err
+	}
+	t := time.NewTimer(g.opts.Timeout)
+	defer t.Stop()
+	c := client.Go(rpcServiceName+"."+method, in, out, make(chan *rpc.Call, 1))
+	select {
+	case <-c.Done:
+		if errors.Is(c.Error, rpc.ErrShutdown) || errors.Is(c.Error, io.ErrUnexpectedEOF) {
+			g.reset(client)
+		}
+		return c.Error
+	case <-t.C:
+		return fmt.Errorf("请求超时：%v", g.opts.Timeout)
+	}
+}
+
+// dial 返回已有的连接，没有时建立新连接
+func (g *RPCGetter) dial() (*rpc.Client, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.client != nil {
+		return g.client, nil
+	}
+	network, address, err := parseTCPAddr(g.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout(network, address, g.opts.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	g.client = rpc.NewClientWithCodec(pbClientCodec{newPBCodec(conn, g.opts.MaxMessageBytes)})
+	return g.client, nil
+}
+
+// reset 丢弃已经断开的连接
+func (g *RPCGetter) reset(client *rpc.Client) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.client == client {
+		g.client.Close()
+		g.client = nil
+	}
+}
+
+func (g *RPCGetter) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.client != nil {
+		g.client.Close()
+		g.client = nil
+	}
+}
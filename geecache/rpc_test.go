@@ -0,0 +1,146 @@
+package geecache
+
+import (
+	"fmt"
+	pb "geecache/geecachepb"
+	"net"
+	"strings"
+	"testing"
+)
+
+// startRPCPeer 在随机端口上启动一个 RPCPool 服务端，返回其地址
+func startRPCPeer(t testing.TB, o *RPCPoolOptions) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := "tcp://" + l.Addr().String()
+	p := NewRPCPool(addr, o)
+	go p.Serve(l)
+	t.Cleanup(func() { p.Close() })
+	return addr
+}
+
+func TestRPCPool(t *testing.T) {
+	g := NewGroup("rpc-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, fmt.Errorf("%s not exist", key)
+		}
+		return []byte("value:" + key), nil
+	}))
+	local := NewRPCPool("local", nil)
+	defer local.Close()
+	local.Set(startRPCPeer(t, &RPCPoolOptions{AllowUnauthenticatedWrites: true, MaxMultiKeys: 3}))
+	peer, ok := local.PickPeer("Tom")
+	if !ok {
+		t.Fatalf("应该选择远程节点")
+	}
+	rg := peer.(*RPCGetter)
+	group := []byte("rpc-scores")
+
+	// 1.Get
+	res := &pb.Response{}
+	if err := rg.Get(&pb.Request{Group: group, Key: []byte("Tom")}, res); err != nil || string(res.GetValue()) != "value:Tom" {
+		t.Fatalf("Get 失败：%q %v", res.GetValue(), err)
+	}
+	if err := rg.Get(&pb.Request{Group: []byte("rpc-unknown"), Key: []byte("Tom")}, &pb.Response{}); err == nil {
+		t.Fatalf("不存在的 group 应该返回错误")
+	}
+
+	// 2.Set 后直接命中缓存，不再调用回调函数
+	if err := rg.Set(&pb.SetRequest{Group: group, Key: []byte("Jack"), Value: []byte("589")}); err != nil {
+		t.Fatalf("Set 失败：%v", err)
+	}
+	if v, ok := g.mainCache.Get("Jack"); !ok || v.String() != "589" {
+		t.Fatalf("Set 之后应该写入缓存，实际 %q", v)
+	}
+
+	// 3.Remove 后重新调用回调函数
+	if err := rg.Remove(&pb.Request{Group: group, Key: []byte("Jack")}); err != nil {
+		t.Fatalf("Remove 失败：%v", err)
+	}
+	if _, ok := g.mainCache.Get("Jack"); ok {
+		t.Fatalf("Remove 之后不应该命中缓存")
+	}
+
+	// 4.GetMulti 中单个 key 失败不影响其他 key
+	multi := &pb.GetMultiResponse{}
+	keys := [][]byte{[]byte("a"), []byte("missing"), []byte("b")}
+	if err := rg.GetMulti(&pb.GetMultiRequest{Group: group, Keys: keys}, multi); err != nil {
+		t.Fatalf("GetMulti 失败：%v", err)
+	}
+	items := multi.GetItems()
+	if len(items) != 3 || string(items[0].GetValue()) != "value:a" || items[1].GetError() == "" ||
+		string(items[2].GetValue()) != "value:b" {
+		t.Fatalf("GetMulti 结果错误：%v", items)
+	}
+	keys = append(keys, []byte("c"))
+	if err := rg.GetMulti(&pb.GetMultiRequest{Group: group, Keys: keys}, &pb.GetMultiResponse{}); err == nil ||
+		!strings.Contains(err.Error(), ErrTooManyKeys.Error()) {
+		t.Fatalf("key 超过 MaxMultiKeys 时应该返回错误，实际 %v", err)
+	}
+
+	// 5.Stats
+	stats := &pb.StatsResponse{}
+	if err := rg.Stats(&pb.StatsRequest{Group: group}, stats); err != nil {
+		t.Fatalf("Stats 失败：%v", err)
+	}
+	if stats.GetServerRequests() != 4 || stats.GetLocalLoads() != 3 || stats.GetLocalLoadErrs() != 1 {
+		t.Fatalf("统计信息错误：%v", stats)
+	}
+}
+
+// 测试默认不接受其他节点的写入
+func TestRPCPoolRejectsWrites(t *testing.T) {
+	g := NewGroup("rpc-readonly", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	local := NewRPCPool("local", nil)
+	defer local.Close()
+	local.Set(startRPCPeer(t, nil))
+	peer, _ := local.PickPeer("Tom")
+	rg := peer.(*RPCGetter)
+	group := []byte("rpc-readonly")
+	err := rg.Set(&pb.SetRequest{Group: group, Key: []byte("Tom"), Value: []byte("630")})
+	if err == nil || !strings.Contains(err.Error(), ErrPeerWritesDisabled.Error()) {
+		t.Fatalf("未开启 AllowUnauthenticatedWrites 时 Set 应该被拒绝，实际 %v", err)
+	}
+	if err := rg.Remove(&pb.Request{Group: group, Key: []byte("Tom")}); err == nil {
+		t.Fatalf("未开启 AllowUnauthenticatedWrites 时 Remove 应该被拒绝")
+	}
+	if _, ok := g.mainCache.Get("Tom"); ok {
+		t.Fatalf("被拒绝的写入不应该修改缓存")
+	}
+}
+
+// 测试连接断开后客户端自动重新连接
+func TestRPCGetterReconnect(t *testing.T) {
+	NewGroup("rpc-reconnect", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	local := NewRPCPool("local", nil)
+	defer local.Close()
+	local.Set(startRPCPeer(t, nil))
+	peer, _ := local.PickPeer("k")
+	req := &pb.Request{Group: []byte("rpc-reconnect"), Key: []byte("k")}
+	if err := peer.Get(req, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	// 断开客户端连接，之后的调用重新建立连接
+	peer.(*RPCGetter).close()
+	if err := peer.Get(req, &pb.Response{}); err != nil {
+		t.Fatalf("连接断开后应该重新连接：%v", err)
+	}
+}
+
+func BenchmarkRPCPoolGet(b *testing.B) {
+	NewGroup("bench-rpc", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return make([]byte, 128), nil
+	}))
+	local := NewRPCPool("local", nil)
+	defer local.Close()
+	local.Set(startRPCPeer(b, nil))
+	peer, _ := local.PickPeer("Tom")
+	benchmarkPeerGet(b, peer, "bench-rpc")
+}
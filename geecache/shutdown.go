@@ -0,0 +1,289 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	pb "geecache/geecachepb"
+	"github.com/golang/protobuf/proto"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// 优雅下线的顺序：
+// 1.HTTPPool.Leave 通知其他节点将自己移出哈希环，自己的哈希环中也不再包含自己；
+// 2.Group.Handoff 将最近访问的条目写入它们新的所有者，避免这些 key 全部变冷；
+// 3.http.Server.Shutdown 停止接受新的连接，等待正在处理的请求结束。
+// 写入和下线通知会修改其他节点的缓存和哈希环，只有配置了 HMAC 或双向认证
+// （或者显式设置了 AllowUnauthenticatedWrites）时才会发送和接受。
+
+const (
+	leavePath = "_leave" // 下线通知接口：/<basepath>/_leave
+
+	peerHeader    = "X-Geecache-Peer"    // 发出请求的节点地址
+	leavingHeader = "X-Geecache-Leaving" // 发出请求的节点正在下线
+
+	defaultHandoffConcurrency = 8
+)
+
+// ErrPeerWritesDisabled 未配置 HMAC 或双向认证，不能发送或接受写入和下线通知
+var ErrPeerWritesDisabled = errors.New("未配置 HMAC 或双向认证，节点间写入和下线通知已禁用")
+
+// peerWritesAllowed 是否发送和接受写入、下线通知
+func (p *HTTPPool) peerWritesAllowed() bool {
+	return p.auth != nil || (p.opts.TLS != nil && p.opts.TLS.ClientAuth) || p.opts.AllowUnauthenticatedWrites
+}
+
+// PeerWriter 支持将值写入远程节点，httpGetter 和 RPCGetter 实现了该接口
+type PeerWriter interface {
+	Set(in *pb.SetRequest) error
+}
+
+// setPeerHeader 带上自己的地址，下线后重新上线的节点通过它被其他节点重新加入哈希环
+func (h *httpGetter) setPeerHeader(req *http.Request) {
+	if h.pool == nil {
+		return
+	}
+	req.Header.Set(peerHeader, h.pool.self)
+	h.pool.mu.Lock()
+	leaving := h.pool.leaving
+	h.pool.mu.Unlock()
+	if leaving {
+		req.Header.Set(leavingHeader, "1")
+	}
+}
+
+// newPeerRequest 构造发往远程节点的非 Get 请求，带上来源节点并签名
+func (h *httpGetter) newPeerRequest(ctx context.Context, method, url string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	h.setPeerHeader(req)
+	if h.auth != nil {
+		if err = h.auth.sign(req, body); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// do 发送请求并检查状态码
+func (h *httpGetter) do(req *http.Request) error {
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return h.readError(res)
+	}
+	io.Copy(io.Discard, io.LimitReader(res.Body, h.maxBytes))
+	return nil
+}
+
+// Set 将值写入远程节点的缓存
+func (h *httpGetter) Set(in *pb.SetRequest) error {
+	if err := checkKeyLength(in.GetGroup(), in.GetKey(), h.maxKeyLength); err != nil {
+		return err
+	}
+	req, err := h.newPeerRequest(context.Background(), http.MethodPut, h.baseURL+encodePeerPath(in.GetGroup(), in.GetKey()), in.GetValue())
+	if err != nil {
+		return err
+	}
+	return h.do(req)
+}
+
+// Set 写入只发给主节点
+func (h *hedgedGetter) Set(in *pb.SetRequest) error {
+	return h.primary.Set(in)
+}
+
+// Leave 通知所有远程节点自己即将下线，并将自己移出哈希环，之后 PickPeer 为所有 key 选择远程节点。
+// 其他节点收到通知后立即将自己移出哈希环；之后收到本节点不带下线标记的请求（重新上线）时再加入
+func (p *HTTPPool) Leave(ctx context.Context) error {
+	if !p.peerWritesAllowed() {
+		return ErrPeerWritesDisabled
+	}
+	p.mu.Lock()
+	p.leaving = true
+	p.rebuildRing()
+	getters := make([]*httpGetter, 0, len(p.httpGetters))
+	for peer, g := range p.httpGetters {
+		if peer != p.self {
+			getters = append(getters, g)
+		}
+	}
+	p.mu.Unlock()
+	p.Log("通知 %d 个节点自己即将下线", len(getters))
+
+	errs := make([]error, len(getters))
+	var wg sync.WaitGroup
+	for i, g := range getters {
+		wg.Add(1)
+		go func(i int, g *httpGetter) {
+			defer wg.Done()
+			req, err := g.newPeerRequest(ctx, http.MethodPost, g.baseURL+leavePath, nil)
+			if err == nil {
+				err = g.do(req)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("通知节点 %s 失败：%w", g.peer, err)
+			}
+		}(i, g)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// serveLeave 处理其他节点的下线通知
+func (p *HTTPPool) serveLeave(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "只支持 POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if !p.peerWritesAllowed() {
+		http.Error(w, ErrPeerWritesDisabled.Error(), http.StatusForbidden)
+		return
+	}
+	peer := r.Header.Get(peerHeader)
+	p.mu.Lock()
+	g, ok := p.httpGetters[peer]
+	changed := ok && peer != p.self && !g.health.left
+	if changed {
+		g.health.left = true
+		p.leftPeers.Add(1)
+		p.rebuildRing()
+	}
+	p.mu.Unlock()
+	if changed {
+		p.Log("节点 %s 主动下线，移出哈希环", peer)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// peerSeen 收到主动下线的节点不带下线标记的请求，说明它已经重新上线；
+// 来源节点只有在请求经过认证时才可信
+func (p *HTTPPool) peerSeen(r *http.Request) {
+	if p.leftPeers.Load() == 0 || r.Header.Get(leavingHeader) != "" || !p.peerWritesAllowed() {
+		return
+	}
+	peer := r.Header.Get(peerHeader)
+	if peer == "" {
+		return
+	}
+	p.mu.Lock()
+	g, ok := p.httpGetters[peer]
+	readmit := ok && g.health.left
+	if readmit {
+		g.health.left = false
+		p.leftPeers.Add(-1)
+		p.rebuildRing()
+	}
+	p.mu.Unlock()
+	if readmit {
+		p.Log("节点 %s 重新上线，加入哈希环", peer)
+	}
+}
+
+// serveSet 处理其他节点的写入请求，请求体为原始的值，只接受本节点负责的 key
+func (p *HTTPPool) serveSet(w http.ResponseWriter, r *http.Request) {
+	var res *pb.Response
+	groupName, key, err := decodePeerPath(r.URL.Path[len(p.basePath):])
+	if !p.peerWritesAllowed() {
+		res = errorResponse(p.self, pb.Code_FORBIDDEN, ErrPeerWritesDisabled)
+	} else if err != nil {
+		res = errorResponse(p.self, pb.Code_BAD_REQUEST, err)
+	} else if group, errRes := lookupGroup(p.self, &pb.Request{Group: groupName, Key: key}, p.opts.MaxKeyLength); errRes != nil {
+		res = errRes
+	} else if !p.owns(string(key)) {
+		res = errorResponse(p.self, pb.Code_FORBIDDEN, fmt.Errorf("本节点不是 %q 的所有者", key))
+	} else if value, err := io.ReadAll(io.LimitReader(r.Body, p.opts.MaxResponseBytes+1)); err != nil {
+		res = errorResponse(p.self, pb.Code_BAD_REQUEST, err)
+	} else if int64(len(value)) > p.opts.MaxResponseBytes {
+		res = errorResponse(p.self, pb.Code_BAD_REQUEST, fmt.Errorf("值超过 %d 字节", p.opts.MaxResponseBytes))
+	} else if p.auth != nil && p.auth.verifyBody(r, value) != nil {
+		res = errorResponse(p.self, pb.Code_FORBIDDEN, errUnauthorized)
+	} else {
+		group.Set(string(key), value)
+		res = &pb.Response{ServerId: p.self, ProtocolVersion: ProtocolVersion}
+	}
+	body, _ := proto.Marshal(res)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(httpStatus(res.GetCode()))
+	w.Write(body)
+}
+
+// pickOwner 选择 key 在哈希环上的所有者；实现了 HotKeyPicker 时不选择副本，
+// 其他 PeerPicker 的 PickPeer 本身就只选择所有者
+func (g *Group) pickOwner(key string) (PeerGetter, bool) {
+	if g.peers == nil {
+		return nil, false
+	}
+	if hk, ok := g.peers.(HotKeyPicker); ok {
+		return hk.PickOwner(key)
+	}
+	return g.peers.PickPeer(key)
+}
+
+// owns 本节点是否为 key 在哈希环上的所有者
+func (p *HTTPPool) owns(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.peers != nil && p.peers.Get(key) == p.self
+}
+
+// Handoff 将最近访问的最多 n 个条目写入它们现在的所有者，返回成功写入的条目数。
+// 在节点下线前、HTTPPool.Leave 之后调用，此时哈希环中已经不再包含自己；
+// 只写入所有者（不是热点或同一可用区的副本），也不会计入热点统计；
+// 仍然由自己负责或者节点不支持写入（PeerWriter）的条目被跳过
+func (g *Group) Handoff(ctx context.Context, n int) (int, error) {
+	if g.peers == nil {
+		return 0, nil
+	}
+	// 分块的数据随清单一起交接
+	entries := g.mainCache.hottest(n, func(key string, _ ByteView) bool { return !isChunkKey(key) })
+	var (
+		mu       sync.Mutex
+		sent     int
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	sem := make(chan struct{}, defaultHandoffConcurrency)
+	for _, e := range entries {
+		peer, ok := g.pickOwner(e.key)
+		if !ok {
+			continue
+		}
+		pw, ok := peer.(PeerWriter)
+		if !ok {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return sent, ctx.Err()
+		}
+		wg.Add(1)
+		go func(e cacheEntry) {
+			defer func() { <-sem; wg.Done() }()
+			// 分块已被淘汰的条目直接跳过，不重新加载
+			v, err := g.resolve(e.key, e.value, func() (ByteView, error) { return ByteView{}, errChunkMissing })
+			if err == nil {
+				err = pw.Set(&pb.SetRequest{Group: []byte(g.name), Key: []byte(e.key), Value: v.rawBytes()})
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				sent++
+			} else if firstErr == nil && !errors.Is(err, errChunkMissing) {
+				firstErr = fmt.Errorf("交接 %q 失败：%w", e.key, err)
+			}
+		}(e)
+	}
+	wg.Wait()
+	return sent, firstErr
+}
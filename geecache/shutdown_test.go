@@ -0,0 +1,148 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	pb "geecache/geecachepb"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 测试主动下线：其他节点将自己移出哈希环，最近访问的条目交接给新的所有者，重新上线后再加入哈希环
+func TestLeaveAndHandoff(t *testing.T) {
+	// 1.节点 B 注册了 group，A 使用未注册的本地 group，两者使用相同的节点列表
+	var poolB *HTTPPool
+	srvB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		poolB.ServeHTTP(w, r)
+	}))
+	defer srvB.Close()
+	self := "http://a.invalid"
+	opts := &HTTPPoolOptions{HMAC: &HMACOptions{Keys: testKeys, SignKeyID: "k1"}}
+	poolB = NewHTTPPoolOpts(srvB.URL, opts)
+	poolB.Set(self, srvB.URL)
+	groupB := NewGroup("shutdown-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s：%w", key, ErrNotFound)
+	}))
+	poolA := NewHTTPPoolOpts(self, opts)
+	poolA.Set(self, srvB.URL)
+	groupA := newLocalGroup("shutdown-scores", nil, poolA)
+	for i := 0; i < 20; i++ {
+		groupA.Set(fmt.Sprintf("key-%d", i), []byte(fmt.Sprintf("value-%d", i)))
+	}
+
+	// 2.A 下线后 B 不再选择 A
+	if err := poolA.Leave(context.Background()); err != nil {
+		t.Fatalf("下线失败：%v", err)
+	}
+	for i := 0; i < 100; i++ {
+		if peer, ok := poolB.PickPeer(fmt.Sprintf("key-%d", i)); ok {
+			t.Fatalf("A 已下线，B 不应该选择远程节点 %v", peer.(*httpGetter).peer)
+		}
+	}
+
+	// 3.交接后 B 的本地缓存中有全部条目
+	n, err := groupA.Handoff(context.Background(), 10)
+	if err != nil || n != 10 {
+		t.Fatalf("期望交接 10 个条目，实际 %d，错误 %v", n, err)
+	}
+	for i := 10; i < 20; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if v, ok := groupB.mainCache.Get(key); !ok || v.String() != fmt.Sprintf("value-%d", i) {
+			t.Fatalf("%s 没有交接给 B：%q", key, v.String())
+		}
+	}
+	if _, ok := groupB.mainCache.Get("key-0"); ok {
+		t.Fatalf("只应该交接最近访问的 10 个条目")
+	}
+
+	// 4.A 重新上线，不带下线标记的请求使 B 将 A 重新加入哈希环
+	poolA2 := NewHTTPPoolOpts(self, opts)
+	poolA2.Set(self, srvB.URL)
+	// 请求到达时 B 先将 A 加入哈希环，因此写入的是加入后仍由 B 负责的 key
+	key := "k0"
+	for i := 1; poolA2.owns(key); i++ {
+		key = fmt.Sprintf("k%d", i)
+	}
+	if err := poolA2.httpGetters[srvB.URL].Set(&pb.SetRequest{Group: []byte("shutdown-scores"), Key: []byte(key), Value: []byte("v")}); err != nil {
+		t.Fatalf("写入 B 失败：%v", err)
+	}
+	picked := false
+	for i := 0; i < 100 && !picked; i++ {
+		_, picked = poolB.PickPeer(fmt.Sprintf("key-%d", i))
+	}
+	if !picked {
+		t.Fatalf("A 重新上线后应该重新加入 B 的哈希环")
+	}
+}
+
+// 测试写入和下线通知需要认证，并且只接受本节点负责的 key
+func TestPeerWritesAuth(t *testing.T) {
+	NewGroup("shutdown-auth", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	var poolB *HTTPPool
+	srvB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		poolB.ServeHTTP(w, r)
+	}))
+	defer srvB.Close()
+	opts := &HTTPPoolOptions{HMAC: &HMACOptions{Keys: testKeys, SignKeyID: "k1"}}
+	poolB = NewHTTPPoolOpts(srvB.URL, opts)
+	self := "http://a.invalid"
+	poolB.Set(self, srvB.URL)
+	// 找到 B 负责和 A 负责的 key
+	var ownedByB, ownedByA string
+	for i := 0; ownedByA == "" || ownedByB == ""; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if poolB.owns(key) {
+			ownedByB = key
+		} else {
+			ownedByA = key
+		}
+	}
+	set := func(pool *HTTPPool, key string) error {
+		return pool.httpGetters[srvB.URL].Set(&pb.SetRequest{Group: []byte("shutdown-auth"), Key: []byte(key), Value: []byte("v")})
+	}
+
+	// 1.未配置认证时不发送下线通知，也拒绝写入
+	plain := NewHTTPPool(self)
+	plain.Set(self, srvB.URL)
+	if err := plain.Leave(context.Background()); err != ErrPeerWritesDisabled {
+		t.Fatalf("期望 ErrPeerWritesDisabled，实际 %v", err)
+	}
+	if err := set(plain, ownedByB); err == nil {
+		t.Fatalf("未签名的写入应该被拒绝")
+	}
+	open := NewHTTPPool(srvB.URL)
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, defaultBasePath+leavePath, nil)
+	req.Header.Set(peerHeader, self)
+	open.ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("未配置认证时应该拒绝下线通知，实际 %d", res.Code)
+	}
+
+	// 2.签名的写入只接受 B 负责的 key
+	signed := NewHTTPPoolOpts(self, opts)
+	signed.Set(self, srvB.URL)
+	if err := set(signed, ownedByB); err != nil {
+		t.Fatalf("写入 B 负责的 key 失败：%v", err)
+	}
+	if err := set(signed, ownedByA); err == nil || !strings.Contains(err.Error(), "FORBIDDEN") {
+		t.Fatalf("B 不负责的 key 应该被拒绝，实际 %v", err)
+	}
+
+	// 3.请求体被篡改时签名校验失败
+	g := signed.httpGetters[srvB.URL]
+	req, err := g.newPeerRequest(context.Background(), http.MethodPut, g.baseURL+encodePeerPath([]byte("shutdown-auth"), []byte(ownedByB)), []byte("v"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Body = io.NopCloser(strings.NewReader("tampered"))
+	req.ContentLength = int64(len("tampered"))
+	if err := g.do(req); err == nil {
+		t.Fatalf("篡改请求体的写入应该被拒绝")
+	}
+}
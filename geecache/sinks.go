@@ -0,0 +1,238 @@
+package geecache
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+)
+
+// Sink 接收 Get 返回的值，GetInto 直接将值写入调用方的类型，
+// 不需要先拿到 ByteView 再复制、解码
+type Sink interface {
+	// SetString 将值设置为 s
+	SetString(s string) error
+	// SetBytes 将值设置为 v 的内容，调用方保留 v 的所有权，Sink 需要保存时自行复制
+	SetBytes(v []byte) error
+	// SetProto 将值设置为 m 的编码结果，调用方保留 m 的所有权
+	SetProto(m proto.Message) error
+}
+
+// viewSetter 内置的 Sink 都实现了该接口，直接使用 ByteView，避免不必要的复制
+type viewSetter interface {
+	setView(v ByteView) error
+}
+
+// setSinkView 将 v 写入 s
+func setSinkView(s Sink, v ByteView) error {
+	if vs, ok := s.(viewSetter); ok {
+		return vs.setView(v)
+	}
+	// 自定义的 Sink 可能会修改传入的字节，传入拷贝
+	return s.SetBytes(v.ByteSlice())
+}
+
+// GetInto 获取 key 对应的值并写入 dest
+func (g *Group) GetInto(key string, dest Sink) error {
+	if dest == nil {
+		return errors.New("dest 不能为 nil")
+	}
+	v, err := g.Get(key)
+	if err != nil {
+		return err
+	}
+	return setSinkView(dest, v)
+}
+
+// StringSink 将值写入 *sp
+func StringSink(sp *string) Sink {
+	return &stringSink{sp: sp}
+}
+
+type stringSink struct {
+	sp *string
+}
+
+func (s *stringSink) setView(v ByteView) error {
+	*s.sp = v.String() // 字符串形式的值不需要复制
+	return nil
+}
+
+func (s *stringSink) SetString(v string) error {
+	*s.sp = v
+	return nil
+}
+
+func (s *stringSink) SetBytes(v []byte) error {
+	*s.sp = string(v)
+	return nil
+}
+
+func (s *stringSink) SetProto(m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	*s.sp = string(b)
+	return nil
+}
+
+// ByteViewSink 将值写入 *dst，不复制数据
+func ByteViewSink(dst *ByteView) Sink {
+	return &byteViewSink{dst: dst}
+}
+
+type byteViewSink struct {
+	dst *ByteView
+}
+
+func (s *byteViewSink) setView(v ByteView) error {
+	*s.dst = v
+	return nil
+}
+
+func (s *byteViewSink) SetString(v string) error {
+	*s.dst = ByteView{s: v}
+	return nil
+}
+
+func (s *byteViewSink) SetBytes(v []byte) error {
+	*s.dst = ByteView{b: cloneBytes(v)}
+	return nil
+}
+
+func (s *byteViewSink) SetProto(m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	*s.dst = ByteView{b: b}
+	return nil
+}
+
+// AllocatingByteSliceSink 将值的拷贝写入 *dst，调用方可以随意修改
+func AllocatingByteSliceSink(dst *[]byte) Sink {
+	return &allocBytesSink{dst: dst}
+}
+
+type allocBytesSink struct {
+	dst *[]byte
+}
+
+func (s *allocBytesSink) setView(v ByteView) error {
+	*s.dst = v.ByteSlice()
+	return nil
+}
+
+func (s *allocBytesSink) SetString(v string) error {
+	*s.dst = []byte(v)
+	return nil
+}
+
+func (s *allocBytesSink) SetBytes(v []byte) error {
+	*s.dst = cloneBytes(v)
+	return nil
+}
+
+func (s *allocBytesSink) SetProto(m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	*s.dst = b
+	return nil
+}
+
+// TruncatingByteSliceSink 将值复制到 *dst 已有的空间中，不分配内存，
+// 值超过 len(*dst) 时截断，*dst 的长度设置为复制的字节数
+func TruncatingByteSliceSink(dst *[]byte) Sink {
+	return &truncBytesSink{dst: dst}
+}
+
+type truncBytesSink struct {
+	dst *[]byte
+}
+
+func (s *truncBytesSink) setView(v ByteView) error {
+	n := v.Copy(*s.dst)
+	*s.dst = (*s.dst)[:n]
+	return nil
+}
+
+func (s *truncBytesSink) SetString(v string) error {
+	return s.setView(ByteView{s: v})
+}
+
+func (s *truncBytesSink) SetBytes(v []byte) error {
+	return s.setView(ByteView{b: v})
+}
+
+func (s *truncBytesSink) SetProto(m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return s.setView(ByteView{b: b})
+}
+
+// ProtoSink 将值解码到 m，值必须是 protobuf 编码
+func ProtoSink(m proto.Message) Sink {
+	return &protoSink{dst: m}
+}
+
+type protoSink struct {
+	dst proto.Message
+}
+
+func (s *protoSink) setView(v ByteView) error {
+	// proto.Unmarshal 不会保留或修改传入的字节
+	return proto.Unmarshal(v.rawBytes(), s.dst)
+}
+
+func (s *protoSink) SetString(v string) error {
+	return proto.Unmarshal([]byte(v), s.dst)
+}
+
+func (s *protoSink) SetBytes(v []byte) error {
+	return proto.Unmarshal(v, s.dst)
+}
+
+func (s *protoSink) SetProto(m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(b, s.dst)
+}
+
+// JSONSink 将值解码到 v，值必须是 JSON 编码，v 的要求与 json.Unmarshal 相同
+func JSONSink(v interface{}) Sink {
+	return &jsonSink{dst: v}
+}
+
+type jsonSink struct {
+	dst interface{}
+}
+
+func (s *jsonSink) setView(v ByteView) error {
+	// json.Unmarshal 不会保留或修改传入的字节
+	return json.Unmarshal(v.rawBytes(), s.dst)
+}
+
+func (s *jsonSink) SetString(v string) error {
+	return json.Unmarshal([]byte(v), s.dst)
+}
+
+func (s *jsonSink) SetBytes(v []byte) error {
+	return json.Unmarshal(v, s.dst)
+}
+
+// SetProto 将 m 按 protobuf 的 JSON 映射编码（字段名为 lowerCamelCase）后再解码到 v
+func (s *jsonSink) SetProto(m proto.Message) error {
+	b, err := new(jsonpb.Marshaler).MarshalToString(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(b), s.dst)
+}
@@ -0,0 +1,90 @@
+package geecache
+
+import (
+	pb "geecache/geecachepb"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// recordSink 没有实现 viewSetter 的自定义 Sink
+type recordSink struct {
+	got []byte
+}
+
+func (s *recordSink) SetString(v string) error { s.got = []byte(v); return nil }
+func (s *recordSink) SetBytes(v []byte) error  { s.got = v; return nil }
+func (s *recordSink) SetProto(m proto.Message) error {
+	b, err := proto.Marshal(m)
+	s.got = b
+	return err
+}
+
+func TestGetInto(t *testing.T) {
+	item, _ := proto.Marshal(&pb.Item{Key: []byte("Tom"), Value: []byte("630")})
+	values := map[string][]byte{
+		"str":   []byte("hello"),
+		"json":  []byte(`{"name":"Tom","score":630}`),
+		"proto": item,
+	}
+	g := NewGroup("sinks", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return values[key], nil
+	}))
+
+	var s string
+	if err := g.GetInto("str", StringSink(&s)); err != nil || s != "hello" {
+		t.Fatalf("StringSink 错误：%q %v", s, err)
+	}
+	var v ByteView
+	if err := g.GetInto("str", ByteViewSink(&v)); err != nil || !v.EqualString("hello") {
+		t.Fatalf("ByteViewSink 错误：%v", err)
+	}
+
+	// 1.AllocatingByteSliceSink 返回拷贝，修改后不影响缓存
+	var b []byte
+	if err := g.GetInto("str", AllocatingByteSliceSink(&b)); err != nil || string(b) != "hello" {
+		t.Fatalf("AllocatingByteSliceSink 错误：%q %v", b, err)
+	}
+	b[0] = 'x'
+	if v, _ := g.Get("str"); v.String() != "hello" {
+		t.Fatalf("修改 AllocatingByteSliceSink 的结果不应该影响缓存")
+	}
+
+	// 2.TruncatingByteSliceSink 按已有空间截断
+	buf := make([]byte, 3)
+	if err := g.GetInto("str", TruncatingByteSliceSink(&buf)); err != nil || string(buf) != "hel" {
+		t.Fatalf("TruncatingByteSliceSink 错误：%q %v", buf, err)
+	}
+
+	// 3.解码为 protobuf 和 JSON
+	var msg pb.Item
+	if err := g.GetInto("proto", ProtoSink(&msg)); err != nil || string(msg.GetValue()) != "630" {
+		t.Fatalf("ProtoSink 错误：%v", err)
+	}
+	var obj struct {
+		Name  string `json:"name"`
+		Score int    `json:"score"`
+	}
+	if err := g.GetInto("json", JSONSink(&obj)); err != nil || obj.Name != "Tom" || obj.Score != 630 {
+		t.Fatalf("JSONSink 错误：%+v %v", obj, err)
+	}
+	if err := g.GetInto("str", JSONSink(&obj)); err == nil {
+		t.Fatalf("值不是 JSON 时应该返回错误")
+	}
+	var req struct {
+		ProtocolVersion uint32 `json:"protocolVersion"`
+	}
+	if err := JSONSink(&req).SetProto(&pb.Request{ProtocolVersion: 2}); err != nil || req.ProtocolVersion != 2 {
+		t.Fatalf("JSONSink.SetProto 错误：%+v %v", req, err)
+	}
+
+	// 4.自定义的 Sink 收到的是拷贝
+	rs := &recordSink{}
+	if err := g.GetInto("str", rs); err != nil || string(rs.got) != "hello" {
+		t.Fatalf("自定义 Sink 错误：%v", err)
+	}
+	rs.got[0] = 'x'
+	if v, _ := g.Get("str"); v.String() != "hello" {
+		t.Fatalf("修改自定义 Sink 的结果不应该影响缓存")
+	}
+}
@@ -0,0 +1,123 @@
+package geecache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 快照：重启前将本地缓存按访问顺序保存到文件，启动时恢复，避免部署后所有节点同时回源。
+// 文件格式由 lru.Cache.Snapshot 定义（带版本号和校验和），每个值编码为：
+//
+//	标志位 | uvarint(len(压缩算法)) | 压缩算法 | varint(版本号) | varint(过期时间) | 缓存中的字节
+//
+// 值按缓存中的编码保存（压缩、分块），过期时间为 Unix 纳秒，0 表示不过期。
+
+const snapshotChunked = 1 << 0 // 标志位：分块存储的清单
+
+// encodeSnapshotView 将缓存中的值编码为快照中的字节
+func encodeSnapshotView(v ByteView) []byte {
+	var flags byte
+	if v.chunked {
+		flags |= snapshotChunked
+	}
+	var expire int64
+	if !v.e.IsZero() {
+		expire = v.e.UnixNano()
+	}
+	b := make([]byte, 0, 1+binary.MaxVarintLen64*3+len(v.enc)+v.Len())
+	b = append(b, flags)
+	b = binary.AppendUvarint(b, uint64(len(v.enc)))
+	b = append(b, v.enc...)
+	b = binary.AppendVarint(b, v.version)
+	b = binary.AppendVarint(b, expire)
+	return append(b, v.rawBytes()...)
+}
+
+// decodeSnapshotView 解码快照中的值，格式错误或压缩算法未注册时返回 false
+func decodeSnapshotView(b []byte) (ByteView, bool) {
+	if len(b) == 0 {
+		return ByteView{}, false
+	}
+	v := ByteView{chunked: b[0]&snapshotChunked != 0}
+	b = b[1:]
+	n, k := binary.Uvarint(b)
+	if k <= 0 || uint64(len(b)-k) < n {
+		return ByteView{}, false
+	}
+	v.enc, b = string(b[k:k+int(n)]), b[k+int(n):]
+	if _, ok := getCompressor(v.enc); v.enc != "" && !ok {
+		return ByteView{}, false
+	}
+	if v.version, k = binary.Varint(b); k <= 0 {
+		return ByteView{}, false
+	}
+	b = b[k:]
+	expire, k := binary.Varint(b)
+	if k <= 0 {
+		return ByteView{}, false
+	}
+	if expire != 0 {
+		v.e = time.Unix(0, expire)
+	}
+	v.b = b[k:]
+	return v, true
+}
+
+// Snapshot 按从最久未访问到最近访问的顺序将本地缓存中未过期的条目写入 w，返回写入的条目数
+func (g *Group) Snapshot(w io.Writer) (int, error) {
+	return g.mainCache.snapshot(w, func(key string, v ByteView) []byte {
+		return encodeSnapshotView(v)
+	})
+}
+
+// Restore 读取 Snapshot 写入的快照并加入本地缓存，返回恢复的条目数。
+// 快照损坏时返回错误并且不修改缓存；已经过期的条目被跳过，超过缓存容量时只恢复最近访问的条目
+func (g *Group) Restore(r io.Reader) (int, error) {
+	return g.mainCache.restore(r, func(key string, data []byte) (ByteView, bool) {
+		return decodeSnapshotView(data)
+	})
+}
+
+// SnapshotFile 将本地缓存保存到 path，先写入临时文件再重命名，失败时不影响原来的快照
+func (g *Group) SnapshotFile(path string) (int, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	n, err := g.Snapshot(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("保存 group %q 的快照失败：%w", g.name, err)
+	}
+	log.Printf("[Group %s] 保存了 %d 个条目到快照 %s", g.name, n, path)
+	return n, nil
+}
+
+// RestoreFile 从 path 恢复本地缓存，文件不存在时返回的错误满足 errors.Is(err, os.ErrNotExist)
+func (g *Group) RestoreFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	n, err := g.Restore(f)
+	if err != nil {
+		return 0, fmt.Errorf("恢复 group %q 的快照失败：%w", g.name, err)
+	}
+	log.Printf("[Group %s] 从快照 %s 恢复了 %d 个条目", g.name, path, n)
+	return n, nil
+}
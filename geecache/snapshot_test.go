@@ -0,0 +1,127 @@
+package geecache
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试快照按访问顺序恢复，跳过过期的条目，并且不超过缓存容量
+func TestSnapshot(t *testing.T) {
+	// 1.压缩的值、带过期时间的值、已经过期的值
+	src := NewGroupOpts("snapshot-src", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), &GroupOptions{TTL: time.Hour, Compression: "gzip", CompressThreshold: 1})
+	src.Set("Tom", []byte(strings.Repeat("630", 100)))
+	src.Set("Jack", []byte("589"))
+	src.mainCache.Add("old", ByteView{b: []byte("x"), e: time.Now().Add(-time.Second)})
+	src.Set("Sam", []byte("567"))
+	src.mainCache.Get("Tom") // Tom 变为最近访问
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scores.snap")
+	if n, err := src.SnapshotFile(path); err != nil || n != 3 {
+		t.Fatalf("期望保存 3 个条目，实际 %d，错误 %v", n, err)
+	}
+
+	// 2.恢复后值、压缩算法、过期时间不变
+	dst := newLocalGroup("snapshot-dst", nil, nil)
+	if n, err := dst.RestoreFile(path); err != nil || n != 3 {
+		t.Fatalf("期望恢复 3 个条目，实际 %d，错误 %v", n, err)
+	}
+	for _, key := range []string{"Jack", "Sam", "Tom"} {
+		want, _ := src.mainCache.Get(key)
+		got, ok := dst.mainCache.Get(key)
+		if !ok || got.enc != want.enc || !got.e.Equal(want.e) || got.version != want.version {
+			t.Fatalf("%s 恢复后的元数据不一致：%+v", key, got)
+		}
+		if v, err := dst.Get(key); err != nil || v.String() != string(mustGet(t, src, key)) {
+			t.Fatalf("%s 恢复后的值不一致，错误 %v", key, err)
+		}
+	}
+	if _, ok := dst.mainCache.Get("old"); ok {
+		t.Fatalf("过期的条目不应该被恢复")
+	}
+
+	// 3.容量不足时只恢复最近访问的条目
+	small := newLocalGroup("snapshot-small", nil, nil)
+	tom, _ := src.mainCache.Get("Tom")
+	small.mainCache.cacheBytes = int64(len("Tom") + tom.Len())
+	if n, err := small.RestoreFile(path); err != nil || n != 1 {
+		t.Fatalf("期望恢复 1 个条目，实际 %d，错误 %v", n, err)
+	}
+	if _, ok := small.mainCache.Get("Tom"); !ok {
+		t.Fatalf("应该恢复最近访问的 Tom")
+	}
+
+	// 4.快照损坏时返回错误，不修改缓存；文件不存在时返回 os.ErrNotExist
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+	bad := newLocalGroup("snapshot-bad", nil, nil)
+	if _, err := bad.Restore(bytes.NewReader(data)); err == nil {
+		t.Fatalf("快照损坏时应该返回错误")
+	}
+	if _, items := bad.mainCache.stats(); items != 0 {
+		t.Fatalf("快照损坏时不应该修改缓存")
+	}
+	if _, err := bad.RestoreFile(filepath.Join(dir, "missing.snap")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("期望 os.ErrNotExist，实际 %v", err)
+	}
+}
+
+// 测试读取快照时不持有缓存的锁，恢复较慢时不阻塞缓存的读写
+func TestRestoreWithoutLock(t *testing.T) {
+	src := newLocalGroup("snapshot-lock-src", nil, nil)
+	src.Set("Tom", []byte("630"))
+	var buf bytes.Buffer
+	if _, err := src.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dst := newLocalGroup("snapshot-lock-dst", nil, nil)
+	dst.Set("Jack", []byte("589"))
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := dst.Restore(pr)
+		done <- err
+	}()
+	pw.Write(buf.Bytes()[:4]) // 只写入一部分，Restore 阻塞在读取上
+	got := make(chan bool, 1)
+	go func() {
+		_, ok := dst.mainCache.Get("Jack")
+		got <- ok
+	}()
+	select {
+	case ok := <-got:
+		if !ok {
+			t.Fatalf("应该命中 Jack")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("读取快照时不应该阻塞缓存的读写")
+	}
+	pw.Write(buf.Bytes()[4:])
+	pw.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("恢复失败：%v", err)
+	}
+	if _, ok := dst.mainCache.Get("Tom"); !ok {
+		t.Fatalf("应该恢复 Tom")
+	}
+}
+
+func mustGet(t *testing.T, g *Group, key string) []byte {
+	t.Helper()
+	v, err := g.Get(key)
+	if err != nil {
+		t.Fatalf("获取 %s 失败：%v", key, err)
+	}
+	return v.ByteSlice()
+}
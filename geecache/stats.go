@@ -0,0 +1,46 @@
+package geecache
+
+import "sync/atomic"
+
+// Stats Group 的统计信息
+type Stats struct {
+	Gets           int64 `json:"gets"`            // Get 的调用次数
+	CacheHits      int64 `json:"cache_hits"`      // 本地缓存命中次数
+	PeerLoads      int64 `json:"peer_loads"`      // 从其他节点成功获取的次数
+	PeerErrors     int64 `json:"peer_errors"`     // 从其他节点获取失败的次数
+	LocalLoads     int64 `json:"local_loads"`     // 调用回调函数成功的次数
+	LocalLoadErrs  int64 `json:"local_load_errs"` // 调用回调函数失败的次数
+	ServerRequests int64 `json:"server_requests"` // 处理其他节点请求的次数
+	WarmLoads      int64 `json:"warm_loads"`      // 节点变化后从之前的所有者预热的次数
+	CacheBytes     int64 `json:"cache_bytes"`     // 本地缓存占用的内存
+	CacheItems     int64 `json:"cache_items"`     // 本地缓存的条目数
+}
+
+// groupStats 使用原子操作记录统计信息
+type groupStats struct {
+	gets           atomic.Int64
+	cacheHits      atomic.Int64
+	peerLoads      atomic.Int64
+	peerErrors     atomic.Int64
+	localLoads     atomic.Int64
+	localLoadErrs  atomic.Int64
+	serverRequests atomic.Int64
+	warmLoads      atomic.Int64
+}
+
+// Stats 返回 Group 当前的统计信息
+func (g *Group) Stats() Stats {
+	bytes, items := g.mainCache.stats()
+	return Stats{
+		Gets:           g.stats.gets.Load(),
+		CacheHits:      g.stats.cacheHits.Load(),
+		PeerLoads:      g.stats.peerLoads.Load(),
+		PeerErrors:     g.stats.peerErrors.Load(),
+		LocalLoads:     g.stats.localLoads.Load(),
+		LocalLoadErrs:  g.stats.localLoadErrs.Load(),
+		ServerRequests: g.stats.serverRequests.Load(),
+		WarmLoads:      g.stats.warmLoads.Load(),
+		CacheBytes:     bytes,
+		CacheItems:     items,
+	}
+}
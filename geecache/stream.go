@@ -0,0 +1,75 @@
+package geecache
+
+import (
+	"context"
+	pb "geecache/geecachepb"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// 流式请求：请求头带有 X-Geecache-Stream: 1 时，响应体不再是 pb.Response，而是原始的值，
+// 分块存储的值逐块写入响应，请求方直接读取响应体，大对象在两端都不需要完整地放进内存。
+// 值的元信息通过响应头返回，出错时与普通请求一样返回带有错误码的 pb.Response。
+const (
+	streamHeader  = "X-Geecache-Stream"
+	versionHeader = "X-Geecache-Version"
+	expireHeader  = "X-Geecache-Expire"
+	staleHeader   = "X-Geecache-Stale"
+)
+
+// serveStream 以流的形式返回值，成功时返回 nil，失败时返回带有错误码的响应
+func (p *HTTPPool) serveStream(w http.ResponseWriter, in *pb.Request) *pb.Response {
+	group, errRes := lookupGroup(p.self, in, p.opts.MaxKeyLength)
+	if errRes != nil {
+		return errRes
+	}
+	view, r, size, err := group.streamForPeer(string(in.GetKey()), in.GetHot())
+	if err != nil {
+		return errorResponse(p.self, errorCode(err), err)
+	}
+	h := w.Header()
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("Content-Length", strconv.FormatInt(size, 10))
+	h.Set(versionHeader, strconv.FormatInt(view.version, 10))
+	if !view.e.IsZero() {
+		h.Set(expireHeader, strconv.FormatInt(view.e.UnixNano(), 10))
+	}
+	if view.stale {
+		h.Set(staleHeader, "1")
+	}
+	if _, err = io.Copy(w, r); err != nil {
+		p.Log("写入响应流：%v", err)
+	}
+	return nil
+}
+
+var _ StreamPeerGetter = (*httpGetter)(nil)
+
+// GetStream 以流的形式获取值，返回的是响应体本身，不受 MaxResponseBytes 限制，也不会重试。
+// 注意 HTTPPoolOptions.Timeout 同样限制读取响应体的时间
+func (h *httpGetter) GetStream(in *pb.Request) (rc io.ReadCloser, err error) {
+	if h.pool != nil {
+		defer func() { h.pool.observe(h, err) }()
+	}
+	req, err := h.newRequest(context.Background(), in, true)
+	if err != nil {
+		return nil, err
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return nil, h.readError(res)
+	}
+	return res.Body, nil
+}
+
+var _ StreamPeerGetter = (*hedgedGetter)(nil)
+
+// GetStream 流式请求不做对冲，只请求主节点
+func (h *hedgedGetter) GetStream(in *pb.Request) (io.ReadCloser, error) {
+	return h.primary.GetStream(in)
+}
@@ -0,0 +1,485 @@
+package geecache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"github.com/golang/protobuf/proto"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TCP 协议的帧格式（大端序）：
+//
+//	| length uint32 | id uint64 | status uint8 | payload |
+//
+// length 为 id、status、payload 的总长度；id 由客户端分配，服务端原样返回，
+// 因此同一个连接上可以连续发送多个请求（pipelining），响应可以乱序返回（multiplexing）。
+// 请求的 payload 为 pb.Request；响应 status 为 frameOK 时 payload 为 pb.Response，
+// 其中的错误码表示 group、key 相关的错误；请求帧无法解码时 status 为 frameError，payload 为错误信息。
+const (
+	frameHeaderLen = 4 + 8 + 1
+
+	frameOK    byte = 0
+	frameError byte = 1
+
+	defaultMaxFrameBytes = 64 << 20
+	defaultConnsPerPeer  = 2
+	defaultMaxInflight   = 64
+)
+
+// ErrConnClosed 连接已关闭，仍在等待的请求返回该错误
+var ErrConnClosed = errors.New("连接已关闭")
+
+type frame struct {
+	id      uint64
+	status  byte
+	payload []byte
+}
+
+// writeFrame 写入一帧
+func writeFrame(w io.Writer, f frame) error {
+	buf := make([]byte, frameHeaderLen+len(f.payload))
+	binary.BigEndian.PutUint32(buf, uint32(8+1+len(f.payload)))
+	binary.BigEndian.PutUint64(buf[4:], f.id)
+	buf[12] = f.status
+	copy(buf[frameHeaderLen:], f.payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readFrame 读取一帧，长度超过 max 时返回错误
+func readFrame(r io.Reader, max uint32) (frame, error) {
+	var header [frameHeaderLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return frame{}, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < 9 || length-9 > max {
+		return frame{}, fmt.Errorf("帧长度非法：%d", length)
+	}
+	f := frame{
+		id:      binary.BigEndian.Uint64(header[4:12]),
+		status:  header[12],
+		payload: make([]byte, length-9),
+	}
+	if _, err := io.ReadFull(r, f.payload); err != nil {
+		return frame{}, err
+	}
+	return f, nil
+}
+
+// parseTCPAddr 解析 tcp://host:port 或 unix:///path/to.sock 形式的地址
+func parseTCPAddr(addr string) (network, address string, err error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", "", err
+	}
+	switch u.Scheme {
+	case "tcp":
+		return "tcp", u.Host, nil
+	case "unix":
+		return "unix", u.Path, nil
+	}
+	return "", "", fmt.Errorf("不支持的地址：%s", addr)
+}
+
+// TCPPoolOptions 用于配置 TCPPool，零值字段使用默认值
+type TCPPoolOptions struct {
+	// Replicas 一致性哈希的虚拟节点倍数，默认为 50
+	Replicas int
+	// HashFn 一致性哈希使用的哈希函数，默认为 crc32.ChecksumIEEE
+	HashFn consistenthash.Hash
+	// DialTimeout 建立连接的超时时间
+	DialTimeout time.Duration
+	// Timeout 单次请求的超时时间
+	Timeout time.Duration
+	// MaxFrameBytes 允许的最大帧长度
+	MaxFrameBytes uint32
+	// ConnsPerPeer 每个远程节点保持的长连接数，请求轮流使用这些连接
+	ConnsPerPeer int
+	// MaxKeyLength group 和 key 的最大字节数
+	MaxKeyLength int
+	// MaxInflight 服务端每个连接上同时处理的请求数，达到上限后暂停读取该连接上的请求，默认为 64
+	MaxInflight int
+	// WriteTimeout 服务端写入一个响应帧的超时时间，超时后关闭连接，默认与 Timeout 相同
+	WriteTimeout time.Duration
+}
+
+// TCPPool 使用自定义二进制协议在长连接上与其他节点通信，可以代替 HTTPPool 注册到 Group。
+// TCP 协议没有认证和加密，任何能访问端口的人都可以读取缓存、触发回源，只应在可信网络中使用；
+// 需要认证时使用配置了 HMAC 或双向 TLS 的 HTTPPool
+type TCPPool struct {
+	self string // 本节点地址，如 tcp://localhost:8001 或 unix:///tmp/geecache.sock
+	opts TCPPoolOptions
+
+	mu         sync.Mutex
+	peers      *consistenthash.Map
+	tcpGetters map[string]*tcpGetter
+	listeners  []net.Listener
+	closed     bool
+}
+
+// NewTCPPool 初始化 TCPPool，o 为 nil 时全部使用默认值
+func NewTCPPool(self string, o *TCPPoolOptions) *TCPPool {
+	p := &TCPPool{self: self}
+	if o != nil {
+		p.opts = *o
+	}
+	if p.opts.Replicas == 0 {
+		p.opts.Replicas = defaultReplicas
+	}
+	if p.opts.DialTimeout == 0 {
+		p.opts.DialTimeout = defaultDialTimeout
+	}
+	if p.opts.Timeout == 0 {
+		p.opts.Timeout = defaultRequestTimeout
+	}
+	if p.opts.MaxFrameBytes == 0 {
+		p.opts.MaxFrameBytes = defaultMaxFrameBytes
+	}
+	if p.opts.ConnsPerPeer == 0 {
+		p.opts.ConnsPerPeer = defaultConnsPerPeer
+	}
+	if p.opts.MaxKeyLength == 0 {
+		p.opts.MaxKeyLength = defaultMaxKeyLength
+	}
+	if p.opts.MaxInflight == 0 {
+		p.opts.MaxInflight = defaultMaxInflight
+	}
+	if p.opts.WriteTimeout == 0 {
+		p.opts.WriteTimeout = p.opts.Timeout
+	}
+	return p
+}
+
+// Log 日志打印方法
+func (p *TCPPool) Log(format string, v ...interface{}) {
+	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+// ListenAndServe 监听本节点地址并处理其他节点的请求
+func (p *TCPPool) ListenAndServe() error {
+	network, address, err := parseTCPAddr(p.self)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	return p.Serve(l)
+}
+
+// Serve 在 l 上接受连接并处理请求，直到 l 被关闭
+func (p *TCPPool) Serve(l net.Listener) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		l.Close()
+		return ErrConnClosed
+	}
+	p.listeners = append(p.listeners, l)
+	p.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			p.mu.Lock()
+			closed := p.closed
+			p.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		go p.serveConn(conn)
+	}
+}
+
+// serveConn 处理一个连接上的所有请求，每个请求使用单独的协程处理，响应按完成顺序写回。
+// 同时处理的请求达到 MaxInflight 时暂停读取，对方不读取响应导致写入超时时关闭连接
+func (p *TCPPool) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	var wmu sync.Mutex // 保证响应帧不会交错写入
+	sem := make(chan struct{}, p.opts.MaxInflight)
+	for {
+		f, err := readFrame(r, p.opts.MaxFrameBytes)
+		if err != nil {
+			if err != io.EOF {
+				p.Log("读取请求：%v", err)
+			}
+			return
+		}
+		sem <- struct{}{}
+		go func(f frame) {
+			defer func() { <-sem }()
+			res := p.handle(f)
+			wmu.Lock()
+			defer wmu.Unlock()
+			conn.SetWriteDeadline(time.Now().Add(p.opts.WriteTimeout))
+			if err := writeFrame(conn, res); err != nil {
+				p.Log("写入响应：%v", err)
+				conn.Close() // 连接已经不可用，读取循环随之退出
+			}
+		}(f)
+	}
+}
+
+// handle 处理一个请求帧，返回对应的响应帧
+func (p *TCPPool) handle(f frame) frame {
+	fail := func(err error) frame {
+		return frame{id: f.id, status: frameError, payload: []byte(err.Error())}
+	}
+	req := &pb.Request{}
+	if err := proto.Unmarshal(f.payload, req); err != nil {
+		return fail(fmt.Errorf("解码请求：%v", err))
+	}
+	body, err := proto.Marshal(serveGet(p.self, req, p.opts.MaxKeyLength))
+	if err != nil {
+		return fail(err)
+	}
+	return frame{id: f.id, status: frameOK, payload: body}
+}
+
+// Set 更新节点列表，地址格式与 self 相同
+func (p *TCPPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	p.peers.Add(peers...)
+	// 保留仍然存在的节点的连接，只为新节点创建 tcpGetter
+	old := p.tcpGetters
+	p.tcpGetters = make(map[string]*tcpGetter, len(peers))
+	for _, peer := range peers {
+		if g, ok := old[peer]; ok {
+			p.tcpGetters[peer] = g
+			delete(old, peer)
+			continue
+		}
+		p.tcpGetters[peer] = &tcpGetter{
+			addr:  peer,
+			opts:  &p.opts,
+			conns: make([]*tcpConn, p.opts.ConnsPerPeer),
+		}
+	}
+	// 被移除的节点等正在进行的请求结束后再关闭连接
+	for _, g := range old {
+		time.AfterFunc(p.opts.Timeout, g.close)
+	}
+}
+
+var _ PeerPicker = (*TCPPool)(nil)
+
+// PickPeer 根据 key 选择对应的节点
+func (p *TCPPool) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+		return p.tcpGetters[peer], true
+	}
+	return nil, false
+}
+
+// Close 关闭监听和所有到远程节点的连接
+func (p *TCPPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, l := range p.listeners {
+		l.Close()
+	}
+	for _, g := range p.tcpGetters {
+		g.close()
+	}
+	return nil
+}
+
+// tcpGetter 访问单个远程节点的客户端，维护 ConnsPerPeer 个长连接
+type tcpGetter struct {
+	addr string
+	opts *TCPPoolOptions
+
+	mu    sync.Mutex
+	conns []*tcpConn
+	next  atomic.Uint32 // 轮流使用连接
+}
+
+var _ PeerGetter = (*tcpGetter)(nil)
+
+func (g *tcpGetter) Get(in *pb.Request, out *pb.Response) error {
+	if err := checkKeyLength(in.GetGroup(), in.GetKey(), g.opts.MaxKeyLength); err != nil {
+		return err
+	}
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	conn, err := g.conn()
+	if err != nil {
+		return err
+	}
+	f, err := conn.roundTrip(body, g.opts.Timeout)
+	if err != nil {
+		return err
+	}
+	if f.status != frameOK {
+		return fmt.Errorf("节点 %s 返回错误：%s", g.addr, f.payload)
+	}
+	if err = proto.Unmarshal(f.payload, out); err != nil {
+		return fmt.Errorf("解码响应：%v", err)
+	}
+	return responseError(out)
+}
+
+// conn 轮流选择一个可用的连接，连接不存在或已断开时重新建立
+func (g *tcpGetter) conn() (*tcpConn, error) {
+	i := int(g.next.Add(1)) % len(g.conns)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c := g.conns[i]; c != nil && !c.isClosed() {
+		return c, nil
+	}
+	network, address, err := parseTCPAddr(g.addr)
+	if err != nil {
+		return nil, err
+	}
+	nc, err := net.DialTimeout(network, address, g.opts.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := newTCPConn(nc, g.opts.MaxFrameBytes)
+	g.conns[i] = c
+	return c, nil
+}
+
+func (g *tcpGetter) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, c := range g.conns {
+		if c != nil {
+			c.close(ErrConnClosed)
+			g.conns[i] = nil
+		}
+	}
+}
+
+// tcpConn 一个支持多路复用的客户端连接
+type tcpConn struct {
+	conn     net.Conn
+	maxBytes uint32
+	wmu      sync.Mutex // 保证请求帧不会交错写入
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan frame // 等待响应的请求
+	err     error                 // 连接关闭的原因，不为 nil 时连接不可用
+}
+
+func newTCPConn(nc net.Conn, maxBytes uint32) *tcpConn {
+	c := &tcpConn{
+		conn:     nc,
+		maxBytes: maxBytes,
+		pending:  make(map[uint64]chan frame),
+	}
+	go c.readLoop()
+	return c
+}
+
+// readLoop 读取响应并根据 id 分发给等待中的请求
+func (c *tcpConn) readLoop() {
+	r := bufio.NewReader(c.conn)
+	for {
+		f, err := readFrame(r, c.maxBytes)
+		if err != nil {
+			c.close(err)
+			return
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[f.id]
+		delete(c.pending, f.id)
+		c.mu.Unlock()
+		if ok {
+			ch <- f
+		}
+	}
+}
+
+// roundTrip 发送一个请求并等待对应的响应
+func (c *tcpConn) roundTrip(payload []byte, timeout time.Duration) (frame, error) {
+	// 1.分配请求 id 并登记
+	ch := make(chan frame, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return frame{}, c.err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	// 2.发送请求，对方不读取时写入超时，避免一直持有 wmu 阻塞同一连接上的其他请求
+	c.wmu.Lock()
+	c.conn.SetWriteDeadline(time.Now().Add(timeout))
+	err := writeFrame(c.conn, frame{id: id, payload: payload})
+	c.wmu.Unlock()
+	if err != nil {
+		c.close(err)
+		return frame{}, err
+	}
+
+	// 3.等待响应，超时后取消登记
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case f, ok := <-ch:
+		if !ok {
+			return frame{}, c.closeErr()
+		}
+		return f, nil
+	case <-t.C:
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return frame{}, fmt.Errorf("请求超时：%v", timeout)
+	}
+}
+
+// close 关闭连接，所有等待中的请求返回 err
+func (c *tcpConn) close(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	c.conn.Close()
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+}
+
+func (c *tcpConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err != nil
+}
+
+func (c *tcpConn) closeErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
@@ -0,0 +1,268 @@
+package geecache
+
+import (
+	"fmt"
+	pb "geecache/geecachepb"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startTCPPeer 在随机端口上启动一个 TCPPool 服务端，返回其地址
+func startTCPPeer(t testing.TB, network string) (*TCPPool, string) {
+	t.Helper()
+	var (
+		l    net.Listener
+		addr string
+		err  error
+	)
+	if network == "unix" {
+		sock := filepath.Join(t.TempDir(), "geecache.sock")
+		l, err = net.Listen("unix", sock)
+		addr = "unix://" + sock
+	} else {
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+		if err == nil {
+			addr = "tcp://" + l.Addr().String()
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewTCPPool(addr, nil)
+	go p.Serve(l)
+	t.Cleanup(func() { p.Close() })
+	return p, addr
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	r, w := net.Pipe()
+	defer r.Close()
+	go func() {
+		writeFrame(w, frame{id: 42, status: frameError, payload: []byte("boom")})
+		w.Close()
+	}()
+	f, err := readFrame(r, 1<<10)
+	if err != nil || f.id != 42 || f.status != frameError || string(f.payload) != "boom" {
+		t.Fatalf("帧往返后不一致：%+v %v", f, err)
+	}
+}
+
+func TestTCPPoolGet(t *testing.T) {
+	NewGroup("tcp-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, fmt.Errorf("%s not exist", key)
+		}
+		return []byte("value:" + key), nil
+	}))
+	for _, network := range []string{"tcp", "unix"} {
+		t.Run(network, func(t *testing.T) {
+			_, addr := startTCPPeer(t, network)
+			local := NewTCPPool("local", nil)
+			defer local.Close()
+			local.Set(addr)
+
+			peer, ok := local.PickPeer("Tom")
+			if !ok {
+				t.Fatalf("应该选择远程节点")
+			}
+			res := &pb.Response{}
+			if err := peer.Get(&pb.Request{Group: []byte("tcp-scores"), Key: []byte("Tom")}, res); err != nil {
+				t.Fatalf("获取失败：%v", err)
+			}
+			if string(res.GetValue()) != "value:Tom" {
+				t.Fatalf("值错误：%q", res.GetValue())
+			}
+			// 服务端的错误通过错误帧返回，不影响连接上的其他请求
+			if err := peer.Get(&pb.Request{Group: []byte("tcp-scores"), Key: []byte("missing")}, &pb.Response{}); err == nil {
+				t.Fatalf("不存在的 key 应该返回错误")
+			}
+			if err := peer.Get(&pb.Request{Group: []byte("tcp-unknown"), Key: []byte("Tom")}, &pb.Response{}); err == nil {
+				t.Fatalf("不存在的 group 应该返回错误")
+			}
+		})
+	}
+}
+
+// 测试同一个连接上并发发送的请求可以乱序返回，慢请求不会阻塞快请求
+func TestTCPPoolMultiplexing(t *testing.T) {
+	NewGroup("tcp-mux", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if key == "slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		return []byte(key), nil
+	}))
+	_, addr := startTCPPeer(t, "tcp")
+	local := NewTCPPool("local", &TCPPoolOptions{ConnsPerPeer: 1})
+	defer local.Close()
+	local.Set(addr)
+	peer, _ := local.PickPeer("k")
+
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		peer.Get(&pb.Request{Group: []byte("tcp-mux"), Key: []byte("slow")}, &pb.Response{})
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key%d", i)
+			res := &pb.Response{}
+			if err := peer.Get(&pb.Request{Group: []byte("tcp-mux"), Key: []byte(key)}, res); err != nil {
+				t.Errorf("获取 %s 失败：%v", key, err)
+				return
+			}
+			if string(res.GetValue()) != key {
+				t.Errorf("响应错乱：%s -> %q", key, res.GetValue())
+			}
+		}(i)
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Fatalf("快请求被慢请求阻塞，耗时 %v", elapsed)
+	}
+	<-slowDone
+	if n := len(peer.(*tcpGetter).conns); n != 1 {
+		t.Fatalf("应该只使用一个连接，实际 %d", n)
+	}
+}
+
+// 测试每个连接同时处理的请求数不超过 MaxInflight，达到上限后后续请求等待
+func TestTCPPoolMaxInflight(t *testing.T) {
+	NewGroup("tcp-inflight", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if key == "slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		return []byte(key), nil
+	}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := "tcp://" + l.Addr().String()
+	server := NewTCPPool(addr, &TCPPoolOptions{MaxInflight: 1})
+	go server.Serve(l)
+	defer server.Close()
+
+	local := NewTCPPool("local", &TCPPoolOptions{ConnsPerPeer: 1})
+	defer local.Close()
+	local.Set(addr)
+	peer, _ := local.PickPeer("k")
+	go peer.Get(&pb.Request{Group: []byte("tcp-inflight"), Key: []byte("slow")}, &pb.Response{})
+	time.Sleep(20 * time.Millisecond)
+	start := time.Now()
+	if err := peer.Get(&pb.Request{Group: []byte("tcp-inflight"), Key: []byte("fast")}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("达到 MaxInflight 后请求应该等待，实际耗时 %v", elapsed)
+	}
+}
+
+// 测试对方不读取请求时写入超时，不会一直阻塞同一连接上的其他请求
+func TestTCPConnWriteTimeout(t *testing.T) {
+	client, server := net.Pipe() // net.Pipe 没有缓冲，对方不读取时写入一直阻塞
+	defer server.Close()
+	c := newTCPConn(client, 1<<10)
+	start := time.Now()
+	if _, err := c.roundTrip([]byte("stalled"), 50*time.Millisecond); err == nil {
+		t.Fatalf("对方不读取时应该写入超时")
+	}
+	if _, err := c.roundTrip([]byte("next"), 50*time.Millisecond); err == nil {
+		t.Fatalf("连接关闭后的请求应该失败")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("写入超时后应该立即返回，实际耗时 %v", elapsed)
+	}
+}
+
+// 测试连接断开后自动重新建立连接
+func TestTCPPoolReconnect(t *testing.T) {
+	NewGroup("tcp-reconnect", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	_, addr := startTCPPeer(t, "tcp")
+	local := NewTCPPool("local", &TCPPoolOptions{ConnsPerPeer: 1})
+	defer local.Close()
+	local.Set(addr)
+	peer, _ := local.PickPeer("k")
+	req := &pb.Request{Group: []byte("tcp-reconnect"), Key: []byte("k")}
+	if err := peer.Get(req, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	// 关闭客户端连接，模拟连接断开
+	peer.(*tcpGetter).conns[0].close(ErrConnClosed)
+	if err := peer.Get(req, &pb.Response{}); err != nil {
+		t.Fatalf("连接断开后应该重新连接：%v", err)
+	}
+}
+
+// 测试重新 Set 时不断开仍然存在的节点的连接
+func TestTCPPoolSetKeepsConns(t *testing.T) {
+	NewGroup("tcp-set", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	_, addr := startTCPPeer(t, "tcp")
+	local := NewTCPPool("local", &TCPPoolOptions{ConnsPerPeer: 1})
+	defer local.Close()
+	local.Set(addr)
+	peer, _ := local.PickPeer("k")
+	req := &pb.Request{Group: []byte("tcp-set"), Key: []byte("k")}
+	if err := peer.Get(req, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	conn := peer.(*tcpGetter).conns[0]
+	local.Set(addr, "tcp://127.0.0.1:1")
+	if local.tcpGetters[addr] != peer || conn.isClosed() {
+		t.Fatalf("仍然存在的节点应该保留原来的连接")
+	}
+}
+
+func benchmarkPeerGet(b *testing.B, peer PeerGetter, group string) {
+	req := &pb.Request{Group: []byte(group), Key: []byte("Tom")}
+	if err := peer.Get(req, &pb.Response{}); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(p *testing.PB) {
+		for p.Next() {
+			if err := peer.Get(req, &pb.Response{}); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkHTTPPoolGet(b *testing.B) {
+	NewGroup("bench-http", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return make([]byte, 128), nil
+	}))
+	remote := httptest.NewServer(NewHTTPPool("remote"))
+	defer remote.Close()
+	local := NewHTTPPool("local")
+	defer local.Close()
+	local.Set(remote.URL)
+	peer, _ := local.PickPeer("Tom")
+	benchmarkPeerGet(b, peer, "bench-http")
+}
+
+func BenchmarkTCPPoolGet(b *testing.B) {
+	NewGroup("bench-tcp", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return make([]byte, 128), nil
+	}))
+	_, addr := startTCPPeer(b, "tcp")
+	local := NewTCPPool("local", nil)
+	defer local.Close()
+	local.Set(addr)
+	peer, _ := local.PickPeer("Tom")
+	benchmarkPeerGet(b, peer, "bench-tcp")
+}
@@ -0,0 +1,203 @@
+package geecache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultTLSReloadInterval = 10 * time.Second
+
+// TLSOptions 节点间通信的 TLS 配置
+type TLSOptions struct {
+	// CertFile、KeyFile 本节点的证书和私钥，作为服务端证书，开启双向认证时也作为客户端证书
+	CertFile string
+	KeyFile  string
+	// CAFile 用于校验对端证书的 CA 证书（PEM 格式，可以包含多个）
+	CAFile string
+	// ClientAuth 开启双向认证（mTLS），服务端要求客户端提供由 CAFile 签发的证书
+	ClientAuth bool
+	// AllowedPeers 允许访问的客户端身份（证书中的 DNS 名称或 CN），为空表示不限制
+	AllowedPeers []string
+	// ReloadInterval 检查证书文件是否变化的间隔，文件变化后自动重新加载，不需要重启
+	ReloadInterval time.Duration
+}
+
+// certReloader 负责加载证书，并在文件变化时重新加载
+type certReloader struct {
+	opts TLSOptions
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	roots     *x509.CertPool
+	modTime   time.Time // 证书文件的最后修改时间
+	checkedAt time.Time // 上一次检查文件的时间
+}
+
+func newCertReloader(o TLSOptions) *certReloader {
+	if o.ReloadInterval == 0 {
+		o.ReloadInterval = defaultTLSReloadInterval
+	}
+	return &certReloader{opts: o}
+}
+
+// load 从文件加载证书和 CA
+func (r *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return fmt.Errorf("加载证书：%v", err)
+	}
+	pem, err := os.ReadFile(r.opts.CAFile)
+	if err != nil {
+		return fmt.Errorf("读取 CA 证书：%v", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("CA 文件 %s 中没有有效的证书", r.opts.CAFile)
+	}
+	r.mu.Lock()
+	r.cert, r.roots = &cert, roots
+	r.modTime = r.latestModTime()
+	r.checkedAt = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// latestModTime 返回证书相关文件中最新的修改时间
+func (r *certReloader) latestModTime() time.Time {
+	var latest time.Time
+	for _, name := range []string{r.opts.CertFile, r.opts.KeyFile, r.opts.CAFile} {
+		if fi, err := os.Stat(name); err == nil && fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest
+}
+
+// current 返回当前的证书和 CA，距离上次检查超过 ReloadInterval 且文件有变化时重新加载
+func (r *certReloader) current() (*tls.Certificate, *x509.CertPool, error) {
+	r.mu.RLock()
+	cert, roots := r.cert, r.roots
+	checkedAt, modTime := r.checkedAt, r.modTime
+	r.mu.RUnlock()
+	if cert != nil && time.Since(checkedAt) < r.opts.ReloadInterval {
+		return cert, roots, nil
+	}
+	if cert == nil || r.latestModTime().After(modTime) {
+		if err := r.load(); err != nil {
+			if cert == nil {
+				return nil, nil, err
+			}
+			// 新证书有问题时继续使用旧证书
+			log.Printf("重新加载证书失败，继续使用旧证书：%v", err)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkedAt = time.Now()
+	return r.cert, r.roots, nil
+}
+
+// serverConfig 返回服务端使用的 tls.Config，每次握手时获取最新的证书
+func (r *certReloader) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, roots, err := r.current()
+			if err != nil {
+				return nil, err
+			}
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+			}
+			if r.opts.ClientAuth {
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				cfg.ClientCAs = roots
+				cfg.VerifyConnection = r.verifyClient
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// verifyClient 校验客户端证书中的身份是否在 AllowedPeers 中
+func (r *certReloader) verifyClient(cs tls.ConnectionState) error {
+	if len(r.opts.AllowedPeers) == 0 {
+		return nil
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("客户端没有提供证书")
+	}
+	leaf := cs.PeerCertificates[0]
+	for _, allowed := range r.opts.AllowedPeers {
+		if leaf.Subject.CommonName == allowed {
+			return nil
+		}
+		for _, name := range leaf.DNSNames {
+			if name == allowed {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("客户端 %q 不在允许的节点列表中", leaf.Subject.CommonName)
+}
+
+// clientConfig 返回访问其他节点使用的 tls.Config
+// 为了支持 CA 热更新，关闭了默认的证书校验，改为在 VerifyConnection 中使用最新的 CA 校验
+func (r *certReloader) clientConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true,
+		VerifyConnection:   r.verifyServer,
+	}
+	if r.opts.ClientAuth {
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _, err := r.current()
+			return cert, err
+		}
+	}
+	return cfg
+}
+
+// verifyServer 使用最新的 CA 校验服务端证书链以及主机名
+func (r *certReloader) verifyServer(cs tls.ConnectionState) error {
+	_, roots, err := r.current()
+	if err != nil {
+		return err
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("服务端没有提供证书")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err = cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// ServerTLSConfig 返回本节点对外提供 HTTPS 服务时使用的 tls.Config，未配置 TLS 时返回 nil
+func (p *HTTPPool) ServerTLSConfig() *tls.Config {
+	if p.certs == nil {
+		return nil
+	}
+	return p.certs.serverConfig()
+}
+
+// ReloadTLS 立即重新加载证书，不需要等待 ReloadInterval
+func (p *HTTPPool) ReloadTLS() error {
+	if p.certs == nil {
+		return errors.New("未配置 TLS")
+	}
+	return p.certs.load()
+}
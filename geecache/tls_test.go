@@ -0,0 +1,173 @@
+package geecache
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	pb "geecache/geecachepb"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA 测试用的 CA，用于签发节点证书
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue 签发一个同时可以用作服务端和客户端的节点证书，返回 PEM 格式的证书和私钥
+func (ca *testCA) issue(t *testing.T, name string) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeNodeCerts 将节点证书、私钥和 CA 写入 dir，返回对应的 TLSOptions
+func writeNodeCerts(t *testing.T, dir string, ca *testCA, name string) *TLSOptions {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, name)
+	o := &TLSOptions{
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+		CAFile:   filepath.Join(dir, name+"-ca.crt"),
+	}
+	for file, data := range map[string][]byte{o.CertFile: certPEM, o.KeyFile: keyPEM, o.CAFile: ca.pem} {
+		if err := os.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return o
+}
+
+// startTLSPeer 使用 pool 的 TLS 配置启动一个 HTTPS 节点
+func startTLSPeer(pool *HTTPPool) *httptest.Server {
+	srv := httptest.NewUnstartedServer(pool)
+	srv.TLS = pool.ServerTLSConfig()
+	srv.StartTLS()
+	return srv
+}
+
+func getOverTLS(client *HTTPPool, url string) error {
+	client.Set(url)
+	peer, _ := client.PickPeer("Tom")
+	return peer.Get(&pb.Request{Group: []byte("tls-scores"), Key: []byte("Tom")}, &pb.Response{})
+}
+
+func TestHTTPPoolMutualTLS(t *testing.T) {
+	NewGroup("tls-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	dir := t.TempDir()
+	ca := newTestCA(t, "geecache-ca")
+
+	serverOpts := writeNodeCerts(t, dir, ca, "server")
+	serverOpts.ClientAuth = true
+	serverOpts.AllowedPeers = []string{"client"}
+	server := startTLSPeer(NewHTTPPoolOpts("server", &HTTPPoolOptions{TLS: serverOpts}))
+	defer server.Close()
+
+	// 1.持有合法证书的客户端可以访问
+	clientOpts := writeNodeCerts(t, dir, ca, "client")
+	clientOpts.ClientAuth = true
+	if err := getOverTLS(NewHTTPPoolOpts("client", &HTTPPoolOptions{TLS: clientOpts}), server.URL); err != nil {
+		t.Fatalf("mTLS 请求失败：%v", err)
+	}
+
+	// 2.没有客户端证书时握手失败
+	noCert := *clientOpts
+	noCert.ClientAuth = false
+	if err := getOverTLS(NewHTTPPoolOpts("client", &HTTPPoolOptions{TLS: &noCert}), server.URL); err == nil {
+		t.Fatalf("没有客户端证书时应该失败")
+	}
+
+	// 3.证书合法但身份不在允许列表中
+	otherOpts := writeNodeCerts(t, dir, ca, "intruder")
+	otherOpts.ClientAuth = true
+	if err := getOverTLS(NewHTTPPoolOpts("intruder", &HTTPPoolOptions{TLS: otherOpts}), server.URL); err == nil {
+		t.Fatalf("不在允许列表中的节点应该被拒绝")
+	}
+
+	// 4.客户端不信任服务端的 CA
+	untrusted := writeNodeCerts(t, dir, newTestCA(t, "other-ca"), "client2")
+	if err := getOverTLS(NewHTTPPoolOpts("client2", &HTTPPoolOptions{TLS: untrusted}), server.URL); err == nil {
+		t.Fatalf("不受信任的服务端证书应该被拒绝")
+	}
+}
+
+// 测试证书轮换后不需要重启即可生效
+func TestHTTPPoolTLSReload(t *testing.T) {
+	NewGroup("tls-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	dir := t.TempDir()
+	oldCA, newCA := newTestCA(t, "old-ca"), newTestCA(t, "new-ca")
+
+	serverPool := NewHTTPPoolOpts("server", &HTTPPoolOptions{TLS: writeNodeCerts(t, dir, oldCA, "server")})
+	server := startTLSPeer(serverPool)
+	defer server.Close()
+	clientOpts := writeNodeCerts(t, dir, newCA, "client")
+	clientPool := NewHTTPPoolOpts("client", &HTTPPoolOptions{TLS: clientOpts})
+	if err := getOverTLS(clientPool, server.URL); err == nil {
+		t.Fatalf("客户端只信任新 CA，应该拒绝旧证书")
+	}
+
+	// 服务端换成新 CA 签发的证书
+	writeNodeCerts(t, dir, newCA, "server")
+	if err := serverPool.ReloadTLS(); err != nil {
+		t.Fatalf("重新加载证书失败：%v", err)
+	}
+	if err := getOverTLS(clientPool, server.URL); err != nil {
+		t.Fatalf("证书轮换后请求应该成功：%v", err)
+	}
+}
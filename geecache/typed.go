@@ -0,0 +1,197 @@
+package geecache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"geecache/lru"
+	"reflect"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Codec 负责 T 与缓存中的 []byte 之间的转换
+type Codec[T any] interface {
+	Marshal(v T) ([]byte, error)
+	Unmarshal(b []byte) (T, error)
+}
+
+// JSONCodec 使用 encoding/json 编解码
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Marshal(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec[T]) Unmarshal(b []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(b, &v)
+	return v, err
+}
+
+// GobCodec 使用 encoding/gob 编解码，每个值单独编码，包含类型信息
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) Marshal(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[T]) Unmarshal(b []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&v)
+	return v, err
+}
+
+// ProtoCodec 使用 protobuf 编解码，T 必须是指向生成的消息结构体的指针，如 *pb.Item
+type ProtoCodec[T proto.Message] struct{}
+
+func (ProtoCodec[T]) Marshal(v T) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+func (ProtoCodec[T]) Unmarshal(b []byte) (T, error) {
+	var zero T
+	v := reflect.New(reflect.TypeOf(zero).Elem()).Interface().(T)
+	if err := proto.Unmarshal(b, v); err != nil {
+		return zero, err
+	}
+	return v, nil
+}
+
+// TypedGetter 缓存未命中时返回 T 类型的回调
+type TypedGetter[T any] interface {
+	Get(key string) (T, error)
+}
+
+// TypedGetterFunc 函数类型实现 TypedGetter 接口
+type TypedGetterFunc[T any] func(key string) (T, error)
+
+func (f TypedGetterFunc[T]) Get(key string) (T, error) {
+	return f(key)
+}
+
+// TypedGroupOptions 用于配置 TypedGroup
+type TypedGroupOptions struct {
+	// GroupOptions 底层 Group 的配置
+	GroupOptions *GroupOptions
+	// DecodedCacheBytes 保存解码后的值的最大内存（按编码后的长度估算），为 0 表示不保存。
+	// 保存的值被所有调用方共享，调用方不能修改
+	DecodedCacheBytes int64
+}
+
+// TypedGroup 在 Group 之上封装类型 T 的编解码，缓存、节点间传输的仍然是编码后的 []byte
+type TypedGroup[T any] struct {
+	group *Group
+	codec Codec[T]
+
+	mu      sync.Mutex
+	decoded *lru.Cache // 解码后的值，为 nil 表示不保存
+}
+
+// decodedEntry 解码后的值，version 与缓存中的值相同时才使用
+type decodedEntry[T any] struct {
+	version int64
+	value   T
+	size    int
+}
+
+func (e *decodedEntry[T]) Len() int {
+	return e.size
+}
+
+// NewTypedGroup 实例化 TypedGroup，同时以 name 注册底层的 Group
+func NewTypedGroup[T any](name string, cacheBytes int64, getter TypedGetter[T], codec Codec[T]) *TypedGroup[T] {
+	return NewTypedGroupOpts(name, cacheBytes, getter, codec, nil)
+}
+
+// NewTypedGroupOpts 使用自定义配置实例化 TypedGroup，o 为 nil 时与 NewTypedGroup 相同
+func NewTypedGroupOpts[T any](name string, cacheBytes int64, getter TypedGetter[T], codec Codec[T], o *TypedGroupOptions) *TypedGroup[T] {
+	if getter == nil {
+		panic("nil TypedGetter")
+	}
+	if codec == nil {
+		panic("nil Codec")
+	}
+	if o == nil {
+		o = &TypedGroupOptions{}
+	}
+	tg := &TypedGroup[T]{codec: codec}
+	// 回调函数返回的值编码后写入缓存
+	tg.group = NewGroupOpts(name, cacheBytes, GetterFunc(func(key string) ([]byte, error) {
+		v, err := getter.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		return codec.Marshal(v)
+	}), o.GroupOptions)
+	if o.DecodedCacheBytes > 0 {
+		tg.decoded = lru.New(o.DecodedCacheBytes, nil)
+	}
+	return tg
+}
+
+// Group 返回底层的 Group，用于注册节点、获取统计信息等
+func (tg *TypedGroup[T]) Group() *Group {
+	return tg.group
+}
+
+// Get 获取 key 对应的值并解码
+func (tg *TypedGroup[T]) Get(key string) (T, error) {
+	var zero T
+	v, err := tg.group.Get(key)
+	if err != nil {
+		return zero, err
+	}
+	// 1.缓存中的值没有变化时直接返回解码后的值，版本号未知时不保存
+	if tg.decoded != nil && v.version != 0 {
+		tg.mu.Lock()
+		e, ok := tg.decoded.Get(key)
+		tg.mu.Unlock()
+		if ok && e.(*decodedEntry[T]).version == v.version {
+			return e.(*decodedEntry[T]).value, nil
+		}
+	}
+	// 2.解码，Unmarshal 的实现不应该保留传入的字节
+	value, err := tg.codec.Unmarshal(v.rawBytes())
+	if err != nil {
+		return zero, err
+	}
+	if tg.decoded != nil && v.version != 0 {
+		tg.mu.Lock()
+		tg.decoded.Add(key, &decodedEntry[T]{version: v.version, value: value, size: v.Len()})
+		tg.mu.Unlock()
+	}
+	return value, nil
+}
+
+// Set 将 value 编码后写入本地缓存，不会通知其他节点
+func (tg *TypedGroup[T]) Set(key string, value T) error {
+	b, err := tg.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	tg.forget(key)
+	tg.group.Set(key, b)
+	return nil
+}
+
+// Remove 从本地缓存中删除 key，不会通知其他节点
+func (tg *TypedGroup[T]) Remove(key string) {
+	tg.forget(key)
+	tg.group.Remove(key)
+}
+
+// forget 删除解码后的值
+func (tg *TypedGroup[T]) forget(key string) {
+	if tg.decoded == nil {
+		return
+	}
+	tg.mu.Lock()
+	tg.decoded.Remove(key)
+	tg.mu.Unlock()
+}
@@ -0,0 +1,81 @@
+package geecache
+
+import (
+	pb "geecache/geecachepb"
+	"sync/atomic"
+	"testing"
+)
+
+type student struct {
+	Name  string
+	Score int
+}
+
+func TestTypedGroupCodecs(t *testing.T) {
+	getter := TypedGetterFunc[student](func(key string) (student, error) {
+		return student{Name: key, Score: 630}, nil
+	})
+	codecs := map[string]Codec[student]{
+		"json": JSONCodec[student]{},
+		"gob":  GobCodec[student]{},
+	}
+	for name, codec := range codecs {
+		tg := NewTypedGroup("typed-"+name, 2<<10, getter, codec)
+		for i := 0; i < 2; i++ { // 第二次命中缓存
+			if v, err := tg.Get("Tom"); err != nil || v != (student{"Tom", 630}) {
+				t.Fatalf("%s：第 %d 次获取的值错误：%+v %v", name, i+1, v, err)
+			}
+		}
+		if err := tg.Set("Jack", student{"Jack", 589}); err != nil {
+			t.Fatal(err)
+		}
+		if v, err := tg.Get("Jack"); err != nil || v.Score != 589 {
+			t.Fatalf("%s：Set 之后的值错误：%+v %v", name, v, err)
+		}
+	}
+
+	tg := NewTypedGroup("typed-proto", 2<<10, TypedGetterFunc[*pb.Item](func(key string) (*pb.Item, error) {
+		return &pb.Item{Key: []byte(key), Value: []byte("630")}, nil
+	}), ProtoCodec[*pb.Item]{})
+	if v, err := tg.Get("Tom"); err != nil || string(v.GetKey()) != "Tom" || string(v.GetValue()) != "630" {
+		t.Fatalf("proto：值错误：%v %v", v, err)
+	}
+}
+
+// countingCodec 记录解码次数
+type countingCodec struct {
+	JSONCodec[student]
+	decodes int32
+}
+
+func (c *countingCodec) Unmarshal(b []byte) (student, error) {
+	atomic.AddInt32(&c.decodes, 1)
+	return c.JSONCodec.Unmarshal(b)
+}
+
+// 测试解码后的值只在缓存中的值没有变化时复用
+func TestTypedGroupDecodedCache(t *testing.T) {
+	codec := &countingCodec{}
+	tg := NewTypedGroupOpts("typed-decoded", 2<<10, TypedGetterFunc[student](func(key string) (student, error) {
+		return student{Name: key}, nil
+	}), codec, &TypedGroupOptions{DecodedCacheBytes: 1 << 10})
+
+	for i := 0; i < 3; i++ {
+		if v, err := tg.Get("Tom"); err != nil || v.Name != "Tom" {
+			t.Fatalf("值错误：%+v %v", v, err)
+		}
+	}
+	if codec.decodes != 1 {
+		t.Fatalf("应该只解码一次，实际 %d 次", codec.decodes)
+	}
+	// 1.直接修改底层 Group 后版本号变化，重新解码
+	tg.Group().Set("Tom", []byte(`{"Name":"Tom","Score":1}`))
+	if v, _ := tg.Get("Tom"); v.Score != 1 || codec.decodes != 2 {
+		t.Fatalf("缓存中的值变化后应该重新解码：%+v，解码 %d 次", v, codec.decodes)
+	}
+	// 2.删除后重新回源
+	tg.Remove("Tom")
+	if v, _ := tg.Get("Tom"); v.Score != 0 || codec.decodes != 3 {
+		t.Fatalf("删除后应该重新回源并解码：%+v，解码 %d 次", v, codec.decodes)
+	}
+}
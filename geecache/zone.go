@@ -0,0 +1,92 @@
+package geecache
+
+import "math/rand"
+
+// 按可用区选择节点：节点通过 SetZones 标记所在的可用区（或机架），
+// 1.副本沿哈希环选择，尽量分布在不同的可用区，一个可用区故障时其他可用区仍然有副本；
+// 2.配置了 ZoneReplicas 时，读取优先选择同一可用区的副本，副本未命中时从所有者获取并保存，
+//   同一可用区内没有副本（或副本不健康、已经不在哈希环中）时才跨可用区读取所有者。
+// 副本与热点 key 一样保存在 hotCache 中，只在 HotKeyOptions.TTL（默认 1s）内有效；
+// 所有者不可用时副本回源，结果也只保存在 hotCache 中。
+
+// ZoneReplicaPicker 读取时优先选择同一可用区的副本时实现该接口，HTTPPool 实现了该接口
+type ZoneReplicaPicker interface {
+	// ZoneReplicated 是否在各可用区为 key 保存副本
+	ZoneReplicated() bool
+}
+
+var _ ZoneReplicaPicker = (*HTTPPool)(nil)
+
+// SetZones 设置节点所在的可用区，未设置的节点属于空的可用区；
+// 自己的可用区未设置时使用 HTTPPoolOptions.Zone
+func (p *HTTPPool) SetZones(zones map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.zones = make(map[string]string, len(zones))
+	for peer, zone := range zones {
+		p.zones[peer] = zone
+	}
+}
+
+// ZoneReplicated 自己标记了可用区并且配置了 ZoneReplicas 时返回 true
+func (p *HTTPPool) ZoneReplicated() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.zoneReplicated()
+}
+
+// zoneReplicated 需要持有 p.mu
+func (p *HTTPPool) zoneReplicated() bool {
+	return p.opts.ZoneReplicas > 0 && p.zoneOf(p.self) != ""
+}
+
+// zoneOf 返回节点所在的可用区，需要持有 p.mu
+func (p *HTTPPool) zoneOf(peer string) string {
+	if zone, ok := p.zones[peer]; ok {
+		return zone
+	}
+	if peer == p.self {
+		return p.opts.Zone
+	}
+	return ""
+}
+
+// replicaSet 返回 key 的所有者和之后的副本，最多 n 个，标记了可用区时副本分布在不同的可用区，需要持有 p.mu
+func (p *HTTPPool) replicaSet(key string, n int) []string {
+	if p.opts.Zone == "" && len(p.zones) == 0 {
+		return p.peers.GetN(key, n)
+	}
+	return p.peers.GetNSpread(key, n, p.zoneOf)
+}
+
+// localReplicas 返回与自己在同一可用区的节点，需要持有 p.mu
+func (p *HTTPPool) localReplicas(peers []string) []string {
+	zone := p.zoneOf(p.self)
+	if zone == "" {
+		return nil
+	}
+	var local []string
+	for _, peer := range peers {
+		if p.zoneOf(peer) == zone {
+			local = append(local, peer)
+		}
+	}
+	return local
+}
+
+// pickZoneReplica 优先选择同一可用区的副本，没有时返回所有者，需要持有 p.mu
+func (p *HTTPPool) pickZoneReplica(key, owner string) string {
+	if p.zoneOf(owner) == p.zoneOf(p.self) {
+		return owner
+	}
+	if local := p.localReplicas(p.replicaSet(key, p.opts.ZoneReplicas+1)); len(local) > 0 {
+		return local[rand.Intn(len(local))]
+	}
+	return owner
+}
+
+// zoneReplicated 判断是否从同一可用区的副本读取
+func (g *Group) zoneReplicated() bool {
+	zp, ok := g.peers.(ZoneReplicaPicker)
+	return ok && zp.ZoneReplicated()
+}
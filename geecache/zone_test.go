@@ -0,0 +1,87 @@
+package geecache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 测试副本分布在不同的可用区，读取优先选择同一可用区的副本
+func TestZonePickPeer(t *testing.T) {
+	zones := map[string]string{
+		"http://a1": "a", "http://a2": "a",
+		"http://b1": "b", "http://b2": "b",
+		"http://c1": "c",
+	}
+	peers := []string{"http://a1", "http://a2", "http://b1", "http://b2", "http://c1"}
+	p := NewHTTPPoolOpts("http://b2", &HTTPPoolOptions{Zone: "b", ZoneReplicas: 2})
+	p.Set(peers...)
+	p.SetZones(zones)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		// 1.三个副本分别在三个可用区
+		p.mu.Lock()
+		replicas := p.replicaSet(key, 3)
+		p.mu.Unlock()
+		seen := make(map[string]bool)
+		for _, peer := range replicas {
+			seen[zones[peer]] = true
+		}
+		if len(seen) != 3 {
+			t.Fatalf("%s 的副本 %v 应该分布在三个可用区", key, replicas)
+		}
+		// 2.总是读取 b 可用区的副本，副本是自己时返回 false
+		if g, ok := p.PickPeer(key); ok && zones[g.(*httpGetter).peer] != "b" {
+			t.Fatalf("%s 应该读取同一可用区的副本，实际 %s", key, g.(*httpGetter).peer)
+		}
+	}
+
+	// 3.同一可用区没有节点时读取所有者
+	client := NewHTTPPoolOpts("http://d1", &HTTPPoolOptions{Zone: "d", ZoneReplicas: 2})
+	client.Set(peers...)
+	client.SetZones(zones)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		g, ok := client.PickPeer(key)
+		if !ok || g.(*httpGetter).peer != client.peers.Get(key) {
+			t.Fatalf("%s 应该跨可用区读取所有者", key)
+		}
+	}
+}
+
+// 测试自己作为同一可用区的副本时从所有者获取并保存，不回源
+func TestZoneReplicaRead(t *testing.T) {
+	var poolA *HTTPPool
+	srvA := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		poolA.ServeHTTP(w, r)
+	}))
+	defer srvA.Close()
+	poolA = NewHTTPPool(srvA.URL)
+	groupA := NewGroup("zone-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value-" + key), nil
+	}))
+
+	self := "http://c.invalid"
+	poolC := NewHTTPPoolOpts(self, &HTTPPoolOptions{Zone: "b", ZoneReplicas: 1})
+	poolC.Set(srvA.URL, self)
+	poolC.SetZones(map[string]string{srvA.URL: "a"})
+	groupC := newLocalGroup("zone-scores", GetterFunc(func(key string) ([]byte, error) {
+		t.Fatalf("副本不应该回源 %s", key)
+		return nil, nil
+	}), poolC)
+	key := ""
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("key-%d", i); poolC.peers.Get(k) == srvA.URL {
+			key = k
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if v, err := groupC.Get(key); err != nil || v.String() != "value-"+key {
+			t.Fatalf("期望 value-%s，实际 %q，错误 %v", key, v.String(), err)
+		}
+	}
+	if got := groupA.Stats().ServerRequests; got != 1 {
+		t.Fatalf("副本只应该向所有者请求一次，实际 %d 次", got)
+	}
+}
@@ -1,11 +1,23 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"geecache"
+	"geecache/config"
+	"geecache/discovery"
+	"geecache/gossip"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
 // 使用 map 模拟数据源 db
@@ -15,28 +27,244 @@ var db = map[string]string{
 	"Sam":  "567",
 }
 
+// dbGetter 从 db 中获取数据的回调函数
+var dbGetter = geecache.GetterFunc(func(key string) ([]byte, error) {
+	log.Println("[SlowDB] search key", key)
+	if v, ok := db[key]; ok {
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("%w：%s", geecache.ErrNotFound, key)
+})
+
 // 封装 createGroup 函数用于创建 Group
 func createGroup() *geecache.Group {
-	return geecache.NewGroup("scores", 2<<10, geecache.GetterFunc(
-		func(key string) ([]byte, error) {
-			log.Println("[SlowDB] search key", key)
-			if v, ok := db[key]; ok {
-				return []byte(v), nil
+	return geecache.NewGroup("scores", 2<<10, dbGetter)
+}
+
+// startConfigServer 从配置文件读取节点、Group 和节点间通信的配置，
+// 配置文件变化或收到 SIGHUP 时重新加载。配置文件中没有 TLS、HMAC，使用命令行参数 flagOpts
+func startConfigServer(path string, api bool, apiAddr string, flagOpts *geecache.HTTPPoolOptions) {
+	// 1.先读取一次配置，用于创建 HTTPPool
+	c, err := config.Load(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts := c.Pool.Options()
+	opts.TLS, opts.HMAC = flagOpts.TLS, flagOpts.HMAC
+	if opts.RebalanceWindow == 0 {
+		opts.RebalanceWindow = flagOpts.RebalanceWindow
+	}
+	peers := geecache.NewHTTPPoolOpts(c.Self, opts)
+	// 2.应用配置并开始监听变化，目前只有 scores 有数据源
+	w, err := config.Watch(path, config.WatcherOptions{
+		Peers:  peers,
+		Picker: peers,
+		Getter: func(group string) geecache.Getter {
+			if group == "scores" {
+				return dbGetter
 			}
-			return nil, fmt.Errorf("%s 不存在", key)
-		}))
+			return nil
+		},
+		SIGHUP: true,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	gee := w.Group("scores")
+	if gee != nil {
+		restoreSnapshot(gee)
+		if api {
+			go startAPIServer(apiAddr, gee)
+		}
+	}
+	log.Println("geecache 运行在", c.Self)
+	srv := &http.Server{
+		Addr:      listenHost(c.Self),
+		Handler:   peers,
+		TLSConfig: peers.ServerTLSConfig(),
+	}
+	serveHTTP(srv)
+	// 3.收到 SIGINT、SIGTERM 时优雅下线
+	shutdown(gee, peers, srv)
+}
+
+// listenHost 从 http://xxx 或 https://xxx 形式的地址中取出监听地址
+func listenHost(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil {
+		log.Fatalf("地址 %s 格式错误：%v", addr, err)
+	}
+	return u.Host
+}
+
+// 本节点地址、gossip 和节点发现的配置，都为空时使用固定的节点列表
+var (
+	selfAddr      string
+	gossipAddr    string
+	seeds         string
+	discoverySpec string
+)
+
+// 优雅下线的配置
+var (
+	handoffKeys  int
+	snapshotFile string
+)
+
+const shutdownTimeout = 30 * time.Second
+
+// setPeers 设置节点：设置了节点发现时由 Discovery 持续更新节点；
+// 启用 gossip 后通过种子节点加入集群，成员变化时自动更新哈希环；否则使用固定的节点列表
+func setPeers(self string, addrs []string, peers geecache.PeerSetter) {
+	if discoverySpec != "" {
+		scheme := strings.SplitN(self, "://", 2)[0]
+		d, err := discovery.Parse(discoverySpec, scheme)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			if err := discovery.Run(context.Background(), d, peers); err != nil {
+				log.Fatalf("节点发现失败：%v", err)
+			}
+		}()
+		return
+	}
+	if gossipAddr == "" {
+		peers.Set(addrs...)
+		return
+	}
+	var seedList []string
+	if seeds != "" {
+		seedList = strings.Split(seeds, ",")
+	}
+	m, err := gossip.New(gossip.Options{
+		Name:     self,
+		Meta:     self,
+		BindAddr: gossipAddr,
+		Seeds:    seedList,
+		Peers:    peers,
+	})
+	if err != nil {
+		log.Fatalf("启动 gossip 失败：%v", err)
+	}
+	if err := m.Join(seedList...); err != nil {
+		// 种子节点可能还没有启动，后台会继续尝试加入
+		log.Println(err)
+	}
 }
 
 // 实现缓存服务器 startCacheServer 函数
-func startCacheServer(addr string, addrs []string, gee *geecache.Group) {
-	// 1.创建一个 HTTPPool
-	peers := geecache.NewHTTPPool(addr)
+func startCacheServer(addr string, addrs []string, gee *geecache.Group, opts *geecache.HTTPPoolOptions) {
+	// 1.创建一个 HTTPPool，配置了 TLS 时节点间使用 HTTPS 通信
+	peers := geecache.NewHTTPPoolOpts(addr, opts)
 	// 2.使用一致性哈希算法添加节点
-	peers.Set(addrs...)
+	setPeers(addr, addrs, peers)
 	// 3.注册节点到 Group
 	gee.RegisterPeers(peers)
 	log.Println("geecache 运行在", addr)
-	log.Fatal(http.ListenAndServe(addr[7:], peers)) // http://xxx
+	srv := &http.Server{
+		Addr:      listenHost(addr),
+		Handler:   peers,
+		TLSConfig: peers.ServerTLSConfig(),
+	}
+	serveHTTP(srv)
+	// 4.收到 SIGINT、SIGTERM 时优雅下线
+	shutdown(gee, peers, srv)
+}
+
+// serveHTTP 在后台启动缓存服务器，设置了 TLSConfig 时使用 HTTPS
+func serveHTTP(srv *http.Server) {
+	go func() {
+		var err error
+		if srv.TLSConfig != nil {
+			// 证书由 TLSConfig 提供，这里不需要传入证书文件
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+}
+
+// shutdown 等待退出信号后下线：HTTP 节点先通知其他节点自己下线、交接最近访问的条目，
+// 然后停止接受新的请求并等待正在处理的请求结束（srv 为 nil 时直接关闭 peers 的监听），最后保存快照；
+// gee 为 nil 时（配置文件中没有 scores）不交接也不保存快照
+func shutdown(gee *geecache.Group, peers io.Closer, srv *http.Server) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	<-ch
+	log.Println("geecache 开始下线")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if hp, ok := peers.(*geecache.HTTPPool); ok {
+		// 1.下线期间仍然处理其他节点的请求，直到它们更新哈希环
+		err := hp.Leave(ctx)
+		if err != nil {
+			log.Println(err)
+		}
+		// 2.交接最近访问的条目，未配置 HMAC 或双向认证时其他节点不接受写入
+		if gee != nil && handoffKeys > 0 && !errors.Is(err, geecache.ErrPeerWritesDisabled) {
+			n, err := gee.Handoff(ctx, handoffKeys)
+			if err != nil {
+				log.Println(err)
+			}
+			log.Printf("交接了 %d 个条目", n)
+		}
+	}
+	// 3.停止接受新的请求，等待正在处理的请求结束
+	if srv != nil {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Println(err)
+		}
+	}
+	peers.Close()
+	// 4.保存快照，下次启动时恢复
+	if gee != nil && snapshotFile != "" {
+		if _, err := gee.SnapshotFile(snapshotFile); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// restoreSnapshot 启动时从快照恢复缓存，快照不存在时跳过
+func restoreSnapshot(gee *geecache.Group) {
+	if snapshotFile == "" {
+		return
+	}
+	if _, err := gee.RestoreFile(snapshotFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Println(err)
+	}
+}
+
+// startTCPCacheServer 使用自定义的二进制协议在节点间通信，不支持下线通知和交接
+func startTCPCacheServer(addr string, addrs []string, gee *geecache.Group) {
+	peers := geecache.NewTCPPool(addr, nil)
+	setPeers(addr, addrs, peers)
+	gee.RegisterPeers(peers)
+	log.Println("geecache 运行在", addr)
+	go func() {
+		// 关闭后 ListenAndServe 返回 nil
+		if err := peers.ListenAndServe(); err != nil {
+			log.Fatal(err)
+		}
+	}()
+	shutdown(gee, peers, nil)
+}
+
+// startRPCCacheServer 使用 net/rpc 实现的 GroupCache 服务在节点间通信，不支持下线通知和交接
+func startRPCCacheServer(addr string, addrs []string, gee *geecache.Group) {
+	peers := geecache.NewRPCPool(addr, nil)
+	setPeers(addr, addrs, peers)
+	gee.RegisterPeers(peers)
+	log.Println("geecache 运行在", addr)
+	go func() {
+		if err := peers.ListenAndServe(); err != nil {
+			log.Fatal(err)
+		}
+	}()
+	shutdown(gee, peers, nil)
 }
 
 // 实现 API 服务器 startAPIServer
@@ -46,33 +274,88 @@ func startAPIServer(apiAddr string, gee *geecache.Group) {
 		func(w http.ResponseWriter, r *http.Request) {
 			// 1.取出请求路径中表示 key 的部分
 			key := r.URL.Query().Get("key")
-			// 2.查找 key 对应的缓存
-			view, err := gee.Get(key)
+			// 2.以流的形式查找 key 对应的缓存，大对象不会被完整地复制
+			rc, err := gee.GetStream(key)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			defer rc.Close()
 			// 设置响应体的请求头
 			w.Header().Set("Content-Type", "aplication/octet-stream")
-			w.Write(view.ByteSlice())
+			io.Copy(w, rc)
 		}))
 	log.Println("fontend server 运行在", apiAddr)
-	log.Fatal(http.ListenAndServe(apiAddr[7:], nil))
+	log.Fatal(http.ListenAndServe(listenHost(apiAddr), nil))
 	// 传入 nil 默认使用多路复用来处理请求
 }
 
 func main() {
 	var port int
 	var api bool
+	var certFile, keyFile, caFile string
+	var mtls bool
+	var hmacSecret string
+	var protocol string
+	var configFile string
+	var rebalanceWindow time.Duration
 	flag.IntVar(&port, "port", 8001, "Geecache 服务器端口")
 	flag.BoolVar(&api, "api", false, "启用 api 服务器？")
+	flag.StringVar(&certFile, "tls-cert", "", "节点证书，设置后节点间使用 HTTPS 通信")
+	flag.StringVar(&keyFile, "tls-key", "", "节点证书私钥")
+	flag.StringVar(&caFile, "tls-ca", "", "校验其他节点证书的 CA")
+	flag.BoolVar(&mtls, "mtls", false, "启用双向认证？")
+	flag.StringVar(&hmacSecret, "hmac-secret", "", "节点间请求签名的共享密钥，为空时不签名")
+	flag.StringVar(&protocol, "protocol", "http", "节点间通信协议：http、tcp 或 rpc，tcp 和 rpc 没有认证，只应在可信网络中使用")
+	flag.StringVar(&selfAddr, "self", "", "本节点对外的地址，如 http://10.0.0.1:8001，必须与节点发现、gossip 得到的地址一致，默认为 localhost 加端口")
+	flag.StringVar(&gossipAddr, "gossip", "", "gossip 监听的 UDP 地址，设置后通过 gossip 自动发现节点")
+	flag.StringVar(&seeds, "seeds", "", "gossip 种子节点地址，多个地址用逗号分隔")
+	flag.StringVar(&discoverySpec, "discovery", "", "节点发现方式，如 file:///path/peers、dns+srv://_geecache._tcp.example.com、dns://cache.example.com:8001")
+	flag.DurationVar(&rebalanceWindow, "rebalance-window", time.Minute, "节点变化后从之前的所有者预热的过渡期，为 0 时不预热")
+	flag.IntVar(&handoffKeys, "handoff", 100, "下线前交接给新所有者的最近访问的条目数，需要配置 -hmac-secret 或 -mtls，为 0 时不交接")
+	flag.StringVar(&snapshotFile, "snapshot", "", "缓存快照文件，启动时恢复，下线时保存，为空时不使用快照")
+	flag.StringVar(&configFile, "config", "", "JSON 配置文件，设置后从配置文件读取节点和 Group，修改后自动重新加载")
 	flag.Parse()
 	// 1.初始化参数
+	scheme := "http"
+	opts := &geecache.HTTPPoolOptions{RebalanceWindow: rebalanceWindow}
+	if certFile != "" {
+		scheme = "https"
+		opts.TLS = &geecache.TLSOptions{
+			CertFile:   certFile,
+			KeyFile:    keyFile,
+			CAFile:     caFile,
+			ClientAuth: mtls,
+		}
+	}
+	if hmacSecret != "" {
+		opts.HMAC = &geecache.HMACOptions{
+			Keys:      map[string][]byte{"default": []byte(hmacSecret)},
+			SignKeyID: "default",
+		}
+	}
+	if protocol == "tcp" || protocol == "rpc" {
+		scheme = "tcp"
+		// 只有 HTTP 协议支持下线通知和写入其他节点
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "handoff" && handoffKeys > 0 {
+				log.Fatalf("-handoff 只支持 -protocol=http")
+			}
+		})
+	}
 	apiAddr := "http://localhost:9999"
+	if configFile != "" {
+		startConfigServer(configFile, api, apiAddr, opts)
+		return
+	}
 	addrMap := map[int]string{
-		8001: "http://localhost:8001",
-		8002: "http://localhost:8002",
-		8003: "http://localhost:8003",
+		8001: scheme + "://localhost:8001",
+		8002: scheme + "://localhost:8002",
+		8003: scheme + "://localhost:8003",
+	}
+	if selfAddr != "" {
+		// 节点发现返回的是对外的地址，self 与之一致时自己才会在哈希环中
+		addrMap[port] = selfAddr
 	}
 	var addrs []string
 	for _, v := range addrMap {
@@ -80,11 +363,20 @@ func main() {
 	}
 	// 2.创建一个名为 scores 的 Group，若缓存为空， 回调函数会从 db 中获取数据并返回
 	gee := createGroup()
+	restoreSnapshot(gee)
 
 	// 3.判断是否启动 api 服务器
 	if api {
 		go startAPIServer(apiAddr, gee) // api 服务器只有一个，缓存服务器有多个，这里需要使用协程
 	}
 	// 4.启动缓存服务器
-	startCacheServer(addrMap[port], []string(addrs), gee) // 这里使用 []string(addrs) 会创建一个新的切片，底层数组不会共享
+	switch protocol {
+	case "tcp":
+		startTCPCacheServer(addrMap[port], addrs, gee)
+		return
+	case "rpc":
+		startRPCCacheServer(addrMap[port], addrs, gee)
+		return
+	}
+	startCacheServer(addrMap[port], []string(addrs), gee, opts) // 这里使用 []string(addrs) 会创建一个新的切片，底层数组不会共享
 }